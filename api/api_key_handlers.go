@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/ildomm/ssccg/dao"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
+	"net/http"
+)
+
+// apiKeyHandler handles the admin requests managing the API keys.
+// Admins manage the keys of their tenant, the admin key given by configuration those of every tenant.
+type apiKeyHandler struct {
+	apiKeyDAO dao.APIKeyDAO
+}
+
+func NewAPIKeyHandler(apiKeyDAO dao.APIKeyDAO) *apiKeyHandler {
+	return &apiKeyHandler{
+		apiKeyDAO: apiKeyDAO,
+	}
+}
+
+// callerTenant returns the tenant whose API keys the caller manages.
+// Callers without API key, when authentication is disabled, manage the keys of every tenant.
+func callerTenant(r *http.Request) string {
+	if apiKey := APIKeyFromContext(r.Context()); apiKey != nil {
+		return apiKey.TenantID
+	}
+	return domain.AllTenants
+}
+
+// Transform domain.APIKey to api.APIKeyResponse
+func transformToAPIKeyResponse(apiKey domain.APIKey) APIKeyResponse {
+	deviceIds := apiKey.DeviceIDs
+	if deviceIds == nil {
+		deviceIds = []uuid.UUID{}
+	}
+	return APIKeyResponse{
+		ID:        apiKey.ID,
+		TenantID:  apiKey.TenantID,
+		Name:      apiKey.Name,
+		Scopes:    apiKey.Scopes,
+		DeviceIDs: deviceIds,
+		CreatedAt: apiKey.CreatedAt,
+	}
+}
+
+// CreateAPIKeyFunc handles the request to create a new API key.
+func (h *apiKeyHandler) CreateAPIKeyFunc(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid request body"})
+		return
+	}
+
+	tenantId := req.TenantID
+	caller := APIKeyFromContext(r.Context())
+	if tenantId == "" {
+		tenantId = domain.DefaultTenant
+		if caller != nil {
+			tenantId = caller.DeviceTenant()
+		}
+	}
+	if caller != nil && !caller.ManagesTenant(tenantId) {
+		WriteErrorResponse(w, http.StatusForbidden, []string{"API key may not manage the API keys of tenant " + tenantId})
+		return
+	}
+	if caller != nil && !caller.CoversDevices(req.DeviceIDs) {
+		WriteErrorResponse(w, http.StatusForbidden, []string{"API key may not grant devices it may not be used with"})
+		return
+	}
+
+	apiKey, key, err := h.apiKeyDAO.CreateAPIKey(tenantId, req.Name, req.Scopes, req.DeviceIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, dao.ErrInvalidTenant), errors.Is(err, dao.ErrInvalidAPIKeyName), errors.Is(err, dao.ErrInvalidScopes):
+			WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		default:
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusCreated, CreateAPIKeyResponse{
+		APIKeyResponse: transformToAPIKeyResponse(*apiKey),
+		Key:            key,
+	})
+}
+
+// ListAPIKeyFunc handles the request to list the API keys the caller manages, oldest first.
+func (h *apiKeyHandler) ListAPIKeyFunc(w http.ResponseWriter, r *http.Request) {
+	apiKeys, err := h.apiKeyDAO.ListAPIKeys(callerTenant(r))
+	if err != nil {
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		return
+	}
+
+	apiKeyResponses := make([]APIKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		apiKeyResponses = append(apiKeyResponses, transformToAPIKeyResponse(apiKey))
+	}
+	WriteAPIResponse(w, http.StatusOK, apiKeyResponses)
+}
+
+// DeleteAPIKeyFunc handles the request to revoke an API key.
+func (h *apiKeyHandler) DeleteAPIKeyFunc(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid API key ID"})
+		return
+	}
+
+	if err := h.apiKeyDAO.DeleteAPIKey(callerTenant(r), id); err != nil {
+		if errors.Is(err, persistence.ErrAPIKeyNotFound) {
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		} else {
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
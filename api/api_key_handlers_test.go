@@ -0,0 +1,295 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/dao"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
+	"github.com/ildomm/ssccg/test_helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAPIKeyFuncs tests the admin endpoints managing the API keys.
+func TestAPIKeyFuncs(t *testing.T) {
+	deviceId := uuid.New()
+	apiKey := domain.APIKey{ID: uuid.New(), TenantID: domain.DefaultTenant, Name: "terminal", Scopes: []string{domain.ScopeSignaturesCreate}, DeviceIDs: []uuid.UUID{deviceId}}
+	admin := &domain.APIKey{TenantID: domain.AllTenants, Name: dao.AdminAPIKeyName, Scopes: []string{domain.ScopeAdmin}}
+	retailAdmin := &domain.APIKey{TenantID: "retail", Name: "retail admin", Scopes: []string{domain.ScopeAdmin}}
+	restrictedAdmin := &domain.APIKey{TenantID: domain.DefaultTenant, Name: "store admin", Scopes: []string{domain.ScopeAdmin}, DeviceIDs: []uuid.UUID{deviceId}}
+
+	mockDAO := test_helpers.NewMockAPIKeyDAO()
+	mockDAO.On("Authenticate", "admin").Return(admin, nil)
+	mockDAO.On("Authenticate", "retail").Return(retailAdmin, nil)
+	mockDAO.On("Authenticate", "restricted").Return(restrictedAdmin, nil)
+	mockDAO.On("CreateAPIKey", domain.DefaultTenant, "terminal", []string{domain.ScopeSignaturesCreate}, []uuid.UUID{deviceId}).Return(&apiKey, "ssccg_secret", nil)
+	mockDAO.On("CreateAPIKey", domain.DefaultTenant, "terminal", []string{"unknown"}, []uuid.UUID(nil)).Return(nil, "", dao.ErrInvalidScopes)
+	mockDAO.On("CreateAPIKey", "retail", "terminal", []string{domain.ScopeSignaturesCreate}, []uuid.UUID(nil)).Return(&domain.APIKey{TenantID: "retail"}, "ssccg_retail", nil)
+	mockDAO.On("ListAPIKeys", domain.AllTenants).Return([]domain.APIKey{apiKey}, nil)
+	mockDAO.On("ListAPIKeys", "retail").Return([]domain.APIKey{}, nil)
+	mockDAO.On("DeleteAPIKey", domain.AllTenants, apiKey.ID).Return(nil)
+	mockDAO.On("DeleteAPIKey", domain.AllTenants, deviceId).Return(persistence.ErrAPIKeyNotFound)
+	mockDAO.On("DeleteAPIKey", "retail", apiKey.ID).Return(persistence.ErrAPIKeyNotFound)
+
+	server := NewServer()
+	server.WithAPIKeyManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	doAs := func(key, method, path string, body interface{}) *http.Response {
+		encoded, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, testServer.URL+path, bytes.NewReader(encoded))
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	do := func(method, path string, body interface{}) *http.Response {
+		return doAs("admin", method, path, body)
+	}
+
+	resp := do(http.MethodPost, "/api/v1/api-keys", CreateAPIKeyRequest{Name: "terminal", Scopes: apiKey.Scopes, DeviceIDs: apiKey.DeviceIDs})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created struct {
+		Data CreateAPIKeyResponse `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	assert.Equal(t, "ssccg_secret", created.Data.Key)
+	assert.Equal(t, transformToAPIKeyResponse(apiKey), created.Data.APIKeyResponse)
+
+	resp = do(http.MethodPost, "/api/v1/api-keys", CreateAPIKeyRequest{Name: "terminal", Scopes: []string{"unknown"}})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = do(http.MethodGet, "/api/v1/api-keys", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var listed struct {
+		Data []APIKeyResponse `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&listed))
+	resp.Body.Close()
+	assert.Equal(t, []APIKeyResponse{transformToAPIKeyResponse(apiKey)}, listed.Data)
+
+	for path, status := range map[string]int{
+		"/api/v1/api-keys/" + apiKey.ID.String(): http.StatusNoContent,
+		"/api/v1/api-keys/" + deviceId.String():  http.StatusNotFound,
+		"/api/v1/api-keys/not-an-id":             http.StatusBadRequest,
+	} {
+		resp = do(http.MethodDelete, path, nil)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, path)
+	}
+
+	// Tenant admins only manage the API keys of their tenant
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"CreateOwnTenant", http.MethodPost, "/api/v1/api-keys", CreateAPIKeyRequest{Name: "terminal", Scopes: apiKey.Scopes}, http.StatusCreated},
+		{"CreateOtherTenant", http.MethodPost, "/api/v1/api-keys", CreateAPIKeyRequest{TenantID: domain.DefaultTenant, Name: "terminal", Scopes: apiKey.Scopes}, http.StatusForbidden},
+		{"List", http.MethodGet, "/api/v1/api-keys", nil, http.StatusOK},
+		{"DeleteOtherTenant", http.MethodDelete, "/api/v1/api-keys/" + apiKey.ID.String(), nil, http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := doAs("retail", tc.method, tc.path, tc.body)
+			resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+
+	// Admins restricted to some devices only grant some of them
+	for _, tc := range []struct {
+		name      string
+		deviceIds []uuid.UUID
+		status    int
+	}{
+		{"OwnDevices", []uuid.UUID{deviceId}, http.StatusCreated},
+		{"EveryDevice", nil, http.StatusForbidden},
+		{"OtherDevice", []uuid.UUID{deviceId, uuid.New()}, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := doAs("restricted", http.MethodPost, "/api/v1/api-keys", CreateAPIKeyRequest{Name: "terminal", Scopes: apiKey.Scopes, DeviceIDs: tc.deviceIds})
+			resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+}
+
+// TestAPIKeyFuncsInternalError tests the admin endpoints when the API keys cannot be stored.
+func TestAPIKeyFuncsInternalError(t *testing.T) {
+	mockDAO := test_helpers.NewMockAPIKeyDAO()
+	mockDAO.On("ListAPIKeys", domain.AllTenants).Return(nil, errors.New("connection lost"))
+
+	rr := httptest.NewRecorder()
+	NewAPIKeyHandler(mockDAO).ListAPIKeyFunc(rr, httptest.NewRequest(http.MethodGet, "/api/v1/api-keys", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+// TestAPIKeyAuthorization walks through the API with keys of different scopes and devices.
+func TestAPIKeyAuthorization(t *testing.T) {
+	querier, err := persistence.NewInMemoryQuerier(context.TODO())
+	require.NoError(t, err)
+
+	apiKeyDAO := dao.NewAPIKeyDAO(querier).WithAdminKey("admin")
+	server := NewServer()
+	server.WithDeviceManager(dao.NewDeviceDAO(querier))
+	server.WithAPIKeyManager(apiKeyDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	do := func(key, method, path string, body interface{}) *http.Response {
+		encoded, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, testServer.URL+path, bytes.NewReader(encoded))
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	allowed, other := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{allowed, other} {
+		resp := do("admin", http.MethodPost, "/api/v1/devices/"+id.String(), CreateDeviceRequest{Algorithm: "ECDSA"})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	_, key, err := apiKeyDAO.CreateAPIKey(domain.DefaultTenant, "terminal", []string{domain.ScopeSignaturesCreate, domain.ScopeDevicesRead}, []uuid.UUID{allowed})
+	require.NoError(t, err)
+
+	// Health stays open
+	assert.Equal(t, http.StatusOK, do("", http.MethodGet, "/api/v1/health", nil).StatusCode)
+
+	sign := SignTransactionRequest{Data: "data"}
+	for _, tc := range []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"NoKey", "", http.MethodGet, "/api/v1/devices", nil, http.StatusUnauthorized},
+		{"UnknownKey", "unknown", http.MethodGet, "/api/v1/devices", nil, http.StatusUnauthorized},
+		{"Sign", key, http.MethodPost, "/api/v1/devices/" + allowed.String() + "/signatures", sign, http.StatusCreated},
+		{"SignOtherDevice", key, http.MethodPost, "/api/v1/devices/" + other.String() + "/signatures", sign, http.StatusForbidden},
+		{"MissingScope", key, http.MethodGet, "/api/v1/devices/" + allowed.String() + "/signatures", nil, http.StatusForbidden},
+		{"CreateDevice", key, http.MethodPost, "/api/v1/devices/" + allowed.String(), CreateDeviceRequest{Algorithm: "ECDSA"}, http.StatusForbidden},
+		{"ManageKeys", key, http.MethodGet, "/api/v1/api-keys", nil, http.StatusForbidden},
+		{"AdminManageKeys", "admin", http.MethodGet, "/api/v1/api-keys", nil, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.status, do(tc.key, tc.method, tc.path, tc.body).StatusCode)
+		})
+	}
+
+	// Keys restricted to some devices only list them
+	req, _ := http.NewRequest(http.MethodGet, testServer.URL+"/api/v1/devices", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var listed struct {
+		Data []DeviceResponse `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&listed))
+	require.Len(t, listed.Data, 1)
+	assert.Equal(t, allowed, listed.Data[0].ID)
+
+	// Signatures of other devices are not disclosed
+	transaction, err := server.deviceManager.CreateSignedTransaction(other, []byte("data"))
+	require.NoError(t, err)
+	_, reader, err := apiKeyDAO.CreateAPIKey(domain.DefaultTenant, "reader", []string{domain.ScopeSignaturesRead}, []uuid.UUID{allowed})
+	require.NoError(t, err)
+	path := "/api/v1/signatures/" + transaction.ID.String()
+	assert.Equal(t, http.StatusNotFound, do(reader, http.MethodGet, path, nil).StatusCode)
+	assert.Equal(t, http.StatusOK, do("admin", http.MethodGet, path, nil).StatusCode)
+}
+
+// TestTenantIsolation tests the devices and signatures of a tenant are not found by the other tenants.
+func TestTenantIsolation(t *testing.T) {
+	querier, err := persistence.NewInMemoryQuerier(context.TODO())
+	require.NoError(t, err)
+
+	apiKeyDAO := dao.NewAPIKeyDAO(querier).WithAdminKey("admin")
+	server := NewServer()
+	server.WithDeviceManager(dao.NewDeviceDAO(querier))
+	server.WithAPIKeyManager(apiKeyDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	do := func(key, method, path string, body interface{}, data interface{}) int {
+		encoded, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, testServer.URL+path, bytes.NewReader(encoded))
+		req.Header.Set(APIKeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if data != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(data))
+		}
+		return resp.StatusCode
+	}
+
+	scopes := []string{domain.ScopeDevicesCreate, domain.ScopeDevicesRead, domain.ScopeSignaturesCreate, domain.ScopeSignaturesRead}
+	_, retail, err := apiKeyDAO.CreateAPIKey("retail", "retail", scopes, nil)
+	require.NoError(t, err)
+	_, wholesale, err := apiKeyDAO.CreateAPIKey("wholesale", "wholesale", scopes, nil)
+	require.NoError(t, err)
+
+	deviceId := uuid.New()
+	var device struct {
+		Data DeviceResponse `json:"data"`
+	}
+	require.Equal(t, http.StatusCreated, do(retail, http.MethodPost, "/api/v1/devices/"+deviceId.String(), CreateDeviceRequest{Algorithm: "ECDSA"}, &device))
+	assert.Equal(t, "retail", device.Data.TenantID)
+	var signature struct {
+		Data SignedTransactionResponse `json:"data"`
+	}
+	require.Equal(t, http.StatusCreated, do(retail, http.MethodPost, "/api/v1/devices/"+deviceId.String()+"/signatures", SignTransactionRequest{Data: "data"}, &signature))
+
+	devicePath := "/api/v1/devices/" + deviceId.String()
+	signaturePath := "/api/v1/signatures/" + signature.Data.ID.String()
+	for _, tc := range []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"GetDevice", retail, http.MethodGet, devicePath, nil, http.StatusOK},
+		{"GetSignature", retail, http.MethodGet, signaturePath, nil, http.StatusOK},
+		{"GetDeviceOtherTenant", wholesale, http.MethodGet, devicePath, nil, http.StatusNotFound},
+		{"SignOtherTenant", wholesale, http.MethodPost, devicePath + "/signatures", SignTransactionRequest{Data: "data"}, http.StatusNotFound},
+		{"ListSignaturesOtherTenant", wholesale, http.MethodGet, devicePath + "/signatures", nil, http.StatusNotFound},
+		{"GetSignatureOtherTenant", wholesale, http.MethodGet, signaturePath, nil, http.StatusNotFound},
+		{"GetDeviceAdmin", "admin", http.MethodGet, devicePath, nil, http.StatusNotFound},
+		{"CreateDeviceTaken", retail, http.MethodPost, devicePath, CreateDeviceRequest{Algorithm: "ECDSA"}, http.StatusBadRequest},
+		{"CreateDeviceOtherTenant", wholesale, http.MethodPost, devicePath, CreateDeviceRequest{Algorithm: "ECDSA"}, http.StatusConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.status, do(tc.key, tc.method, tc.path, tc.body, nil))
+		})
+	}
+
+	var listed struct {
+		Data []DeviceResponse `json:"data"`
+	}
+	require.Equal(t, http.StatusOK, do(wholesale, http.MethodGet, "/api/v1/devices", nil, &listed))
+	assert.Empty(t, listed.Data)
+	require.Equal(t, http.StatusOK, do(retail, http.MethodGet, "/api/v1/devices", nil, &listed))
+	require.Len(t, listed.Data, 1)
+	assert.Equal(t, deviceId, listed.Data[0].ID)
+}
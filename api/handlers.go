@@ -3,11 +3,17 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/ildomm/ssccg/crypto"
 	"github.com/ildomm/ssccg/dao"
 	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 )
 
 // HealthHandler evaluates the health of the service and writes a standardized response.
@@ -29,39 +35,83 @@ func (s *Server) HealthHandler(response http.ResponseWriter, request *http.Reque
 
 // deviceHandler handles all requests related to devices.
 type deviceHandler struct {
-	deviceDAO dao.DeviceDAO
+	deviceDAO   dao.DeviceDAO
+	maxDataSize int64
 }
 
 func NewDeviceHandler(deviceDAO dao.DeviceDAO) *deviceHandler {
 	return &deviceHandler{
-		deviceDAO: deviceDAO,
+		deviceDAO:   deviceDAO,
+		maxDataSize: DefaultMaxDataSize,
 	}
 }
 
+// devices returns the device DAO scoped to the tenant of the caller.
+// Callers without API key, when authentication is disabled, use the devices of the default tenant.
+func (h *deviceHandler) devices(r *http.Request) dao.DeviceDAO {
+	scoped, ok := h.deviceDAO.(dao.TenantDeviceDAO)
+	if !ok {
+		return h.deviceDAO
+	}
+
+	tenantId := domain.DefaultTenant
+	if apiKey := APIKeyFromContext(r.Context()); apiKey != nil {
+		tenantId = apiKey.DeviceTenant()
+	}
+	return scoped.ForTenant(tenantId)
+}
+
 // Transform domain.Device to api.DeviceResponse
 func transformToDeviceResponse(device domain.Device) DeviceResponse {
 	return DeviceResponse{
-		ID:            device.ID,
-		Label:         device.Label,
-		SignAlgorithm: device.SignAlgorithm,
-		PublicKey:     device.PublicKey,
+		ID:               device.ID,
+		TenantID:         device.TenantID,
+		Label:            device.Label,
+		SignAlgorithm:    device.SignAlgorithm,
+		RSABits:          device.RSABits,
+		Curve:            device.Curve,
+		PublicKey:        device.PublicKey,
+		Status:           device.Status,
+		SignedDataFormat: device.SignedDataFormat,
+		CreatedAt:        device.CreatedAt,
+		UpdatedAt:        device.UpdatedAt,
 	}
 }
 
-// ListDeviceFunc handles the request to list all devices.
+// ListDeviceFunc handles the request to list a page of devices, in creation order.
 func (h *deviceHandler) ListDeviceFunc(w http.ResponseWriter, r *http.Request) {
-	devices, err := h.deviceDAO.GetDevices()
+	query := r.URL.Query()
+	page, err := parsePage(deviceCursor, query)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		return
+	}
+	filter := persistence.DeviceFilter{
+		Label:         query.Get("label"),
+		SignAlgorithm: query.Get("algorithm"),
+	}
+	// Keys restricted to some devices only list them
+	if apiKey := APIKeyFromContext(r.Context()); apiKey != nil && len(apiKey.DeviceIDs) > 0 {
+		filter.IDs = apiKey.DeviceIDs
+	}
+
+	devices, err := h.devices(r).ListDevices(filter, page)
 	if err != nil {
 		WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
 		return
 	}
 
+	devices, more := trimPage(devices, page)
 	deviceResponses := make([]DeviceResponse, 0, len(devices))
 	for _, device := range devices {
 		deviceResponses = append(deviceResponses, transformToDeviceResponse(device))
 	}
 
-	WriteAPIResponse(w, http.StatusOK, deviceResponses)
+	nextCursor := ""
+	if more {
+		nextCursor = encodeCursor(deviceCursor, devices[len(devices)-1].CreationSeq)
+	}
+	WriteAPIPageResponse(w, http.StatusOK, deviceResponses, nextCursor)
 }
 
 // CreateDeviceFunc handles the request to create a new device.
@@ -78,11 +128,15 @@ func (h *deviceHandler) CreateDeviceFunc(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	device, err := h.deviceDAO.CreateDevice(id, req.Label, req.Algorithm)
+	parameters := crypto.KeyParameters{RSABits: req.RSABits, Curve: req.Curve}
+	device, err := h.devices(r).CreateDevice(id, req.Label, req.Algorithm, parameters)
 	if err != nil {
-		if errors.Is(err, dao.ErrDeviceExists) || errors.Is(err, dao.ErrInvalidAlgorithm) {
+		switch {
+		case errors.Is(err, dao.ErrDeviceExists), errors.Is(err, dao.ErrInvalidAlgorithm), errors.Is(err, crypto.ErrInvalidKeyParameters):
 			WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
-		} else {
+		case errors.Is(err, dao.ErrDeviceIDUnavailable):
+			WriteErrorResponse(w, http.StatusConflict, []string{err.Error()})
+		default:
 			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
 		}
 		return
@@ -101,7 +155,7 @@ func (h *deviceHandler) GetDeviceFunc(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	device, err := h.deviceDAO.GetDevice(id)
+	device, err := h.devices(r).GetDevice(id)
 	if err != nil {
 		WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
 		return
@@ -114,20 +168,129 @@ func (h *deviceHandler) GetDeviceFunc(w http.ResponseWriter, r *http.Request) {
 // Transform domain.SignedTransaction to api.SignedTransactionResponse
 func transformToSignedTransactionResponse(transaction domain.SignedTransaction) SignedTransactionResponse {
 	return SignedTransactionResponse{
-		ID:         transaction.ID,
-		Signature:  transaction.Sign,
-		SignedData: transaction.SignedData(),
+		ID:            transaction.ID,
+		RawData:       transaction.RawData,
+		Signature:     transaction.Sign,
+		SignedData:    transaction.SignedData(),
+		FormatVersion: signedDataFormat(transaction),
+		HashAlgorithm: transaction.HashAlgorithm,
+		CreatedAt:     transaction.CreatedAt,
 	}
 }
 
-// CreateSignatureFunc handles the request to create a signature for a device.
-func (h *deviceHandler) CreateSignatureFunc(w http.ResponseWriter, r *http.Request) {
+// signedDataFormat returns the signed data format of a transaction, the first one when it was stored before versioning.
+func signedDataFormat(transaction domain.SignedTransaction) int {
+	if transaction.FormatVersion == 0 {
+		return domain.SignedDataFormatV1
+	}
+	return transaction.FormatVersion
+}
+
+// WithMaxDataSize sets the largest data accepted for signing, in bytes.
+func (h *deviceHandler) WithMaxDataSize(maxDataSize int64) *deviceHandler {
+	h.maxDataSize = maxDataSize
+	return h
+}
+
+// readSignData reads the data to sign from the request body, either raw with the application/octet-stream
+// content type, or as a JSON SignTransactionRequest.
+// It writes the error response and returns false when the data cannot be read.
+func (h *deviceHandler) readSignData(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/octet-stream" {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxDataSize))
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			WriteErrorResponse(w, http.StatusRequestEntityTooLarge, []string{ErrDataTooLarge.Error()})
+			return nil, false
+		case err != nil:
+			WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid request body"})
+			return nil, false
+		}
+		return data, true
+	}
+
 	var req SignTransactionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if !decodeJSONBody(w, r, maxJSONBodySize(h.maxDataSize, 1), &req) {
+		return nil, false
+	}
+	data, err := req.rawData()
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		return nil, false
+	}
+	if int64(len(data)) > h.maxDataSize {
+		WriteErrorResponse(w, http.StatusRequestEntityTooLarge, []string{ErrDataTooLarge.Error()})
+		return nil, false
+	}
+	return data, true
+}
+
+// decodeJSONBody decodes the JSON request body into v, reading up to limit bytes of it.
+// It writes the error response and returns false when the body cannot be decoded, or is larger than limit.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, limit int64, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		WriteErrorResponse(w, http.StatusRequestEntityTooLarge, []string{ErrDataTooLarge.Error()})
+		return false
+	case err != nil:
 		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid request body"})
+		return false
+	}
+	return true
+}
+
+// CreateSignatureFunc handles the request to create a signature for a device.
+// The data is given as JSON, or as the raw request body with the application/octet-stream content type.
+func (h *deviceHandler) CreateSignatureFunc(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
 		return
 	}
 
+	data, ok := h.readSignData(w, r)
+	if !ok {
+		return
+	}
+
+	// Retries sending the same idempotency key get the transaction signed the first time
+	var signed *domain.SignedTransaction
+	replayed := false
+	if idempotencyKey := r.Header.Get(IdempotencyKeyHeader); idempotencyKey != "" {
+		signed, replayed, err = h.devices(r).CreateIdempotentSignedTransaction(deviceId, idempotencyKey, data)
+	} else {
+		signed, err = h.devices(r).CreateSignedTransaction(deviceId, data)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, dao.ErrInvalidIdempotencyKey):
+			WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		case errors.Is(err, persistence.ErrDeviceNotFound):
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		case errors.Is(err, dao.ErrDeviceNotActive), errors.Is(err, persistence.ErrIdempotencyKeyConflict):
+			WriteErrorResponse(w, http.StatusConflict, []string{err.Error()})
+		case errors.Is(err, dao.ErrIdempotencyKeyReused):
+			WriteErrorResponse(w, http.StatusUnprocessableEntity, []string{err.Error()})
+		default:
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	if replayed {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	signedResponse := transformToSignedTransactionResponse(*signed)
+	WriteAPIResponse(w, http.StatusCreated, signedResponse)
+}
+
+// CreateDigestSignatureFunc handles the request to sign a digest computed by the client, for a device.
+// The digest stands in for the raw data of the signed data, so large documents do not have to be uploaded.
+func (h *deviceHandler) CreateDigestSignatureFunc(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	deviceId, err := uuid.Parse(vars["id"])
 	if err != nil {
@@ -135,9 +298,28 @@ func (h *deviceHandler) CreateSignatureFunc(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	signed, err := h.deviceDAO.CreateSignedTransaction(deviceId, []byte(req.Data))
+	var req SignDigestRequest
+	if !decodeJSONBody(w, r, maxJSONBodySize(h.maxDataSize, 1), &req) {
+		return
+	}
+	digest, err := req.decodedDigest()
 	if err != nil {
-		WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		return
+	}
+
+	signed, err := h.devices(r).CreateDigestSignedTransaction(deviceId, req.HashAlgorithm, digest)
+	if err != nil {
+		switch {
+		case errors.Is(err, crypto.ErrInvalidDigestHash), errors.Is(err, crypto.ErrInvalidDigest):
+			WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		case errors.Is(err, persistence.ErrDeviceNotFound):
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		case errors.Is(err, dao.ErrDeviceNotActive):
+			WriteErrorResponse(w, http.StatusConflict, []string{err.Error()})
+		default:
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
 		return
 	}
 
@@ -145,7 +327,75 @@ func (h *deviceHandler) CreateSignatureFunc(w http.ResponseWriter, r *http.Reque
 	WriteAPIResponse(w, http.StatusCreated, signedResponse)
 }
 
-// ListSignatureFunc handles the request to list signatures for a device.
+// CreateSignatureBatchFunc handles the request to sign a batch of data items for a device, in order.
+// A partial batch with failed items is answered with 207 Multi-Status.
+func (h *deviceHandler) CreateSignatureBatchFunc(w http.ResponseWriter, r *http.Request) {
+	var req BatchSignTransactionRequest
+	if !decodeJSONBody(w, r, maxJSONBodySize(h.maxDataSize, dao.MaxBatchSize), &req) {
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = domain.BatchModeAtomic
+	}
+
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
+		return
+	}
+
+	data := make([][]byte, len(req.Items))
+	for i, item := range req.Items {
+		if data[i], err = item.rawData(); err != nil {
+			WriteErrorResponse(w, http.StatusBadRequest, []string{fmt.Sprintf("item %d: %v", i, err)})
+			return
+		}
+		if int64(len(data[i])) > h.maxDataSize {
+			WriteErrorResponse(w, http.StatusRequestEntityTooLarge, []string{fmt.Sprintf("item %d: %v", i, ErrDataTooLarge)})
+			return
+		}
+	}
+
+	results, err := h.devices(r).CreateSignedTransactions(deviceId, data, req.Mode)
+	if err != nil {
+		switch {
+		case errors.Is(err, dao.ErrInvalidBatch), errors.Is(err, dao.ErrInvalidBatchMode):
+			WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		case errors.Is(err, persistence.ErrDeviceNotFound):
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		case errors.Is(err, dao.ErrDeviceNotActive):
+			WriteErrorResponse(w, http.StatusConflict, []string{err.Error()})
+		default:
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	response := BatchSignatureResponse{
+		Mode:    req.Mode,
+		Results: make([]BatchSignatureItemResponse, len(results)),
+	}
+	for i, result := range results {
+		response.Results[i].Index = i
+		if result.Err != nil {
+			response.Results[i].Error = result.Err.Error()
+			response.Failed++
+			continue
+		}
+		signed := transformToSignedTransactionResponse(*result.Transaction)
+		response.Results[i].Signature = &signed
+		response.Signed++
+	}
+
+	status := http.StatusCreated
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	WriteAPIResponse(w, status, response)
+}
+
+// ListSignatureFunc handles the request to list a page of signatures for a device, in sign counter order.
 func (h *deviceHandler) ListSignatureFunc(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	deviceId, err := uuid.Parse(vars["id"])
@@ -154,16 +404,346 @@ func (h *deviceHandler) ListSignatureFunc(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	signatures, err := h.deviceDAO.GetSignedTransactions(deviceId)
+	query := r.URL.Query()
+	page, err := parsePage(signedTransactionCursor, query)
 	if err != nil {
-		WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		return
+	}
+	var filter persistence.SignedTransactionFilter
+	if filter.FromSignCounter, err = parseCounter(query, "from_counter"); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		return
+	}
+	if filter.ToSignCounter, err = parseCounter(query, "to_counter"); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		return
+	}
+	if filter.From, err = parseTime(query, "from"); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		return
+	}
+	if filter.To, err = parseTime(query, "to"); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
 		return
 	}
 
+	signatures, err := h.devices(r).ListSignedTransactions(deviceId, filter, page)
+	if err != nil {
+		if errors.Is(err, persistence.ErrDeviceNotFound) {
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		} else {
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	signatures, more := trimPage(signatures, page)
 	signaturesResponses := make([]SignedTransactionResponse, 0, len(signatures))
 	for _, signature := range signatures {
 		signaturesResponses = append(signaturesResponses, transformToSignedTransactionResponse(signature))
 	}
 
-	WriteAPIResponse(w, http.StatusOK, signaturesResponses)
+	nextCursor := ""
+	if more {
+		nextCursor = encodeCursor(signedTransactionCursor, int64(signatures[len(signatures)-1].SignCounter))
+	}
+	WriteAPIPageResponse(w, http.StatusOK, signaturesResponses, nextCursor)
+}
+
+// Transform domain.SignedTransaction to api.SignedTransactionDetailResponse
+func transformToSignedTransactionDetailResponse(transaction domain.SignedTransaction) SignedTransactionDetailResponse {
+	return SignedTransactionDetailResponse{
+		ID:                transaction.ID,
+		DeviceID:          transaction.DeviceID,
+		SignCounter:       transaction.SignCounter,
+		RawData:           transaction.RawData,
+		PreviousSignature: transaction.PreviousDeviceSign,
+		Signature:         transaction.Sign,
+		SignedData:        transaction.SignedData(),
+		FormatVersion:     signedDataFormat(transaction),
+		HashAlgorithm:     transaction.HashAlgorithm,
+		CreatedAt:         transaction.CreatedAt,
+	}
+}
+
+// GetSignatureFunc handles the request to retrieve the signature of a device with a given sign counter.
+func (h *deviceHandler) GetSignatureFunc(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
+		return
+	}
+	signCounter, err := strconv.Atoi(vars["counter"])
+	if err != nil || signCounter < 1 {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid sign counter"})
+		return
+	}
+
+	transaction, err := h.devices(r).GetSignedTransaction(deviceId, signCounter)
+	if err != nil {
+		if errors.Is(err, persistence.ErrDeviceNotFound) || errors.Is(err, dao.ErrSignedTransactionNotFound) {
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		} else {
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, transformToSignedTransactionDetailResponse(*transaction))
+}
+
+// GetSignatureByIDFunc handles the request to retrieve a signature by its transaction ID.
+func (h *deviceHandler) GetSignatureByIDFunc(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	transactionId, err := uuid.Parse(vars["transactionId"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid transaction ID"})
+		return
+	}
+
+	transaction, err := h.devices(r).GetSignedTransactionByID(transactionId)
+	if err != nil {
+		if errors.Is(err, dao.ErrSignedTransactionNotFound) {
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		} else {
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+	// The device of the transaction is only known now, transactions of devices the key may not use are not disclosed
+	if apiKey := APIKeyFromContext(r.Context()); apiKey != nil && !apiKey.AllowsDevice(transaction.DeviceID) {
+		WriteErrorResponse(w, http.StatusNotFound, []string{dao.ErrSignedTransactionNotFound.Error()})
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, transformToSignedTransactionDetailResponse(*transaction))
+}
+
+// Transform domain.SignatureVerification to api.SignatureVerificationResponse
+func transformToSignatureVerificationResponse(verification domain.SignatureVerification) SignatureVerificationResponse {
+	return SignatureVerificationResponse{
+		Valid:         verification.Valid,
+		Reason:        verification.Reason,
+		TransactionID: verification.TransactionID,
+		SignCounter:   verification.SignCounter,
+	}
+}
+
+// VerifySignatureFunc handles the request to verify a signature against a device public key.
+func (h *deviceHandler) VerifySignatureFunc(w http.ResponseWriter, r *http.Request) {
+	var req VerifySignatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid request body"})
+		return
+	}
+
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
+		return
+	}
+
+	verificationRequest := domain.SignatureVerificationRequest{Signature: req.Signature}
+	if req.TransactionID != "" {
+		verificationRequest.TransactionID, err = uuid.Parse(req.TransactionID)
+		if err != nil {
+			WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid transaction ID"})
+			return
+		}
+	}
+	if req.SignedData != "" {
+		verificationRequest.SignedData = []byte(req.SignedData)
+	}
+
+	verification, err := h.devices(r).VerifySignedTransaction(deviceId, verificationRequest)
+	if err != nil {
+		switch {
+		case errors.Is(err, dao.ErrInvalidVerificationRequest):
+			WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		case errors.Is(err, persistence.ErrDeviceNotFound), errors.Is(err, dao.ErrSignedTransactionNotFound):
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		default:
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, transformToSignatureVerificationResponse(*verification))
+}
+
+// Transform domain.ChainAudit to api.ChainAuditResponse
+func transformToChainAuditResponse(audit domain.ChainAudit) ChainAuditResponse {
+	issues := make([]ChainAuditIssueResponse, 0, len(audit.Issues))
+	for _, issue := range audit.Issues {
+		issues = append(issues, ChainAuditIssueResponse{
+			SignCounter:   issue.SignCounter,
+			Kind:          issue.Kind,
+			TransactionID: issue.TransactionID,
+			Detail:        issue.Detail,
+		})
+	}
+
+	return ChainAuditResponse{
+		DeviceID:            audit.DeviceID,
+		Valid:               audit.Valid,
+		TransactionsChecked: audit.TransactionsChecked,
+		FirstInvalidCounter: audit.FirstInvalidCounter,
+		Issues:              issues,
+	}
+}
+
+// AuditFunc handles the request to audit the whole signature chain of a device.
+func (h *deviceHandler) AuditFunc(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
+		return
+	}
+
+	audit, err := h.devices(r).AuditSignedTransactions(deviceId)
+	if err != nil {
+		if errors.Is(err, persistence.ErrDeviceNotFound) {
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		} else {
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, transformToChainAuditResponse(*audit))
+}
+
+// Transform domain.DeviceKey to api.DeviceKeyResponse
+func transformToDeviceKeyResponse(key domain.DeviceKey) DeviceKeyResponse {
+	return DeviceKeyResponse{
+		PublicKey: key.PublicKey,
+		ValidFrom: key.ValidFrom,
+		ValidTo:   key.ValidTo,
+	}
+}
+
+// ListDeviceKeyFunc handles the request to list the current and retired public keys of a device.
+func (h *deviceHandler) ListDeviceKeyFunc(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
+		return
+	}
+
+	keys, err := h.devices(r).GetDeviceKeys(deviceId)
+	if err != nil {
+		if errors.Is(err, persistence.ErrDeviceNotFound) {
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		} else {
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	keyResponses := make([]DeviceKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		keyResponses = append(keyResponses, transformToDeviceKeyResponse(key))
+	}
+
+	WriteAPIResponse(w, http.StatusOK, keyResponses)
+}
+
+// RotateDeviceKeyFunc handles the request to replace the key pair of a device.
+func (h *deviceHandler) RotateDeviceKeyFunc(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
+		return
+	}
+
+	rotation, err := h.devices(r).RotateDeviceKey(deviceId)
+	if err != nil {
+		switch {
+		case errors.Is(err, persistence.ErrDeviceNotFound):
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		case errors.Is(err, dao.ErrDeviceNotActive):
+			WriteErrorResponse(w, http.StatusConflict, []string{err.Error()})
+		default:
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusCreated, KeyRotationResponse{
+		DeviceID:            rotation.DeviceID,
+		RetiredKey:          transformToDeviceKeyResponse(rotation.RetiredKey),
+		CurrentKey:          transformToDeviceKeyResponse(rotation.CurrentKey),
+		RotationTransaction: transformToSignedTransactionResponse(rotation.Transaction),
+	})
+}
+
+// ChangeDeviceStatusFunc handles the request to move a device to another lifecycle state.
+func (h *deviceHandler) ChangeDeviceStatusFunc(w http.ResponseWriter, r *http.Request) {
+	var req ChangeDeviceStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid request body"})
+		return
+	}
+
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
+		return
+	}
+
+	device, err := h.devices(r).ChangeDeviceStatus(deviceId, req.Status, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, dao.ErrInvalidDeviceStatus):
+			WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
+		case errors.Is(err, persistence.ErrDeviceNotFound):
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		case errors.Is(err, dao.ErrInvalidStatusTransition):
+			WriteErrorResponse(w, http.StatusConflict, []string{err.Error()})
+		default:
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, transformToDeviceResponse(*device))
+}
+
+// ListDeviceStatusChangeFunc handles the request to list the lifecycle state changes of a device.
+func (h *deviceHandler) ListDeviceStatusChangeFunc(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceId, err := uuid.Parse(vars["id"])
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"invalid device ID"})
+		return
+	}
+
+	changes, err := h.devices(r).GetDeviceStatusChanges(deviceId)
+	if err != nil {
+		if errors.Is(err, persistence.ErrDeviceNotFound) {
+			WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
+		} else {
+			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		}
+		return
+	}
+
+	changeResponses := make([]DeviceStatusChangeResponse, 0, len(changes))
+	for _, change := range changes {
+		changeResponses = append(changeResponses, DeviceStatusChangeResponse{
+			FromStatus: change.FromStatus,
+			ToStatus:   change.ToStatus,
+			Reason:     change.Reason,
+			ChangedAt:  change.ChangedAt,
+		})
+	}
+
+	WriteAPIResponse(w, http.StatusOK, changeResponses)
 }
@@ -2,10 +2,17 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/crypto"
+	"github.com/ildomm/ssccg/dao"
 	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
 	"github.com/ildomm/ssccg/test_helpers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -13,7 +20,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestHealthSuccess tests the Health function for a successful response.
@@ -69,7 +79,7 @@ func TestListDeviceFuncSuccess(t *testing.T) {
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		mockDAO := test_helpers.NewMockDeviceDAO()
-		mockDAO.On("GetDevices").Return([]domain.Device{}, nil)
+		mockDAO.On("ListDevices", persistence.DeviceFilter{}, persistence.Page{Limit: DefaultListLimit + 1}).Return([]domain.Device{}, nil)
 		deviceHandler := NewDeviceHandler(mockDAO)
 		deviceHandler.ListDeviceFunc(w, r)
 	})
@@ -88,9 +98,9 @@ func TestCreateDeviceFuncSuccess(t *testing.T) {
 		Label:         "Test Device",
 		SignAlgorithm: "RSA",
 		PublicKey:     "publicKey",
-		PrivateKey:    "privateKey",
+		KeyHandle:     "local:privateKey",
 	}
-	mockDAO.On("CreateDevice", mock.AnythingOfType("uuid.UUID"), "Test Device", "RSA").Return(testDevice, nil)
+	mockDAO.On("CreateDevice", mock.AnythingOfType("uuid.UUID"), "Test Device", "RSA", crypto.KeyParameters{}).Return(testDevice, nil)
 
 	// Create the server and set the mock manager
 	server := NewServer()
@@ -126,6 +136,27 @@ func TestCreateDeviceFuncSuccess(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// TestCreateDeviceFuncInvalidKeyParameters tests that key parameters refused by the policy are a bad request.
+func TestCreateDeviceFuncInvalidKeyParameters(t *testing.T) {
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	id := uuid.New()
+	parameters := crypto.KeyParameters{RSABits: 1024}
+	mockDAO.On("CreateDevice", id, "Test Device", "RSA", parameters).Return(nil, crypto.ErrInvalidKeyParameters)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	body, _ := json.Marshal(CreateDeviceRequest{Algorithm: "RSA", Label: "Test Device", RSABits: 1024})
+	resp, err := http.Post(testServer.URL+"/api/v1/devices/"+id.String(), "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	mockDAO.AssertExpectations(t)
+}
+
 // TestListSignatureFuncSuccess tests the ListSignatureFunc for a successful response.
 func TestListSignatureFuncSuccess(t *testing.T) {
 	mockDAO := test_helpers.NewMockDeviceDAO()
@@ -148,7 +179,8 @@ func TestListSignatureFuncSuccess(t *testing.T) {
 		},
 	}
 	deviceID := uuid.New()
-	mockDAO.On("GetSignedTransactions", deviceID).Return(testSignatures, nil)
+	mockDAO.On("ListSignedTransactions", deviceID, persistence.SignedTransactionFilter{}, persistence.Page{Limit: DefaultListLimit + 1}).
+		Return(testSignatures, nil)
 
 	// Create the server and set the mock manager
 	server := NewServer()
@@ -261,3 +293,751 @@ func TestCreateSignatureFuncInternalError(t *testing.T) {
 
 	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "Expected InternalServerError for simulated service error")
 }
+
+func TestCreateSignatureFuncDeviceNotActive(t *testing.T) {
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateSignedTransaction",
+		mock.AnythingOfType("uuid.UUID"), mock.AnythingOfType("[]uint8")).
+		Return(nil, dao.ErrDeviceNotActive)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	body, _ := json.Marshal(SignTransactionRequest{Data: "data"})
+	resp, err := http.Post(testServer.URL+"/api/v1/devices/"+uuid.New().String()+"/signatures", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+// TestCreateSignatureFuncIdempotencyKey tests the CreateSignatureFunc with an Idempotency-Key header.
+func TestCreateSignatureFuncIdempotencyKey(t *testing.T) {
+	deviceId := uuid.New()
+	transaction := &domain.SignedTransaction{ID: uuid.New(), DeviceID: deviceId, RawData: []byte("data"), Sign: "signature", SignCounter: 1}
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateIdempotentSignedTransaction", deviceId, "first", []byte("data")).Return(transaction, false, nil)
+	mockDAO.On("CreateIdempotentSignedTransaction", deviceId, "retry", []byte("data")).Return(transaction, true, nil)
+	mockDAO.On("CreateIdempotentSignedTransaction", deviceId, "reused", []byte("data")).Return(nil, false, dao.ErrIdempotencyKeyReused)
+	mockDAO.On("CreateIdempotentSignedTransaction", deviceId, "invalid", []byte("data")).Return(nil, false, dao.ErrInvalidIdempotencyKey)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	body, _ := json.Marshal(SignTransactionRequest{Data: "data"})
+	for key, expected := range map[string]struct {
+		status   int
+		replayed string
+	}{
+		"first":   {http.StatusCreated, ""},
+		"retry":   {http.StatusCreated, "true"},
+		"reused":  {http.StatusUnprocessableEntity, ""},
+		"invalid": {http.StatusBadRequest, ""},
+	} {
+		req, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/v1/devices/"+deviceId.String()+"/signatures", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(IdempotencyKeyHeader, key)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, expected.status, resp.StatusCode, key)
+		assert.Equal(t, expected.replayed, resp.Header.Get(IdempotentReplayedHeader), key)
+	}
+	mockDAO.AssertNotCalled(t, "CreateSignedTransaction", mock.Anything, mock.Anything)
+}
+
+// TestCreateSignatureBatchFunc tests the CreateSignatureBatchFunc responses.
+func TestCreateSignatureBatchFunc(t *testing.T) {
+	deviceId := uuid.New()
+	transaction := &domain.SignedTransaction{ID: uuid.New(), DeviceID: deviceId, RawData: []byte("first"), Sign: "signature", SignCounter: 1}
+	data := [][]byte{[]byte("first"), []byte("second")}
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateSignedTransactions", deviceId, data, domain.BatchModeAtomic).
+		Return([]domain.BatchSignature{{Transaction: transaction}, {Transaction: transaction}}, nil)
+	mockDAO.On("CreateSignedTransactions", deviceId, data, domain.BatchModePartial).
+		Return([]domain.BatchSignature{{Transaction: transaction}, {Err: errors.New("signing failed")}}, nil)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+	url := testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures:batch"
+
+	t.Run("Atomic", func(t *testing.T) {
+		body, _ := json.Marshal(BatchSignTransactionRequest{Items: []SignTransactionRequest{{Data: "first"}, {Data: "second"}}})
+		resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var respBody struct {
+			Data BatchSignatureResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		assert.Equal(t, domain.BatchModeAtomic, respBody.Data.Mode)
+		assert.Equal(t, 2, respBody.Data.Signed)
+		require.Len(t, respBody.Data.Results, 2)
+		assert.Equal(t, 1, respBody.Data.Results[1].Index)
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		body, _ := json.Marshal(BatchSignTransactionRequest{Mode: domain.BatchModePartial, Items: []SignTransactionRequest{{Data: "first"}, {Data: "second"}}})
+		resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+
+		var respBody struct {
+			Data BatchSignatureResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		assert.Equal(t, 1, respBody.Data.Signed)
+		assert.Equal(t, 1, respBody.Data.Failed)
+		require.Len(t, respBody.Data.Results, 2)
+		assert.Equal(t, transaction.ID, respBody.Data.Results[0].Signature.ID)
+		assert.Nil(t, respBody.Data.Results[1].Signature)
+		assert.Equal(t, "signing failed", respBody.Data.Results[1].Error)
+	})
+}
+
+// TestCreateSignatureBatchFuncErrors tests the CreateSignatureBatchFunc error responses.
+func TestCreateSignatureBatchFuncErrors(t *testing.T) {
+	deviceId := uuid.New()
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateSignedTransactions", deviceId, [][]byte{}, domain.BatchModeAtomic).Return(nil, dao.ErrInvalidBatch)
+	mockDAO.On("CreateSignedTransactions", deviceId, [][]byte{[]byte("data")}, domain.BatchModeAtomic).
+		Return(nil, &dao.BatchItemError{Index: 0, Err: dao.ErrDeviceNotActive})
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+	url := testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures:batch"
+
+	for body, status := range map[string]int{
+		`{"items": []}`:                 http.StatusBadRequest,
+		`{"items": [{"data": "data"}]}`: http.StatusConflict,
+		`{"items": [{"data": "data"}]`:  http.StatusBadRequest,
+	} {
+		resp, err := http.Post(url, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, body)
+	}
+}
+
+func TestCreateDigestSignatureFunc(t *testing.T) {
+	deviceId := uuid.New()
+	digest := sha256.Sum256([]byte("a large document"))
+	transaction := &domain.SignedTransaction{ID: uuid.New(), DeviceID: deviceId, RawData: digest[:], Sign: "signature", SignCounter: 1, HashAlgorithm: "SHA256"}
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateDigestSignedTransaction", deviceId, "SHA256", digest[:]).Return(transaction, nil)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+	url := testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures:digest"
+
+	// The digest is given either hex or base64 encoded
+	for _, encoded := range []string{
+		hex.EncodeToString(digest[:]),
+		strings.ToUpper(hex.EncodeToString(digest[:])),
+		base64.StdEncoding.EncodeToString(digest[:]),
+	} {
+		body, _ := json.Marshal(SignDigestRequest{Digest: encoded, HashAlgorithm: "SHA256"})
+		resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, encoded)
+
+		var respBody struct {
+			Data SignedTransactionResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		assert.Equal(t, digest[:], respBody.Data.RawData)
+		assert.Equal(t, "SHA256", respBody.Data.HashAlgorithm)
+	}
+	mockDAO.AssertNumberOfCalls(t, "CreateDigestSignedTransaction", 3)
+}
+
+// TestCreateDigestSignatureFuncErrors tests the CreateDigestSignatureFunc error responses.
+func TestCreateDigestSignatureFuncErrors(t *testing.T) {
+	deviceId := uuid.New()
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateDigestSignedTransaction", deviceId, "MD5", []byte{0xab, 0xcd}).Return(nil, crypto.ErrInvalidDigestHash)
+	mockDAO.On("CreateDigestSignedTransaction", deviceId, "SHA256", []byte{0xab, 0xcd}).Return(nil, crypto.ErrInvalidDigest)
+	mockDAO.On("CreateDigestSignedTransaction", deviceId, "SHA384", []byte{0xab, 0xcd}).Return(nil, dao.ErrDeviceNotActive)
+	mockDAO.On("CreateDigestSignedTransaction", deviceId, "SHA512", []byte{0xab, 0xcd}).Return(nil, persistence.ErrDeviceNotFound)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+	url := testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures:digest"
+
+	for body, status := range map[string]int{
+		`{"digest": "abcd", "hash_algorithm": "MD5"}`:    http.StatusBadRequest,
+		`{"digest": "abcd", "hash_algorithm": "SHA256"}`: http.StatusBadRequest,
+		`{"digest": "abcd", "hash_algorithm": "SHA384"}`: http.StatusConflict,
+		`{"digest": "abcd", "hash_algorithm": "SHA512"}`: http.StatusNotFound,
+		`{"digest": "abc", "hash_algorithm": "SHA256"}`:  http.StatusBadRequest,
+		`{"digest": "", "hash_algorithm": "SHA256"}`:     http.StatusBadRequest,
+		`{"digest": "not-a-digest!"}`:                    http.StatusBadRequest,
+		`{"digest": "abcd"`:                              http.StatusBadRequest,
+	} {
+		resp, err := http.Post(url, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, body)
+	}
+}
+
+func TestGetSignatureFunc(t *testing.T) {
+	deviceId := uuid.New()
+	transaction := domain.SignedTransaction{
+		ID:                 uuid.New(),
+		DeviceID:           deviceId,
+		RawData:            []byte("data"),
+		Sign:               "signature",
+		PreviousDeviceSign: "previous signature",
+		SignCounter:        3,
+	}
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("GetSignedTransaction", deviceId, 3).Return(&transaction, nil)
+	mockDAO.On("GetSignedTransaction", deviceId, 4).Return(nil, dao.ErrSignedTransactionNotFound)
+	mockDAO.On("GetSignedTransactionByID", transaction.ID).Return(&transaction, nil)
+	mockDAO.On("GetSignedTransactionByID", mock.Anything).Return(nil, dao.ErrSignedTransactionNotFound)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	for _, path := range []string{
+		"/api/v1/devices/" + deviceId.String() + "/signatures/3",
+		"/api/v1/signatures/" + transaction.ID.String(),
+	} {
+		resp, err := http.Get(testServer.URL + path)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+
+		var respBody struct {
+			Data SignedTransactionDetailResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		resp.Body.Close()
+		assert.Equal(t, SignedTransactionDetailResponse{
+			ID:                transaction.ID,
+			DeviceID:          deviceId,
+			SignCounter:       3,
+			RawData:           []byte("data"),
+			PreviousSignature: "previous signature",
+			Signature:         "signature",
+			SignedData:        transaction.SignedData(),
+			FormatVersion:     domain.SignedDataFormatV1,
+		}, respBody.Data, path)
+	}
+
+	for path, status := range map[string]int{
+		"/api/v1/devices/" + deviceId.String() + "/signatures/4": http.StatusNotFound,
+		"/api/v1/devices/" + deviceId.String() + "/signatures/0": http.StatusBadRequest,
+		"/api/v1/signatures/" + uuid.New().String():              http.StatusNotFound,
+		"/api/v1/signatures/not-an-id":                           http.StatusBadRequest,
+	} {
+		resp, err := http.Get(testServer.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, path)
+	}
+}
+
+// TestVerifySignatureFunc tests the VerifySignatureFunc responses.
+func TestVerifySignatureFunc(t *testing.T) {
+	deviceId := uuid.New()
+	transactionId := uuid.New()
+	url := "/api/v1/devices/" + deviceId.String() + "/signatures/verify"
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("VerifySignedTransaction", deviceId, domain.SignatureVerificationRequest{TransactionID: transactionId}).
+		Return(&domain.SignatureVerification{Valid: true, TransactionID: &transactionId, SignCounter: 1}, nil)
+	mockDAO.On("VerifySignedTransaction", deviceId,
+		domain.SignatureVerificationRequest{SignedData: []byte("1_data_prev"), Signature: "c2lnbg=="}).
+		Return(&domain.SignatureVerification{Reason: domain.VerificationReasonSignatureMismatch}, nil)
+	mockDAO.On("VerifySignedTransaction", deviceId, domain.SignatureVerificationRequest{}).
+		Return(nil, dao.ErrInvalidVerificationRequest)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	post := func(req VerifySignatureRequest) (*http.Response, SignatureVerificationResponse) {
+		body, _ := json.Marshal(req)
+		resp, err := http.Post(testServer.URL+url, "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var respBody struct {
+			Data SignatureVerificationResponse `json:"data"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&respBody)
+		return resp, respBody.Data
+	}
+
+	t.Run("ValidByTransactionID", func(t *testing.T) {
+		resp, verification := post(VerifySignatureRequest{TransactionID: transactionId.String()})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.True(t, verification.Valid)
+		assert.Equal(t, &transactionId, verification.TransactionID)
+	})
+
+	t.Run("InvalidBySignedData", func(t *testing.T) {
+		resp, verification := post(VerifySignatureRequest{SignedData: "1_data_prev", Signature: "c2lnbg=="})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.False(t, verification.Valid)
+		assert.Equal(t, domain.VerificationReasonSignatureMismatch, verification.Reason)
+	})
+
+	t.Run("InvalidRequest", func(t *testing.T) {
+		resp, _ := post(VerifySignatureRequest{})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("InvalidTransactionID", func(t *testing.T) {
+		resp, _ := post(VerifySignatureRequest{TransactionID: "invalid"})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+// TestVerifySignatureFuncNotFound tests the VerifySignatureFunc for an unknown transaction.
+func TestVerifySignatureFuncNotFound(t *testing.T) {
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("VerifySignedTransaction", mock.AnythingOfType("uuid.UUID"), mock.Anything).
+		Return(nil, dao.ErrSignedTransactionNotFound)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	body, _ := json.Marshal(VerifySignatureRequest{TransactionID: uuid.New().String()})
+	resp, err := http.Post(testServer.URL+"/api/v1/devices/"+uuid.New().String()+"/signatures/verify",
+		"application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// TestAuditFunc tests the AuditFunc responses.
+func TestAuditFunc(t *testing.T) {
+	deviceId := uuid.New()
+	unknownId := uuid.New()
+	firstInvalid := 2
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("AuditSignedTransactions", deviceId).Return(&domain.ChainAudit{
+		DeviceID:            deviceId,
+		TransactionsChecked: 3,
+		FirstInvalidCounter: &firstInvalid,
+		Issues:              []domain.ChainAuditIssue{{SignCounter: 2, Kind: domain.AuditIssueBrokenLink}},
+	}, nil)
+	mockDAO.On("AuditSignedTransactions", unknownId).Return(nil, persistence.ErrDeviceNotFound)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	t.Run("Success", func(t *testing.T) {
+		resp, err := http.Get(testServer.URL + "/api/v1/devices/" + deviceId.String() + "/audit")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var respBody struct {
+			Data ChainAuditResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		assert.False(t, respBody.Data.Valid)
+		assert.Equal(t, 2, *respBody.Data.FirstInvalidCounter)
+		assert.Equal(t, domain.AuditIssueBrokenLink, respBody.Data.Issues[0].Kind)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		resp, err := http.Get(testServer.URL + "/api/v1/devices/" + unknownId.String() + "/audit")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestRotateDeviceKeyFunc(t *testing.T) {
+	deviceId := uuid.New()
+	unknownId := uuid.New()
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("RotateDeviceKey", deviceId).Return(&domain.KeyRotation{
+		DeviceID:    deviceId,
+		RetiredKey:  domain.DeviceKey{DeviceID: deviceId, PublicKey: "retired key", ValidFrom: 1, ValidTo: 3},
+		CurrentKey:  domain.DeviceKey{DeviceID: deviceId, PublicKey: "current key", ValidFrom: 4},
+		Transaction: domain.SignedTransaction{ID: uuid.New(), DeviceID: deviceId, SignCounter: 3, Sign: "signature"},
+	}, nil)
+	mockDAO.On("RotateDeviceKey", unknownId).Return(nil, persistence.ErrDeviceNotFound)
+	mockDAO.On("GetDeviceKeys", deviceId).Return([]domain.DeviceKey{
+		{DeviceID: deviceId, PublicKey: "retired key", ValidFrom: 1, ValidTo: 3},
+		{DeviceID: deviceId, PublicKey: "current key", ValidFrom: 4},
+	}, nil)
+	mockDAO.On("GetDeviceKeys", unknownId).Return(nil, persistence.ErrDeviceNotFound)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	t.Run("Rotate", func(t *testing.T) {
+		resp, err := http.Post(testServer.URL+"/api/v1/devices/"+deviceId.String()+"/keys/rotate", "application/json", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var respBody struct {
+			Data KeyRotationResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		assert.Equal(t, DeviceKeyResponse{PublicKey: "retired key", ValidFrom: 1, ValidTo: 3}, respBody.Data.RetiredKey)
+		assert.Equal(t, DeviceKeyResponse{PublicKey: "current key", ValidFrom: 4}, respBody.Data.CurrentKey)
+		assert.Equal(t, "signature", respBody.Data.RotationTransaction.Signature)
+	})
+
+	t.Run("ListKeys", func(t *testing.T) {
+		resp, err := http.Get(testServer.URL + "/api/v1/devices/" + deviceId.String() + "/keys")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var respBody struct {
+			Data []DeviceKeyResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		assert.Len(t, respBody.Data, 2)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		resp, err := http.Post(testServer.URL+"/api/v1/devices/"+unknownId.String()+"/keys/rotate", "application/json", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = http.Get(testServer.URL + "/api/v1/devices/" + unknownId.String() + "/keys")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestChangeDeviceStatusFunc(t *testing.T) {
+	deviceId := uuid.New()
+	changedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("ChangeDeviceStatus", deviceId, domain.DeviceStatusSuspended, "device lost").
+		Return(&domain.Device{ID: deviceId, Status: domain.DeviceStatusSuspended}, nil)
+	mockDAO.On("ChangeDeviceStatus", deviceId, domain.DeviceStatusActive, "").
+		Return(nil, dao.ErrInvalidStatusTransition)
+	mockDAO.On("ChangeDeviceStatus", deviceId, "lost", "").
+		Return(nil, dao.ErrInvalidDeviceStatus)
+	mockDAO.On("GetDeviceStatusChanges", deviceId).Return([]domain.DeviceStatusChange{{
+		DeviceID:   deviceId,
+		FromStatus: domain.DeviceStatusActive,
+		ToStatus:   domain.DeviceStatusSuspended,
+		Reason:     "device lost",
+		ChangedAt:  changedAt,
+	}}, nil)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	statusUrl := testServer.URL + "/api/v1/devices/" + deviceId.String() + "/status"
+	changeStatus := func(status, reason string) *http.Response {
+		body, _ := json.Marshal(ChangeDeviceStatusRequest{Status: status, Reason: reason})
+		resp, err := http.Post(statusUrl, "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		resp := changeStatus(domain.DeviceStatusSuspended, "device lost")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var respBody struct {
+			Data DeviceResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		assert.Equal(t, domain.DeviceStatusSuspended, respBody.Data.Status)
+	})
+
+	t.Run("InvalidTransition", func(t *testing.T) {
+		resp := changeStatus(domain.DeviceStatusActive, "")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("InvalidStatus", func(t *testing.T) {
+		resp := changeStatus("lost", "")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		resp, err := http.Get(statusUrl + "/changes")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var respBody struct {
+			Data []DeviceStatusChangeResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		require.Len(t, respBody.Data, 1)
+		assert.Equal(t, "device lost", respBody.Data[0].Reason)
+		assert.True(t, changedAt.Equal(respBody.Data[0].ChangedAt))
+	})
+}
+
+// TestEd25519EndToEnd creates an Ed25519 device, signs with it and verifies the signature through the API.
+func TestEd25519EndToEnd(t *testing.T) {
+	querier, err := persistence.NewInMemoryQuerier(context.TODO())
+	require.NoError(t, err)
+
+	server := NewServer()
+	server.WithDeviceManager(dao.NewDeviceDAO(querier))
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	deviceUrl := testServer.URL + "/api/v1/devices/" + uuid.New().String()
+
+	body, _ := json.Marshal(CreateDeviceRequest{Algorithm: "ED25519", Label: "Ed25519 Device"})
+	resp, err := http.Post(deviceUrl, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	body, _ = json.Marshal(SignTransactionRequest{Data: "data"})
+	resp, err = http.Post(deviceUrl+"/signatures", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var signed struct {
+		Data SignedTransactionResponse `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&signed))
+	resp.Body.Close()
+
+	body, _ = json.Marshal(VerifySignatureRequest{SignedData: signed.Data.SignedData, Signature: signed.Data.Signature})
+	resp, err = http.Post(deviceUrl+"/signatures/verify", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var verification struct {
+		Data SignatureVerificationResponse `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&verification))
+	assert.True(t, verification.Data.Valid)
+}
+
+// TestListSignatureFuncPagination walks the signatures of a device page by page through the API.
+func TestListSignatureFuncPagination(t *testing.T) {
+	querier, err := persistence.NewInMemoryQuerier(context.TODO())
+	require.NoError(t, err)
+	deviceDAO := dao.NewDeviceDAO(querier)
+
+	deviceId := uuid.New()
+	_, err = deviceDAO.CreateDevice(deviceId, "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := deviceDAO.CreateSignedTransaction(deviceId, []byte("data"))
+		require.NoError(t, err)
+	}
+
+	server := NewServer()
+	server.WithDeviceManager(deviceDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	listPage := func(query string) PageResponse {
+		resp, err := http.Get(testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures?" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var page PageResponse
+		page.Data = &[]SignedTransactionResponse{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		return page
+	}
+
+	var listed []SignedTransactionResponse
+	query := "limit=2"
+	for {
+		page := listPage(query)
+		listed = append(listed, *page.Data.(*[]SignedTransactionResponse)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query = "limit=2&cursor=" + page.NextCursor
+	}
+	require.Len(t, listed, 5)
+	for i, signature := range listed {
+		assert.Contains(t, signature.SignedData, `"sign_counter":`+strconv.Itoa(i+1)+`,`)
+	}
+
+	filtered := listPage("from_counter=2&to_counter=3")
+	assert.Len(t, *filtered.Data.(*[]SignedTransactionResponse), 2)
+	assert.Empty(t, filtered.NextCursor)
+
+	for _, query := range []string{"limit=0", "cursor=invalid", "from_counter=first"} {
+		resp, err := http.Get(testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures?" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+// TestListSignatureFuncTimeRange lists the signatures of a device created within a time range.
+func TestListSignatureFuncTimeRange(t *testing.T) {
+	querier, err := persistence.NewInMemoryQuerier(context.TODO())
+	require.NoError(t, err)
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	now := start
+	deviceDAO := dao.NewDeviceDAO(querier).WithClock(func() time.Time { return now })
+
+	deviceId := uuid.New()
+	_, err = deviceDAO.CreateDevice(deviceId, "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		now = start.Add(time.Duration(i) * time.Hour)
+		_, err := deviceDAO.CreateSignedTransaction(deviceId, []byte("data"))
+		require.NoError(t, err)
+	}
+
+	server := NewServer()
+	server.WithDeviceManager(deviceDAO)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	url := testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures?from=2024-01-02T04:00:00Z&to=2024-01-02T06:00:00Z"
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var page struct {
+		Data []SignedTransactionResponse `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, start.Add(time.Hour), page.Data[0].CreatedAt)
+	assert.Equal(t, start.Add(2*time.Hour), page.Data[1].CreatedAt)
+
+	resp, err = http.Get(testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures?to=yesterday")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// TestCreateSignatureFuncBinaryData tests the CreateSignatureFunc with base64 and raw binary data.
+func TestCreateSignatureFuncBinaryData(t *testing.T) {
+	deviceId := uuid.New()
+	binary := []byte{0x00, 0xff, 0x5f, 0xfe}
+	transaction := &domain.SignedTransaction{ID: uuid.New(), DeviceID: deviceId, RawData: binary, Sign: "signature", SignCounter: 1}
+
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateSignedTransaction", deviceId, binary).Return(transaction, nil)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	server.WithMaxDataSize(8)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+	url := testServer.URL + "/api/v1/devices/" + deviceId.String() + "/signatures"
+
+	post := func(contentType, body string) *http.Response {
+		resp, err := http.Post(url, contentType, strings.NewReader(body))
+		require.NoError(t, err)
+		return resp
+	}
+
+	for name, resp := range map[string]*http.Response{
+		"Base64":      post("application/json", `{"data_base64": "`+base64.StdEncoding.EncodeToString(binary)+`"}`),
+		"OctetStream": post("application/octet-stream", string(binary)),
+	} {
+		var respBody struct {
+			Data SignedTransactionResponse `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, name)
+		assert.Equal(t, binary, respBody.Data.RawData, name)
+	}
+
+	for body, status := range map[string]int{
+		`{"data": "text", "data_base64": "dGV4dA=="}`: http.StatusBadRequest,
+		`{"data_base64": "not base64!"}`:              http.StatusBadRequest,
+		`{"data": "more than 8 bytes"}`:               http.StatusRequestEntityTooLarge,
+	} {
+		resp := post("application/json", body)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, body)
+	}
+
+	resp := post("application/octet-stream", "more than 8 bytes")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	mockDAO.AssertNumberOfCalls(t, "CreateSignedTransaction", 2)
+}
+
+// TestSignatureFuncsBodyTooLarge tests the JSON bodies of the signing requests are read up to a size derived from the largest data.
+func TestSignatureFuncsBodyTooLarge(t *testing.T) {
+	deviceId := uuid.New()
+	mockDAO := test_helpers.NewMockDeviceDAO()
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	server.WithMaxDataSize(8)
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+	url := testServer.URL + "/api/v1/devices/" + deviceId.String()
+
+	// Padded with whitespace, the bodies are larger than the limit while still carrying small data
+	padding := func(limit int64) string {
+		return strings.Repeat(" ", int(limit))
+	}
+	for path, body := range map[string]string{
+		"/signatures":        `{"data": "data"` + padding(maxJSONBodySize(8, 1)) + `}`,
+		"/signatures:digest": `{"digest": "abcd", "hash_algorithm": "SHA256"` + padding(maxJSONBodySize(8, 1)) + `}`,
+		"/signatures:batch":  `{"items": [{"data": "data"}]` + padding(maxJSONBodySize(8, dao.MaxBatchSize)) + `}`,
+	} {
+		resp, err := http.Post(url+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode, path)
+	}
+	mockDAO.AssertNotCalled(t, "CreateSignedTransaction", mock.Anything, mock.Anything)
+	mockDAO.AssertNotCalled(t, "CreateDigestSignedTransaction", mock.Anything, mock.Anything, mock.Anything)
+	mockDAO.AssertNotCalled(t, "CreateSignedTransactions", mock.Anything, mock.Anything, mock.Anything)
+}
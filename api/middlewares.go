@@ -2,11 +2,17 @@ package api
 
 import (
 	"context"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/ildomm/ssccg/dao"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/metrics"
 	"log"
 	"net/http"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -124,3 +130,141 @@ func (lm LoggingMiddleware) perform(next http.Handler) http.Handler {
 		log.Printf("INFO: %s \"%s %s\" %d %dms\n", r.RemoteAddr, r.Method, r.URL.Path, recorder.Status, duration)
 	})
 }
+
+// unmatchedRoute labels the requests matching no route template
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddleware is a middleware that records the count and latency of the requests
+//
+// Requests are labelled with the template of their route, e.g. /api/v1/devices/{id}, so device IDs do not add labels.
+type MetricsMiddleware struct {
+	metrics *metrics.Metrics
+}
+
+// NewMetricsMiddleware initializes a new MetricsMiddleware
+func NewMetricsMiddleware(m *metrics.Metrics) func(next http.Handler) http.Handler {
+	return MetricsMiddleware{
+		metrics: m,
+	}.perform
+}
+
+// perform is the middleware handler itself
+func (mm MetricsMiddleware) perform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &StatusRecorder{
+			ResponseWriter: w,
+		}
+
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		duration := time.Since(start)
+
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		// The status is only recorded when set explicitly, responses are otherwise 200
+		status := recorder.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		mm.metrics.ObserveRequest(route, r.Method, status, duration)
+	})
+}
+
+// APIKeyHeader carries the API key of the caller, when not given as a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator finds the API key matching the key given by a caller.
+type Authenticator interface {
+	Authenticate(key string) (*domain.APIKey, error)
+}
+
+// apiKeyContextKey keys the authenticated API key in the request context
+type apiKeyContextKey struct{}
+
+// APIKeyFromContext returns the API key authenticated for the request, nil when none was given.
+func APIKeyFromContext(ctx context.Context) *domain.APIKey {
+	apiKey, _ := ctx.Value(apiKeyContextKey{}).(*domain.APIKey)
+	return apiKey
+}
+
+// AuthMiddleware is a middleware that authenticates the API key of the request
+//
+// Requests without a key go through unauthenticated, the routes requiring a scope reject them.
+// Requests with an unknown key are rejected with a 401 response.
+type AuthMiddleware struct {
+	authenticator Authenticator
+}
+
+// NewAuthMiddleware initializes a new AuthMiddleware
+func NewAuthMiddleware(authenticator Authenticator) func(next http.Handler) http.Handler {
+	return AuthMiddleware{
+		authenticator: authenticator,
+	}.perform
+}
+
+// perform is the middleware handler itself
+func (am AuthMiddleware) perform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := requestAPIKey(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		apiKey, err := am.authenticator.Authenticate(key)
+		if err != nil {
+			if errors.Is(err, dao.ErrUnauthenticated) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				WriteErrorResponse(w, http.StatusUnauthorized, []string{err.Error()})
+			} else {
+				WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, apiKey)))
+	})
+}
+
+// requestAPIKey returns the API key given as a bearer token, or in the APIKeyHeader.
+func requestAPIKey(r *http.Request) string {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get(APIKeyHeader)
+}
+
+// clientSubjectContextKey keys the subject of the verified client certificate in the request context
+type clientSubjectContextKey struct{}
+
+// ClientSubjectFromContext returns the subject of the client certificate verified for the request.
+// It returns false when the client gave no certificate, or the certificates are not verified.
+func ClientSubjectFromContext(ctx context.Context) (pkix.Name, bool) {
+	subject, found := ctx.Value(clientSubjectContextKey{}).(pkix.Name)
+	return subject, found
+}
+
+// ClientCertMiddleware is a middleware that exposes the subject of the verified client certificate in the request context
+type ClientCertMiddleware struct{}
+
+// NewClientCertMiddleware initializes a new ClientCertMiddleware
+func NewClientCertMiddleware() func(next http.Handler) http.Handler {
+	return ClientCertMiddleware{}.perform
+}
+
+// perform is the middleware handler itself
+func (cm ClientCertMiddleware) perform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the chains verified against the client CAs are trusted, not the certificates merely presented
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			subject := r.TLS.VerifiedChains[0][0].Subject
+			r = r.WithContext(context.WithValue(r.Context(), clientSubjectContextKey{}, subject))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,7 +1,14 @@
 package api
 
 import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/dao"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/metrics"
+	"github.com/ildomm/ssccg/persistence"
 	"github.com/ildomm/ssccg/test_helpers"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -66,3 +73,94 @@ func TestLoggingMiddleware(t *testing.T) {
 	assert.Contains(t, logOutput, "202", "log does not contain correct status code")
 	assert.Contains(t, logOutput, "ms", "log does not contain execution time")
 }
+
+// TestAuthMiddleware tests the AuthMiddleware's authentication of the API keys.
+func TestAuthMiddleware(t *testing.T) {
+	apiKey := &domain.APIKey{Name: "terminal", Scopes: []string{domain.ScopeDevicesRead}}
+	authenticator := test_helpers.NewMockAPIKeyDAO()
+	authenticator.On("Authenticate", "valid").Return(apiKey, nil)
+	authenticator.On("Authenticate", "unknown").Return(nil, dao.ErrUnauthenticated)
+	authenticator.On("Authenticate", "failing").Return(nil, errors.New("connection lost"))
+
+	var authenticated *domain.APIKey
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated = APIKeyFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testServer := httptest.NewServer(NewAuthMiddleware(authenticator)(testHandler))
+	defer testServer.Close()
+
+	for _, tc := range []struct {
+		name          string
+		header        string
+		value         string
+		status        int
+		authenticated *domain.APIKey
+	}{
+		{name: "NoKey", status: http.StatusOK},
+		{name: "Bearer", header: "Authorization", value: "Bearer valid", status: http.StatusOK, authenticated: apiKey},
+		{name: "Header", header: APIKeyHeader, value: "valid", status: http.StatusOK, authenticated: apiKey},
+		{name: "Unknown", header: "Authorization", value: "Bearer unknown", status: http.StatusUnauthorized},
+		{name: "Failing", header: APIKeyHeader, value: "failing", status: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			authenticated = nil
+			req, _ := http.NewRequest(http.MethodGet, testServer.URL, nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, tc.authenticated, authenticated)
+		})
+	}
+}
+
+// TestMetricsMiddleware tests the requests are recorded by route template, and the metrics served on /metrics.
+func TestMetricsMiddleware(t *testing.T) {
+	deviceId := uuid.New()
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("GetDevice", deviceId).Return((*domain.Device)(nil), persistence.ErrDeviceNotFound)
+
+	server := NewServer()
+	server.WithDeviceManager(mockDAO)
+	server.WithMetrics(metrics.New())
+	testServer := httptest.NewServer(server.router())
+	defer testServer.Close()
+
+	for _, path := range []string{"/api/v1/health", "/api/v1/devices/" + deviceId.String(), "/api/v1/unknown"} {
+		resp, err := http.Get(testServer.URL + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(testServer.URL + "/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	scraped := string(body)
+	assert.Contains(t, scraped, `ssccg_http_requests_total{method="GET",route="/api/v1/health",status="200"} 1`)
+	assert.Contains(t, scraped, `ssccg_http_requests_total{method="GET",route="/api/v1/devices/{id}",status="404"} 1`)
+	assert.Contains(t, scraped, `ssccg_http_request_duration_seconds_count{method="GET",route="/api/v1/devices/{id}"} 1`)
+	// Raw paths never become labels
+	assert.NotContains(t, scraped, deviceId.String())
+	assert.NotContains(t, scraped, "/api/v1/unknown")
+}
+
+// TestMetricsDisabled tests /metrics is not served without metrics.
+func TestMetricsDisabled(t *testing.T) {
+	testServer := httptest.NewServer(NewServer().router())
+	defer testServer.Close()
+
+	resp, err := http.Get(testServer.URL + "/metrics")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
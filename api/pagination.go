@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/ildomm/ssccg/persistence"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// Kinds of listings a cursor positions in
+const (
+	deviceCursor            = "devices"
+	signedTransactionCursor = "signatures"
+)
+
+var ErrInvalidLimit = fmt.Errorf("limit must be between 1 and %d", MaxListLimit)
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor builds the opaque cursor to the records following position in a listing.
+func encodeCursor(kind string, position int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(kind + ":" + strconv.FormatInt(position, 10)))
+}
+
+// decodeCursor returns the position a cursor of the given listing points after.
+func decodeCursor(kind, cursor string) (int64, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	position, found := strings.CutPrefix(string(decoded), kind+":")
+	if !found {
+		return 0, ErrInvalidCursor
+	}
+
+	after, err := strconv.ParseInt(position, 10, 64)
+	if err != nil || after < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return after, nil
+}
+
+// parsePage reads the limit and cursor query parameters of a listing.
+// The page asks for one record more than the limit, telling whether another page follows.
+func parsePage(kind string, query url.Values) (persistence.Page, error) {
+	page := persistence.Page{Limit: DefaultListLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > MaxListLimit {
+			return page, ErrInvalidLimit
+		}
+		page.Limit = parsed
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(kind, cursor)
+		if err != nil {
+			return page, err
+		}
+		page.After = after
+	}
+
+	page.Limit++
+	return page, nil
+}
+
+// trimPage drops the record read past the page limit, and returns whether there was one.
+func trimPage[T any](records []T, page persistence.Page) ([]T, bool) {
+	if len(records) < page.Limit {
+		return records, false
+	}
+	return records[:page.Limit-1], true
+}
+
+// parseCounter reads a sign counter query parameter, 0 when not given.
+func parseCounter(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	counter, err := strconv.Atoi(value)
+	if err != nil || counter < 1 {
+		return 0, fmt.Errorf("%s must be a positive sign counter", name)
+	}
+	return counter, nil
+}
+
+// parseTime reads an RFC 3339 time query parameter, the zero time when not given.
+func parseTime(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ildomm/ssccg/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := encodeCursor(deviceCursor, 42)
+	after, err := decodeCursor(deviceCursor, cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), after)
+
+	// A cursor is only valid for the listing it was made for
+	_, err = decodeCursor(signedTransactionCursor, cursor)
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	for _, invalid := range []string{"not base64!", encodeCursor(deviceCursor, -1), "ZGV2aWNlczp4"} {
+		_, err = decodeCursor(deviceCursor, invalid)
+		assert.Equal(t, ErrInvalidCursor, err, invalid)
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	page, err := parsePage(deviceCursor, url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, persistence.Page{Limit: DefaultListLimit + 1}, page)
+
+	page, err = parsePage(deviceCursor, url.Values{"limit": {"10"}, "cursor": {encodeCursor(deviceCursor, 7)}})
+	assert.NoError(t, err)
+	assert.Equal(t, persistence.Page{After: 7, Limit: 11}, page)
+
+	for _, limit := range []string{"0", "-1", "1001", "ten"} {
+		_, err = parsePage(deviceCursor, url.Values{"limit": {limit}})
+		assert.Equal(t, ErrInvalidLimit, err, limit)
+	}
+}
+
+func TestTrimPage(t *testing.T) {
+	page := persistence.Page{Limit: 3}
+
+	records, more := trimPage([]int{1, 2, 3}, page)
+	assert.True(t, more)
+	assert.Equal(t, []int{1, 2}, records)
+
+	records, more = trimPage([]int{1, 2}, page)
+	assert.False(t, more)
+	assert.Equal(t, []int{1, 2}, records)
+}
+
+func TestParseTime(t *testing.T) {
+	parsed, err := parseTime(url.Values{}, "from")
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsZero())
+
+	parsed, err = parseTime(url.Values{"from": {"2024-01-02T03:04:05+01:00"}}, "from")
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2024, 1, 2, 2, 4, 5, 0, time.UTC).Equal(parsed))
+
+	_, err = parseTime(url.Values{"from": {"2024-01-02"}}, "from")
+	assert.EqualError(t, err, "from must be an RFC 3339 time")
+}
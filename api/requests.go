@@ -1,12 +1,124 @@
 package api
 
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/google/uuid"
+	"strings"
+)
+
+var ErrAmbiguousData = errors.New("either data or data_base64 must be given, not both")
+var ErrInvalidBase64Data = errors.New("data_base64 must be base64 encoded")
+var ErrDataTooLarge = errors.New("data to sign is too large")
+var ErrInvalidDigestEncoding = errors.New("digest must be hex or base64 encoded")
+
+// DefaultMaxDataSize is the largest data accepted for signing by default, in bytes
+const DefaultMaxDataSize = 1 << 20
+
+// maxJSONOverhead bounds the JSON around the data of a request item, e.g. its field names, in bytes
+const maxJSONOverhead = 4 << 10
+
+// maxJSONBodySize returns the largest JSON request body carrying items data of up to maxDataSize bytes each.
+// Data grows by 4/3 when base64 encoded, text data escaped beyond that is sent raw with application/octet-stream instead.
+func maxJSONBodySize(maxDataSize, items int64) int64 {
+	return items * (int64(base64.StdEncoding.EncodedLen(int(maxDataSize))) + maxJSONOverhead)
+}
+
 // CreateDeviceRequest represents the request body for creating a device.
+// The key parameters are optional, the algorithm defaults are used when not given.
 type CreateDeviceRequest struct {
 	Algorithm string `json:"algorithm"`
 	Label     string `json:"label,omitempty"`
+	RSABits   int    `json:"rsa_bits,omitempty"`
+	Curve     string `json:"curve,omitempty"`
 }
 
+// IdempotencyKeyHeader carries the optional key making a signature request safe to retry.
+// A replayed request is answered with IdempotentReplayedHeader set.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
 // SignTransactionRequest represents the request body for creating a signature.
+// Binary data is given base64 encoded in DataBase64, instead of Data.
 type SignTransactionRequest struct {
-	Data string `json:"data"`
+	Data       string `json:"data"`
+	DataBase64 string `json:"data_base64,omitempty"`
+}
+
+// rawData returns the data to sign, decoded from DataBase64 when given.
+func (r SignTransactionRequest) rawData() ([]byte, error) {
+	if r.DataBase64 == "" {
+		return []byte(r.Data), nil
+	}
+	if r.Data != "" {
+		return nil, ErrAmbiguousData
+	}
+
+	data, err := base64.StdEncoding.DecodeString(r.DataBase64)
+	if err != nil {
+		return nil, ErrInvalidBase64Data
+	}
+	return data, nil
+}
+
+// BatchSignTransactionRequest represents the request body for signing a batch of data items, in order.
+// The mode is atomic or partial, atomic when not given.
+type BatchSignTransactionRequest struct {
+	Mode  string                   `json:"mode,omitempty"`
+	Items []SignTransactionRequest `json:"items"`
+}
+
+// SignDigestRequest represents the request body for signing a digest computed by the client, instead of the data.
+// The digest is hex or base64 encoded, and the hash algorithm is named as in algorithm identifiers, e.g. SHA256.
+type SignDigestRequest struct {
+	Digest        string `json:"digest"`
+	HashAlgorithm string `json:"hash_algorithm"`
+}
+
+// hexDigits are the characters of a hex encoded digest, in either case
+const hexDigits = "0123456789abcdefABCDEF"
+
+// decodedDigest returns the digest to sign, decoded from hex when made of hex digits only, or from base64 otherwise.
+// A base64 encoded digest made of hex digits only is too unlikely to be a concern.
+func (r SignDigestRequest) decodedDigest() ([]byte, error) {
+	if r.Digest != "" && strings.Trim(r.Digest, hexDigits) == "" {
+		digest, err := hex.DecodeString(r.Digest)
+		if err != nil {
+			return nil, ErrInvalidDigestEncoding
+		}
+		return digest, nil
+	}
+
+	digest, err := base64.StdEncoding.DecodeString(r.Digest)
+	if err != nil || len(digest) == 0 {
+		return nil, ErrInvalidDigestEncoding
+	}
+	return digest, nil
+}
+
+// VerifySignatureRequest represents the request body for verifying a signature.
+// Either the transaction ID, or the signed data along with its signature, must be given.
+type VerifySignatureRequest struct {
+	TransactionID string `json:"transaction_id,omitempty"`
+	SignedData    string `json:"signed_data,omitempty"`
+	Signature     string `json:"signature,omitempty"`
+}
+
+// ChangeDeviceStatusRequest represents the request body for moving a device to another lifecycle state.
+type ChangeDeviceStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// CreateAPIKeyRequest represents the request body for creating an API key.
+// The key may be used with every device of its tenant when no device ID is given.
+// The key belongs to the tenant of the caller when no tenant is given.
+type CreateAPIKeyRequest struct {
+	TenantID  string      `json:"tenant_id,omitempty"`
+	Name      string      `json:"name"`
+	Scopes    []string    `json:"scopes"`
+	DeviceIDs []uuid.UUID `json:"device_ids,omitempty"`
 }
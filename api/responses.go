@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/google/uuid"
 	"net/http"
+	"time"
 )
 
 // Response is the generic API response container.
@@ -11,6 +12,13 @@ type Response struct {
 	Data interface{} `json:"data"`
 }
 
+// PageResponse is the API response container for a page of a listing.
+// NextCursor is set when more records follow the page.
+type PageResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
 // ErrorResponse is the generic error API response container.
 type ErrorResponse struct {
 	Errors []string `json:"errors"`
@@ -56,6 +64,24 @@ func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
 	w.Write(bytes) //nolint:all
 }
 
+// WriteAPIPageResponse takes an HTTP status code, a page of a listing and the cursor to the next page
+// and writes those as an HTTP response in a structured format.
+func WriteAPIPageResponse(w http.ResponseWriter, code int, data interface{}, nextCursor string) {
+	w.WriteHeader(code)
+
+	response := PageResponse{
+		Data:       data,
+		NextCursor: nextCursor,
+	}
+
+	bytes, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+	}
+
+	w.Write(bytes) //nolint:all
+}
+
 // HealthResponse represents the response for the health check.
 type HealthResponse struct {
 	Status  string `json:"status"`
@@ -64,10 +90,17 @@ type HealthResponse struct {
 
 // DeviceResponse represents the response for a device model.
 type DeviceResponse struct {
-	ID            uuid.UUID `db:"ID"`
-	Label         string    `db:"label"`
-	SignAlgorithm string    `db:"sign_algorithm"`
-	PublicKey     string    `db:"public_key"`
+	ID               uuid.UUID `db:"ID"`
+	TenantID         string    `db:"tenant_id" json:",omitempty"`
+	Label            string    `db:"label"`
+	SignAlgorithm    string    `db:"sign_algorithm"`
+	RSABits          int       `db:"rsa_bits" json:",omitempty"`
+	Curve            string    `db:"curve" json:",omitempty"`
+	PublicKey        string    `db:"public_key"`
+	Status           string    `db:"status"`
+	SignedDataFormat int       `db:"signed_data_format"`
+	CreatedAt        time.Time `db:"created_at"`
+	UpdatedAt        time.Time `db:"updated_at"`
 }
 
 // CreateDeviceResponse represents the response for creating a device.
@@ -76,13 +109,113 @@ type CreateDeviceResponse struct {
 }
 
 // SignedTransactionResponse represents the response for a signed transaction.
+// The raw data is base64 encoded, it is the digest signed within the signed data when the hash algorithm is set.
 type SignedTransactionResponse struct {
-	ID         uuid.UUID `json:"ID"`
-	Signature  string    `json:"signature"`
-	SignedData string    `json:"signed_data"`
+	ID            uuid.UUID `json:"ID"`
+	RawData       []byte    `json:"raw_data"`
+	Signature     string    `json:"signature"`
+	SignedData    string    `json:"signed_data"`
+	FormatVersion int       `json:"format_version"`
+	HashAlgorithm string    `json:"hash_algorithm,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SignedTransactionDetailResponse represents the full content of a signed transaction.
+// The raw data is base64 encoded, it is the digest signed within the signed data when the hash algorithm is set.
+type SignedTransactionDetailResponse struct {
+	ID                uuid.UUID `json:"ID"`
+	DeviceID          uuid.UUID `json:"device_id"`
+	SignCounter       int       `json:"sign_counter"`
+	RawData           []byte    `json:"raw_data"`
+	PreviousSignature string    `json:"previous_signature"`
+	Signature         string    `json:"signature"`
+	SignedData        string    `json:"signed_data"`
+	FormatVersion     int       `json:"format_version"`
+	HashAlgorithm     string    `json:"hash_algorithm,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 // CreateSignedTransactionResponse represents the response for a signed transaction.
 type CreateSignedTransactionResponse struct {
 	SignedTransactionResponse
 }
+
+// BatchSignatureResponse represents the outcome of a signing batch, with the result of each item in the batch order.
+type BatchSignatureResponse struct {
+	Mode    string                       `json:"mode"`
+	Signed  int                          `json:"signed"`
+	Failed  int                          `json:"failed"`
+	Results []BatchSignatureItemResponse `json:"results"`
+}
+
+// BatchSignatureItemResponse represents the result of one item of a signing batch, either its signature or its error.
+type BatchSignatureItemResponse struct {
+	Index     int                        `json:"index"`
+	Signature *SignedTransactionResponse `json:"signature,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+}
+
+// SignatureVerificationResponse represents the outcome of a signature verification.
+type SignatureVerificationResponse struct {
+	Valid         bool       `json:"valid"`
+	Reason        string     `json:"reason,omitempty"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	SignCounter   int        `json:"sign_counter,omitempty"`
+}
+
+// ChainAuditIssueResponse represents a defect found in a signature chain.
+type ChainAuditIssueResponse struct {
+	SignCounter   int        `json:"sign_counter"`
+	Kind          string     `json:"kind"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	Detail        string     `json:"detail"`
+}
+
+// ChainAuditResponse represents the outcome of a signature chain audit.
+type ChainAuditResponse struct {
+	DeviceID            uuid.UUID                 `json:"device_id"`
+	Valid               bool                      `json:"valid"`
+	TransactionsChecked int                       `json:"transactions_checked"`
+	FirstInvalidCounter *int                      `json:"first_invalid_counter,omitempty"`
+	Issues              []ChainAuditIssueResponse `json:"issues"`
+}
+
+// DeviceKeyResponse represents a public key of a device, with the sign counters it is valid for.
+type DeviceKeyResponse struct {
+	PublicKey string `json:"public_key"`
+	ValidFrom int    `json:"valid_from"`
+	ValidTo   int    `json:"valid_to,omitempty"`
+}
+
+// KeyRotationResponse represents the outcome of a device key rotation.
+type KeyRotationResponse struct {
+	DeviceID            uuid.UUID                 `json:"device_id"`
+	RetiredKey          DeviceKeyResponse         `json:"retired_key"`
+	CurrentKey          DeviceKeyResponse         `json:"current_key"`
+	RotationTransaction SignedTransactionResponse `json:"rotation_transaction"`
+}
+
+// DeviceStatusChangeResponse represents a lifecycle state change of a device.
+type DeviceStatusChangeResponse struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// APIKeyResponse represents an API key, without the key itself.
+type APIKeyResponse struct {
+	ID        uuid.UUID   `json:"id"`
+	TenantID  string      `json:"tenant_id"`
+	Name      string      `json:"name"`
+	Scopes    []string    `json:"scopes"`
+	DeviceIDs []uuid.UUID `json:"device_ids"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// CreateAPIKeyResponse represents the response for creating an API key.
+// The key is only given in this response, it cannot be retrieved later.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
@@ -1,9 +1,13 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/ildomm/ssccg/dao"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/metrics"
 	"net/http"
 	"time"
 )
@@ -14,12 +18,18 @@ const (
 	DefaultWriteTimeout      = time.Second * 15
 	DefaultReadTimeout       = time.Second * 15
 	DefaultIdleTimeout       = time.Second * 60
+	DefaultShutdownTimeout   = time.Second * 25
 )
 
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
+	httpServer        *http.Server
 	listenAddress     int
 	deviceManager     dao.DeviceDAO
+	apiKeyManager     dao.APIKeyDAO
+	metrics           *metrics.Metrics
+	tlsConfig         *TLSConfig
+	maxDataSize       int64
 	readHeaderTimeout time.Duration
 	writeTimeout      time.Duration
 	readTimeout       time.Duration
@@ -30,30 +40,50 @@ type Server struct {
 func NewServer() *Server {
 
 	return &Server{
+		httpServer:        &http.Server{},
 		listenAddress:     DefaultListenAddress,
 		readHeaderTimeout: DefaultReadHeaderTimeout,
 		writeTimeout:      DefaultWriteTimeout,
 		readTimeout:       DefaultReadTimeout,
 		idleTimeout:       DefaultIdleTimeout,
+		maxDataSize:       DefaultMaxDataSize,
 	}
 }
 
 // Run defines the server and starts it.
+// It returns http.ErrServerClosed once Shutdown is called, without waiting for the requests in flight.
 func (s *Server) Run() error {
 
-	httpServer := &http.Server{
-		Addr: fmt.Sprintf(":%d", s.listenAddress),
+	httpServer := s.httpServer
+	httpServer.Addr = fmt.Sprintf(":%d", s.listenAddress)
 
-		// Good practice to set timeouts to avoid Slow-loris attacks.
-		ReadHeaderTimeout: s.readHeaderTimeout,
-		WriteTimeout:      s.writeTimeout,
-		ReadTimeout:       s.readTimeout,
-		IdleTimeout:       s.idleTimeout,
+	// Good practice to set timeouts to avoid Slow-loris attacks.
+	httpServer.ReadHeaderTimeout = s.readHeaderTimeout
+	httpServer.WriteTimeout = s.writeTimeout
+	httpServer.ReadTimeout = s.readTimeout
+	httpServer.IdleTimeout = s.idleTimeout
 
-		Handler: s.router(),
+	httpServer.Handler = s.router()
+
+	if s.tlsConfig == nil {
+		return httpServer.ListenAndServe()
+	}
+
+	tlsConfig, err := s.tlsConfig.build()
+	if err != nil {
+		return err
 	}
+	httpServer.TLSConfig = tlsConfig
 
-	return httpServer.ListenAndServe()
+	// The certificate is served by the TLS configuration, so it can be reloaded
+	return httpServer.ListenAndServeTLS("", "")
+}
+
+// Shutdown stops accepting requests, and waits for the requests in flight, such as signings, to complete.
+// It returns the context error when the context is done first, the remaining requests are then left running.
+// A server shut down before running does not start.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
 
 // router registers all HandlerFunc and middleware for the existing HTTP routes.
@@ -64,21 +94,80 @@ func (s *Server) router() *mux.Router {
 	// Interceptors
 	r.Use(NewRecoverMiddleware())
 	r.Use(NewLoggingMiddleware())
+	if s.metrics != nil {
+		r.Use(NewMetricsMiddleware(s.metrics))
+	}
+	r.Use(NewClientCertMiddleware())
+	if s.apiKeyManager != nil {
+		r.Use(NewAuthMiddleware(s.apiKeyManager))
+	}
 
 	// Dev note: instead of checking for http.MethodGet inside the handler function,
 	// we can just use r.Methods(http.MethodGet)
 	r.HandleFunc("/api/v1/health", s.HealthHandler)
 
-	dh := NewDeviceHandler(s.deviceManager)
-	r.HandleFunc("/api/v1/devices", dh.ListDeviceFunc).Methods(http.MethodGet)
-	r.HandleFunc("/api/v1/devices/{id}", dh.CreateDeviceFunc).Methods(http.MethodPost)
-	r.HandleFunc("/api/v1/devices/{id}", dh.GetDeviceFunc).Methods(http.MethodGet)
-	r.HandleFunc("/api/v1/devices/{id}/signatures", dh.CreateSignatureFunc).Methods(http.MethodPost)
-	r.HandleFunc("/api/v1/devices/{id}/signatures", dh.ListSignatureFunc).Methods(http.MethodGet)
+	// Metrics are scraped without API key, as the health check
+	if s.metrics != nil {
+		r.Handle("/metrics", s.metrics.Handler()).Methods(http.MethodGet)
+	}
+
+	dh := NewDeviceHandler(s.deviceManager).WithMaxDataSize(s.maxDataSize)
+	r.HandleFunc("/api/v1/devices", s.authorize(domain.ScopeDevicesRead, dh.ListDeviceFunc)).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/devices/{id}", s.authorize(domain.ScopeDevicesCreate, dh.CreateDeviceFunc)).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/devices/{id}", s.authorize(domain.ScopeDevicesRead, dh.GetDeviceFunc)).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/devices/{id}/signatures", s.authorize(domain.ScopeSignaturesCreate, dh.CreateSignatureFunc)).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/devices/{id}/signatures", s.authorize(domain.ScopeSignaturesRead, dh.ListSignatureFunc)).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/devices/{id}/signatures:batch", s.authorize(domain.ScopeSignaturesCreate, dh.CreateSignatureBatchFunc)).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/devices/{id}/signatures:digest", s.authorize(domain.ScopeSignaturesCreate, dh.CreateDigestSignatureFunc)).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/devices/{id}/signatures/verify", s.authorize(domain.ScopeSignaturesRead, dh.VerifySignatureFunc)).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/devices/{id}/signatures/{counter:[0-9]+}", s.authorize(domain.ScopeSignaturesRead, dh.GetSignatureFunc)).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/signatures/{transactionId}", s.authorize(domain.ScopeSignaturesRead, dh.GetSignatureByIDFunc)).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/devices/{id}/audit", s.authorize(domain.ScopeSignaturesRead, dh.AuditFunc)).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/devices/{id}/keys", s.authorize(domain.ScopeDevicesRead, dh.ListDeviceKeyFunc)).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/devices/{id}/keys/rotate", s.authorize(domain.ScopeDevicesManage, dh.RotateDeviceKeyFunc)).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/devices/{id}/status", s.authorize(domain.ScopeDevicesManage, dh.ChangeDeviceStatusFunc)).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/devices/{id}/status/changes", s.authorize(domain.ScopeDevicesRead, dh.ListDeviceStatusChangeFunc)).Methods(http.MethodGet)
+
+	// API keys are managed by admins only, when authentication is enabled
+	if s.apiKeyManager != nil {
+		kh := NewAPIKeyHandler(s.apiKeyManager)
+		r.HandleFunc("/api/v1/api-keys", s.authorize(domain.ScopeAdmin, kh.CreateAPIKeyFunc)).Methods(http.MethodPost)
+		r.HandleFunc("/api/v1/api-keys", s.authorize(domain.ScopeAdmin, kh.ListAPIKeyFunc)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/api-keys/{id}", s.authorize(domain.ScopeAdmin, kh.DeleteAPIKeyFunc)).Methods(http.MethodDelete)
+	}
 
 	return r
 }
 
+// authorize lets the request through when its API key grants the scope, and may be used with the device of the route.
+// Every request is let through when authentication is disabled.
+func (s *Server) authorize(scope string, next http.HandlerFunc) http.HandlerFunc {
+	if s.apiKeyManager == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := APIKeyFromContext(r.Context())
+		if apiKey == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			WriteErrorResponse(w, http.StatusUnauthorized, []string{dao.ErrUnauthenticated.Error()})
+			return
+		}
+		if !apiKey.HasScope(scope) {
+			WriteErrorResponse(w, http.StatusForbidden, []string{"API key does not grant the " + scope + " scope"})
+			return
+		}
+		// Invalid device IDs are left to the handlers to reject
+		// The ID of the admin routes names an API key, the keys granted by admins are checked by the handlers
+		if deviceId, err := uuid.Parse(mux.Vars(r)["id"]); err == nil && scope != domain.ScopeAdmin && !apiKey.AllowsDevice(deviceId) {
+			WriteErrorResponse(w, http.StatusForbidden, []string{"API key may not be used with device " + deviceId.String()})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
 func (s *Server) ListenAddress() int {
 	return s.listenAddress
 }
@@ -91,6 +180,26 @@ func (s *Server) WithDeviceManager(deviceManager dao.DeviceDAO) {
 	s.deviceManager = deviceManager
 }
 
+// WithAPIKeyManager enables the API key authentication, and the admin endpoints managing the keys.
+func (s *Server) WithAPIKeyManager(apiKeyManager dao.APIKeyDAO) {
+	s.apiKeyManager = apiKeyManager
+}
+
+// WithMetrics records the requests, and serves the metrics on /metrics.
+func (s *Server) WithMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
+// WithTLSConfig serves HTTPS instead of HTTP, verifying the client certificates when a client CA bundle is given.
+func (s *Server) WithTLSConfig(tlsConfig TLSConfig) {
+	s.tlsConfig = &tlsConfig
+}
+
+// WithMaxDataSize sets the largest data accepted for signing, in bytes.
+func (s *Server) WithMaxDataSize(maxDataSize int64) {
+	s.maxDataSize = maxDataSize
+}
+
 func (s *Server) WithReadHeaderTimeout(readHeaderTimeout time.Duration) {
 	s.readHeaderTimeout = readHeaderTimeout
 }
@@ -1,11 +1,21 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/test_helpers"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // TestNewServer tests the NewServer factory function.
@@ -35,6 +45,18 @@ func TestServerConfigurationSetters(t *testing.T) {
 
 	server.WithIdleTimeout(time.Second * 20)
 	assert.Equal(t, time.Second*20, server.idleTimeout)
+
+	server.WithTLSConfig(TLSConfig{CertFile: "server.pem", KeyFile: "server.key"})
+	assert.Equal(t, &TLSConfig{CertFile: "server.pem", KeyFile: "server.key"}, server.tlsConfig)
+}
+
+// TestServerRunTLSError tests the server does not start with a broken TLS configuration.
+func TestServerRunTLSError(t *testing.T) {
+	server := NewServer()
+	server.WithListenAddress(0)
+	server.WithTLSConfig(TLSConfig{CertFile: "missing.pem", KeyFile: "missing.key"})
+
+	assert.Error(t, server.Run())
 }
 
 // TestServerRun tests the Run method of the server.
@@ -53,3 +75,120 @@ func TestServerRun(t *testing.T) {
 	assert.NoError(t, err, "request to server failed")
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "unexpected status code from health check")
 }
+
+// freePort returns a TCP port no one listens on.
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// TestServerShutdown tests the signings in flight complete on shutdown, while new requests are refused.
+func TestServerShutdown(t *testing.T) {
+	deviceId := uuid.New()
+	started, release := make(chan struct{}), make(chan struct{})
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateSignedTransaction", deviceId, []byte("data")).
+		Run(func(mock.Arguments) {
+			close(started)
+			<-release
+		}).
+		Return(&domain.SignedTransaction{ID: uuid.New(), DeviceID: deviceId, SignCounter: 1}, nil)
+
+	server := NewServer()
+	server.WithListenAddress(freePort(t))
+	server.WithDeviceManager(mockDAO)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run()
+	}()
+
+	url := fmt.Sprintf("http://localhost:%d/api/v1", server.ListenAddress())
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(url + "/health")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	signStatus := make(chan int, 1)
+	go func() {
+		body, _ := json.Marshal(SignTransactionRequest{Data: "data"})
+		resp, err := http.Post(url+"/devices/"+deviceId.String()+"/signatures", "application/json", bytes.NewReader(body))
+		if err != nil {
+			signStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		signStatus <- resp.StatusCode
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- server.Shutdown(context.Background())
+	}()
+	assert.ErrorIs(t, <-runErr, http.ErrServerClosed)
+
+	// New connections are refused, while the signing in flight is waited for
+	_, err := http.Get(url + "/health")
+	assert.Error(t, err)
+	select {
+	case <-shutdownErr:
+		t.Fatal("shutdown did not wait for the signing in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Equal(t, http.StatusCreated, <-signStatus)
+	assert.NoError(t, <-shutdownErr)
+}
+
+// TestServerShutdownTimeout tests the shutdown gives up on the requests in flight once its context is done.
+func TestServerShutdownTimeout(t *testing.T) {
+	deviceId := uuid.New()
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	mockDAO := test_helpers.NewMockDeviceDAO()
+	mockDAO.On("CreateSignedTransaction", deviceId, []byte("data")).
+		Run(func(mock.Arguments) {
+			close(started)
+			<-release
+		}).
+		Return(nil, assert.AnError)
+
+	server := NewServer()
+	server.WithListenAddress(freePort(t))
+	server.WithDeviceManager(mockDAO)
+	go server.Run() //nolint:all
+
+	url := fmt.Sprintf("http://localhost:%d/api/v1/devices/%s/signatures", server.ListenAddress(), deviceId)
+	go func() {
+		body, _ := json.Marshal(SignTransactionRequest{Data: "data"})
+		for {
+			resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+			if err == nil {
+				resp.Body.Close()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, server.Shutdown(ctx), context.DeadlineExceeded)
+}
+
+// TestServerShutdownBeforeRun tests a server shut down before running does not start.
+func TestServerShutdownBeforeRun(t *testing.T) {
+	server := NewServer()
+	server.WithListenAddress(freePort(t))
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	assert.ErrorIs(t, server.Run(), http.ErrServerClosed)
+}
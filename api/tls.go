@@ -0,0 +1,145 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultTLSMinVersion is the oldest TLS version accepted by default
+const DefaultTLSMinVersion = tls.VersionTLS12
+
+var ErrInvalidTLSVersion = errors.New("TLS version must be 1.2 or 1.3")
+var ErrInvalidClientCA = errors.New("client CA bundle holds no PEM certificate")
+
+// TLSConfig configures the server to serve HTTPS.
+// With a client CA bundle, clients must present a certificate issued by one of its CAs, unless ClientCertOptional is set.
+type TLSConfig struct {
+	CertFile           string
+	KeyFile            string
+	ClientCAFile       string
+	ClientCertOptional bool
+	MinVersion         uint16 // Defaults to DefaultTLSMinVersion
+}
+
+// ParseTLSVersion parses a TLS version given as "1.2" or "1.3".
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, ErrInvalidTLSVersion
+	}
+}
+
+// build returns the tls.Config serving the certificate, and verifying the client certificates when a CA bundle is given.
+// The certificate is loaded once here, so a broken configuration fails on startup.
+func (c TLSConfig) build() (*tls.Config, error) {
+	reloader, err := newCertificateReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     c.MinVersion,
+		GetCertificate: reloader.getCertificate,
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = DefaultTLSMinVersion
+	}
+
+	if c.ClientCAFile != "" {
+		bundle, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(bundle) {
+			return nil, ErrInvalidClientCA
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if c.ClientCertOptional {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return config, nil
+}
+
+// certificateReloader serves a certificate from files, loading it again when the files change.
+// Certificates renewed on disk are picked up by the next handshake, without restarting the server.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// modTimes returns the last modification times of the certificate and key files.
+func (cr *certificateReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// reload loads the certificate from the files, it must be called holding the lock, or before sharing the reloader.
+func (cr *certificateReloader) reload() error {
+	certModTime, keyModTime, err := cr.modTimes()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load the TLS certificate: %w", err)
+	}
+
+	cr.certificate = &certificate
+	cr.certModTime = certModTime
+	cr.keyModTime = keyModTime
+	return nil
+}
+
+// getCertificate returns the certificate, loaded again when its files changed since the last load.
+// The previous certificate is kept when the files cannot be loaded, e.g. while the certificate and key are being replaced.
+func (cr *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	certModTime, keyModTime, err := cr.modTimes()
+	if err == nil && (!certModTime.Equal(cr.certModTime) || !keyModTime.Equal(cr.keyModTime)) {
+		if err := cr.reload(); err != nil {
+			// Not retried until the files change again
+			cr.certModTime, cr.keyModTime = certModTime, keyModTime
+			log.Println("Could not reload the TLS certificate, the previous one is kept: ", err)
+		} else {
+			log.Println("TLS certificate reloaded from", cr.certFile)
+		}
+	}
+	return cr.certificate, nil
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate is a certificate along with its key, issued by a test CA or self signed.
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// newTestCertificate issues a certificate for the common name, signed by the parent, or self signed as a CA without parent.
+func newTestCertificate(t *testing.T, commonName string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"SSCCG"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	issuer, issuerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		issuer, issuerKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// keyPair returns the certificate as used by a TLS client.
+func (c *testCertificate) keyPair(t *testing.T) tls.Certificate {
+	keyPair, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	require.NoError(t, err)
+	return keyPair
+}
+
+// writeTestFile writes the content to the file, and sets its modification time.
+func writeTestFile(t *testing.T, path string, content []byte, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// TestParseTLSVersion tests the TLS versions accepted as minimum version.
+func TestParseTLSVersion(t *testing.T) {
+	version, err := ParseTLSVersion("1.2")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), version)
+
+	version, err = ParseTLSVersion("1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = ParseTLSVersion("1.0")
+	assert.Equal(t, ErrInvalidTLSVersion, err)
+}
+
+// TestTLSConfigBuildErrors tests the TLS configurations refused on startup.
+func TestTLSConfigBuildErrors(t *testing.T) {
+	dir := t.TempDir()
+	server := newTestCertificate(t, "localhost", nil)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	writeTestFile(t, certFile, server.certPEM, time.Now())
+	writeTestFile(t, keyFile, server.keyPEM, time.Now())
+	writeTestFile(t, filepath.Join(dir, "empty.pem"), []byte("no certificate"), time.Now())
+
+	_, err := TLSConfig{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: keyFile}.build()
+	assert.Error(t, err)
+	_, err = TLSConfig{CertFile: certFile, KeyFile: certFile}.build()
+	assert.Error(t, err)
+	_, err = TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(dir, "empty.pem")}.build()
+	assert.Equal(t, ErrInvalidClientCA, err)
+
+	config, err := TLSConfig{CertFile: certFile, KeyFile: keyFile}.build()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(DefaultTLSMinVersion), config.MinVersion)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+}
+
+// TestMutualTLS tests the client certificates verification, and the subject exposed to the handlers.
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "SSCCG CA", nil)
+	server := newTestCertificate(t, "localhost", ca)
+	terminal := newTestCertificate(t, "terminal-1", ca)
+	stranger := newTestCertificate(t, "stranger", nil)
+
+	certFile, keyFile, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem")
+	writeTestFile(t, certFile, server.certPEM, time.Now())
+	writeTestFile(t, keyFile, server.keyPEM, time.Now())
+	writeTestFile(t, caFile, ca.certPEM, time.Now())
+
+	start := func(config TLSConfig) (string, func()) {
+		tlsConfig, err := config.build()
+		require.NoError(t, err)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		// Served as Run does, the certificate coming from the TLS configuration
+		httpServer := &http.Server{
+			Handler: NewClientCertMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if subject, found := ClientSubjectFromContext(r.Context()); found {
+					w.Write([]byte(subject.CommonName)) //nolint:all
+				}
+			})),
+			TLSConfig: tlsConfig,
+			ErrorLog:  log.New(io.Discard, "", 0),
+		}
+		go httpServer.ServeTLS(listener, "", "") //nolint:all
+		return "https://" + listener.Addr().String(), func() { httpServer.Close() }
+	}
+	get := func(url string, clientCert *testCertificate) (string, error) {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.certificate)
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if clientCert != nil {
+			tlsConfig.Certificates = []tls.Certificate{clientCert.keyPair(t)}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	t.Run("Required", func(t *testing.T) {
+		url, stop := start(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, MinVersion: tls.VersionTLS13})
+		defer stop()
+
+		subject, err := get(url, terminal)
+		assert.NoError(t, err)
+		assert.Equal(t, "terminal-1", subject)
+
+		_, err = get(url, nil)
+		assert.Error(t, err)
+		_, err = get(url, stranger)
+		assert.Error(t, err)
+	})
+
+	t.Run("Optional", func(t *testing.T) {
+		url, stop := start(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientCertOptional: true})
+		defer stop()
+
+		subject, err := get(url, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, subject)
+
+		subject, err = get(url, terminal)
+		assert.NoError(t, err)
+		assert.Equal(t, "terminal-1", subject)
+	})
+
+	t.Run("NoClientCA", func(t *testing.T) {
+		url, stop := start(TLSConfig{CertFile: certFile, KeyFile: keyFile})
+		defer stop()
+
+		// Certificates are not verified without client CAs, so their subject is not trusted
+		subject, err := get(url, terminal)
+		assert.NoError(t, err)
+		assert.Empty(t, subject)
+	})
+}
+
+// TestCertificateReload tests the certificate is reloaded when its files change.
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCertificate(t, "first", nil)
+	second := newTestCertificate(t, "second", nil)
+
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	modTime := time.Now().Add(-time.Minute)
+	writeTestFile(t, certFile, first.certPEM, modTime)
+	writeTestFile(t, keyFile, first.keyPEM, modTime)
+
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	require.NoError(t, err)
+	served := func() string {
+		certificate, err := reloader.getCertificate(nil)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", served())
+
+	// A certificate not matching its key yet is not served
+	writeTestFile(t, certFile, second.certPEM, modTime.Add(time.Second))
+	assert.Equal(t, "first", served())
+
+	writeTestFile(t, keyFile, second.keyPEM, modTime.Add(time.Second))
+	assert.Equal(t, "second", served())
+}
@@ -1,12 +1,13 @@
 package algorithms
 
 import (
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"fmt"
 )
 
 // ECCKeyPair is a DTO that holds ECC private and public keys.
@@ -31,28 +32,39 @@ func (m ECCMarshaler) Marshal(keyPair ECCKeyPair) ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(keyPair.Public)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	encodedPrivate := pem.EncodeToMemory(&pem.Block{
 		Type:  "PRIVATE_KEY",
 		Bytes: privateKeyBytes,
 	})
 
-	encodedPublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC_KEY",
-		Bytes: publicKeyBytes,
-	})
+	encodedPublic, err := m.MarshalPublic(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	return encodedPublic, encodedPrivate, nil
 }
 
+// MarshalPublic encodes a public key alone, as Marshal does.
+func (m ECCMarshaler) MarshalPublic(publicKey *ecdsa.PublicKey) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC_KEY",
+		Bytes: publicKeyBytes,
+	}), nil
+}
+
 // Unmarshal assembles an ECCKeyPair from an encoded private key.
 func (m ECCMarshaler) Unmarshal(privateKeyBytes []byte) (*ECCKeyPair, error) {
-	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	der, err := decodePEM(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := x509.ParseECPrivateKey(der)
 	if err != nil {
 		return nil, err
 	}
@@ -63,17 +75,58 @@ func (m ECCMarshaler) Unmarshal(privateKeyBytes []byte) (*ECCKeyPair, error) {
 	}, nil
 }
 
+// UnmarshalPublic takes an encoded ECC public key and transforms it into an ecdsa.PublicKey.
+func (m ECCMarshaler) UnmarshalPublic(publicKeyBytes []byte) (*ecdsa.PublicKey, error) {
+	der, err := decodePEM(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	eccPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an ECC key")
+	}
+	return eccPublicKey, nil
+}
+
 // ECCKeysBuilder builds an ECC key pair.
-type ECCKeysBuilder struct{}
+// Unless fixed by WithCurve, the curve is picked by the key parameters.
+type ECCKeysBuilder struct {
+	curve string
+}
 
 func NewECCKeysBuilder() ECCKeysBuilder {
 	return ECCKeysBuilder{}
 }
 
-// Pairs builds a new ECCKeyPair.
-func (g ECCKeysBuilder) Pairs() (*ECCKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+// WithCurve returns a copy of the builder always using the named curve.
+func (g ECCKeysBuilder) WithCurve(curve string) ECCKeysBuilder {
+	g.curve = curve
+	return g
+}
+
+// Parameters applies the default curve and checks the requested one against the policy.
+func (g ECCKeysBuilder) Parameters(requested KeyParameters) (KeyParameters, error) {
+	if g.curve != "" {
+		if requested.Curve != "" && requested.Curve != g.curve {
+			return KeyParameters{}, fmt.Errorf("%w: the algorithm uses curve %s", ErrInvalidKeyParameters, g.curve)
+		}
+		requested.Curve = g.curve
+	}
+	return resolveECCParameters(requested)
+}
+
+// Pairs builds a new ECCKeyPair on the named curve.
+func (g ECCKeysBuilder) Pairs(curveName string) (*ECCKeyPair, error) {
+	curve, err := ellipticCurve(curveName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -85,49 +138,125 @@ func (g ECCKeysBuilder) Pairs() (*ECCKeyPair, error) {
 }
 
 // Keys builds a new ECCKeyPair and returns the public and private keys as byte slices.
-func (g ECCKeysBuilder) Keys() ([]byte, []byte, error) {
-	keypair, err := g.Pairs()
+func (g ECCKeysBuilder) Keys(parameters KeyParameters) ([]byte, []byte, error) {
+	parameters, err := g.Parameters(parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+	keypair, err := g.Pairs(parameters.Curve)
 	if err != nil {
 		return nil, nil, err
 	}
 	engine := NewECCMarshaler()
-	_, privateKeyBytes, err := engine.Marshal(*keypair)
+	publicKeyBytes, privateKeyBytes, err := engine.Marshal(*keypair)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	publicKeyBytes, _ := x509.MarshalPKIXPublicKey(keypair.Public)
 	return privateKeyBytes, publicKeyBytes, nil
 }
 
+// PublicKey returns the encoded public key of an encoded private key.
+func (g ECCKeysBuilder) PublicKey(privateKeyBytes []byte) ([]byte, error) {
+	engine := NewECCMarshaler()
+	keypair, err := engine.Unmarshal(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.MarshalPublic(keypair.Public)
+}
+
 // ECCSigner signs data using an ECC private key.
+// By default, it signs a SHA-256 hash sum.
 type ECCSigner struct {
 	marshaller ECCMarshaler
+	hash       crypto.Hash
 }
 
 // NewECCSigner creates a new ECCSigner.
 func NewECCSigner() ECCSigner {
 	return ECCSigner{
 		marshaller: NewECCMarshaler(),
+		hash:       crypto.SHA256,
 	}
 }
 
+// WithHash returns a copy of the signer using the given hash function.
+func (sg ECCSigner) WithHash(hash crypto.Hash) ECCSigner {
+	sg.hash = hash
+	return sg
+}
+
 // Sign signs data using an ECC private key.
 func (sg ECCSigner) Sign(privateKeyBytes, dataToBeSigned []byte) ([]byte, error) {
-	hash, err := GetHashSum(dataToBeSigned)
+	hash, err := HashSum(sg.hash, dataToBeSigned)
 	if err != nil {
 		return nil, err
 	}
+	return sg.SignDigest(privateKeyBytes, sg.hash, hash)
+}
+
+// SignDigest signs a digest computed beforehand with the given hash function, using an ECC private key.
+func (sg ECCSigner) SignDigest(privateKeyBytes []byte, hash crypto.Hash, digest []byte) ([]byte, error) {
+	if err := checkDigest(hash, digest); err != nil {
+		return nil, err
+	}
 	keyPair, err := sg.marshaller.Unmarshal(privateKeyBytes)
 	if err != nil {
 		return nil, err
 	}
-	signature, err := ecdsa.SignASN1(rand.Reader, keyPair.Private, hash[:])
+	signature, err := ecdsa.SignASN1(rand.Reader, keyPair.Private, digest)
 	if err != nil {
 		return nil, err
 	}
-	if !ecdsa.VerifyASN1(keyPair.Public, hash, signature) {
+	if !ecdsa.VerifyASN1(keyPair.Public, digest, signature) {
 		return nil, errors.New("failed to verify ASN1 signature")
 	}
 	return signature, nil
 }
+
+// ECCVerifier verifies signatures made by an ECCSigner.
+// It must be given the same hash function as the signer.
+type ECCVerifier struct {
+	marshaller ECCMarshaler
+	hash       crypto.Hash
+}
+
+// NewECCVerifier creates a new ECCVerifier.
+func NewECCVerifier() ECCVerifier {
+	return ECCVerifier{
+		marshaller: NewECCMarshaler(),
+		hash:       crypto.SHA256,
+	}
+}
+
+// WithHash returns a copy of the verifier using the given hash function.
+func (v ECCVerifier) WithHash(hash crypto.Hash) ECCVerifier {
+	v.hash = hash
+	return v
+}
+
+// Verify checks a signature of data using an ECC public key.
+func (v ECCVerifier) Verify(publicKeyBytes, signedData, signature []byte) error {
+	hash, err := HashSum(v.hash, signedData)
+	if err != nil {
+		return err
+	}
+	return v.VerifyDigest(publicKeyBytes, v.hash, hash, signature)
+}
+
+// VerifyDigest checks a signature made by SignDigest, using an ECC public key.
+func (v ECCVerifier) VerifyDigest(publicKeyBytes []byte, hash crypto.Hash, digest, signature []byte) error {
+	if err := checkDigest(hash, digest); err != nil {
+		return err
+	}
+	publicKey, err := v.marshaller.UnmarshalPublic(publicKeyBytes)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(publicKey, digest, signature) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package algorithms
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha512"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,7 +43,7 @@ func TestECCMarshaler(t *testing.T) {
 func TestECCKeysBuilder(t *testing.T) {
 	generator := ECCKeysBuilder{}
 
-	keyPair, err := generator.Pairs()
+	keyPair, err := generator.Pairs(DefaultCurve)
 	assert.NoError(t, err, "ECC generator should not produce an error")
 	assert.NotNil(t, keyPair, "ECC key pair should not be nil")
 
@@ -53,7 +55,7 @@ func TestECCKeysBuilder(t *testing.T) {
 func TestECCSignatureGeneration(t *testing.T) {
 	signer := NewECCSigner()
 	generator := NewECCKeysBuilder()
-	keyPair, err := generator.Pairs()
+	keyPair, err := generator.Pairs(DefaultCurve)
 	assert.NoError(t, err)
 
 	marshaler := NewECCMarshaler()
@@ -65,3 +67,67 @@ func TestECCSignatureGeneration(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, signature)
 }
+
+func TestECCSignatureVerification(t *testing.T) {
+	signer := NewECCSigner()
+	verifier := NewECCVerifier()
+	privateKeyBytes, publicKeyBytes, err := NewECCKeysBuilder().Keys(KeyParameters{})
+	assert.NoError(t, err)
+
+	dataToBeSigned := []byte("test data")
+	signature, err := signer.Sign(privateKeyBytes, dataToBeSigned)
+	assert.NoError(t, err)
+
+	assert.NoError(t, verifier.Verify(publicKeyBytes, dataToBeSigned, signature))
+	assert.Equal(t, ErrSignatureMismatch, verifier.Verify(publicKeyBytes, []byte("tampered data"), signature))
+	assert.Equal(t, ErrInvalidPEM, verifier.Verify([]byte("not a key"), dataToBeSigned, signature))
+}
+
+// TestECCKeysBuilderCurves tests that keys are built on the requested curve.
+func TestECCKeysBuilderCurves(t *testing.T) {
+	generator := NewECCKeysBuilder()
+	for _, curve := range AllowedCurves {
+		keyPair, err := generator.Pairs(curve)
+		assert.NoError(t, err)
+		assert.Equal(t, curve, keyPair.Public.Curve.Params().Name)
+	}
+
+	_, err := generator.Pairs("P-224")
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+}
+
+func TestECCSignatureVerificationWithHash(t *testing.T) {
+	signer := NewECCSigner().WithHash(crypto.SHA3_384)
+	verifier := NewECCVerifier().WithHash(crypto.SHA3_384)
+	privateKeyBytes, publicKeyBytes, err := NewECCKeysBuilder().Keys(KeyParameters{})
+	assert.NoError(t, err)
+
+	dataToBeSigned := []byte("test data")
+	signature, err := signer.Sign(privateKeyBytes, dataToBeSigned)
+	assert.NoError(t, err)
+
+	assert.NoError(t, verifier.Verify(publicKeyBytes, dataToBeSigned, signature))
+	assert.Equal(t, ErrSignatureMismatch, NewECCVerifier().Verify(publicKeyBytes, dataToBeSigned, signature))
+}
+
+func TestECCDigestSignature(t *testing.T) {
+	signer := NewECCSigner()
+	verifier := NewECCVerifier()
+	privateKeyBytes, publicKeyBytes, err := NewECCKeysBuilder().Keys(KeyParameters{})
+	assert.NoError(t, err)
+
+	digest := sha512.Sum384([]byte("test data"))
+	signature, err := signer.SignDigest(privateKeyBytes, crypto.SHA384, digest[:])
+	assert.NoError(t, err)
+
+	// The signature is a plain ECDSA signature of the digest
+	publicKey, err := NewECCMarshaler().UnmarshalPublic(publicKeyBytes)
+	assert.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(publicKey, digest[:], signature))
+
+	assert.NoError(t, verifier.VerifyDigest(publicKeyBytes, crypto.SHA384, digest[:], signature))
+	assert.Equal(t, ErrSignatureMismatch, verifier.VerifyDigest(publicKeyBytes, crypto.SHA384, make([]byte, sha512.Size384), signature))
+
+	_, err = signer.SignDigest(privateKeyBytes, crypto.SHA256, digest[:])
+	assert.Equal(t, ErrInvalidDigest, err)
+}
@@ -0,0 +1,203 @@
+package algorithms
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+// Ed25519KeyPair is a DTO that holds Ed25519 private and public keys.
+type Ed25519KeyPair struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// Ed25519Marshaler can encode and decode an Ed25519 key pair.
+type Ed25519Marshaler struct{}
+
+// NewEd25519Marshaler creates a new Ed25519Marshaler.
+func NewEd25519Marshaler() Ed25519Marshaler {
+	return Ed25519Marshaler{}
+}
+
+// Marshal takes an Ed25519KeyPair and encodes it to be written on disk.
+// It returns the public and the private key as a byte slice.
+func (m Ed25519Marshaler) Marshal(keyPair Ed25519KeyPair) ([]byte, []byte, error) {
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(keyPair.Private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedPrivate := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE_KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	encodedPublic, err := m.MarshalPublic(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodedPublic, encodedPrivate, nil
+}
+
+// MarshalPublic encodes a public key alone, as Marshal does.
+func (m Ed25519Marshaler) MarshalPublic(publicKey ed25519.PublicKey) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC_KEY",
+		Bytes: publicKeyBytes,
+	}), nil
+}
+
+// Unmarshal assembles an Ed25519KeyPair from an encoded private key.
+func (m Ed25519Marshaler) Unmarshal(privateKeyBytes []byte) (*Ed25519KeyPair, error) {
+	der, err := decodePEM(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an Ed25519 key")
+	}
+
+	return &Ed25519KeyPair{
+		Private: privateKey,
+		Public:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// UnmarshalPublic takes an encoded Ed25519 public key and transforms it into an ed25519.PublicKey.
+func (m Ed25519Marshaler) UnmarshalPublic(publicKeyBytes []byte) (ed25519.PublicKey, error) {
+	der, err := decodePEM(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an Ed25519 key")
+	}
+	return publicKey, nil
+}
+
+// Ed25519KeysBuilder builds an Ed25519 key pair.
+type Ed25519KeysBuilder struct{}
+
+func NewEd25519KeysBuilder() Ed25519KeysBuilder {
+	return Ed25519KeysBuilder{}
+}
+
+// Parameters rejects any requested parameter, Ed25519 keys have a fixed size.
+func (g Ed25519KeysBuilder) Parameters(requested KeyParameters) (KeyParameters, error) {
+	return resolveNoParameters(requested)
+}
+
+// Pairs builds a new Ed25519KeyPair.
+func (g Ed25519KeysBuilder) Pairs() (*Ed25519KeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519KeyPair{
+		Public:  public,
+		Private: private,
+	}, nil
+}
+
+// Keys builds a new Ed25519KeyPair and returns the public and private keys as byte slices.
+func (g Ed25519KeysBuilder) Keys(parameters KeyParameters) ([]byte, []byte, error) {
+	if _, err := g.Parameters(parameters); err != nil {
+		return nil, nil, err
+	}
+	keypair, err := g.Pairs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	engine := NewEd25519Marshaler()
+	publicKeyBytes, privateKeyBytes, err := engine.Marshal(*keypair)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return privateKeyBytes, publicKeyBytes, nil
+}
+
+// PublicKey returns the encoded public key of an encoded private key.
+func (g Ed25519KeysBuilder) PublicKey(privateKeyBytes []byte) ([]byte, error) {
+	engine := NewEd25519Marshaler()
+	keypair, err := engine.Unmarshal(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.MarshalPublic(keypair.Public)
+}
+
+// Ed25519Signer signs data using an Ed25519 private key.
+// It does not sign digests: Ed25519 hashes the message along with the key, so it cannot be given a hash sum.
+type Ed25519Signer struct {
+	marshaller Ed25519Marshaler
+}
+
+// NewEd25519Signer creates a new Ed25519Signer.
+func NewEd25519Signer() Ed25519Signer {
+	return Ed25519Signer{
+		marshaller: NewEd25519Marshaler(),
+	}
+}
+
+// Sign signs data using an Ed25519 private key.
+// Ed25519 hashes the message itself, so the data is signed as it is.
+func (sg Ed25519Signer) Sign(privateKeyBytes, dataToBeSigned []byte) ([]byte, error) {
+	keyPair, err := sg.marshaller.Unmarshal(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	signature := ed25519.Sign(keyPair.Private, dataToBeSigned)
+	if !ed25519.Verify(keyPair.Public, dataToBeSigned, signature) {
+		return nil, errors.New("failed to verify Ed25519 signature")
+	}
+	return signature, nil
+}
+
+// Ed25519Verifier verifies signatures made by an Ed25519Signer.
+type Ed25519Verifier struct {
+	marshaller Ed25519Marshaler
+}
+
+// NewEd25519Verifier creates a new Ed25519Verifier.
+func NewEd25519Verifier() Ed25519Verifier {
+	return Ed25519Verifier{
+		marshaller: NewEd25519Marshaler(),
+	}
+}
+
+// Verify checks a signature of data using an Ed25519 public key.
+func (v Ed25519Verifier) Verify(publicKeyBytes, signedData, signature []byte) error {
+	publicKey, err := v.marshaller.UnmarshalPublic(publicKeyBytes)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, signedData, signature) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
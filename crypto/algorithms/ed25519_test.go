@@ -0,0 +1,73 @@
+package algorithms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEd25519Marshaler tests both Marshal and Unmarshal functions of Ed25519Marshaler.
+func TestEd25519Marshaler(t *testing.T) {
+	keyPair, err := NewEd25519KeysBuilder().Pairs()
+	assert.NoError(t, err)
+
+	marshaler := NewEd25519Marshaler()
+
+	// Test Marshal
+	encodedPublic, encodedPrivate, err := marshaler.Marshal(*keyPair)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, encodedPublic, "Encoded public key should not be empty")
+	assert.NotEmpty(t, encodedPrivate, "Encoded private key should not be empty")
+
+	// Test Unmarshal
+	decodedKeyPair, err := marshaler.Unmarshal(encodedPrivate)
+	assert.NoError(t, err)
+	assert.Equal(t, keyPair.Private, decodedKeyPair.Private)
+	assert.Equal(t, keyPair.Public, decodedKeyPair.Public)
+
+	decodedPublic, err := marshaler.UnmarshalPublic(encodedPublic)
+	assert.NoError(t, err)
+	assert.Equal(t, keyPair.Public, decodedPublic)
+}
+
+// TestEd25519UnmarshalWrongKeyType tests that keys of other algorithms are refused.
+func TestEd25519UnmarshalWrongKeyType(t *testing.T) {
+	privateKeyBytes, publicKeyBytes, err := NewECCKeysBuilder().Keys(KeyParameters{})
+	assert.NoError(t, err)
+
+	marshaler := NewEd25519Marshaler()
+	_, err = marshaler.Unmarshal(privateKeyBytes)
+	assert.Error(t, err)
+	_, err = marshaler.UnmarshalPublic(publicKeyBytes)
+	assert.Error(t, err)
+}
+
+// TestEd25519KeysBuilder tests the Ed25519KeysBuilder's Pairs function.
+func TestEd25519KeysBuilder(t *testing.T) {
+	generator := Ed25519KeysBuilder{}
+
+	keyPair, err := generator.Pairs()
+	assert.NoError(t, err, "Ed25519 generator should not produce an error")
+	assert.NotNil(t, keyPair.Private, "Ed25519 private key should not be nil")
+	assert.NotNil(t, keyPair.Public, "Ed25519 public key should not be nil")
+}
+
+func TestEd25519SignatureVerification(t *testing.T) {
+	signer := NewEd25519Signer()
+	verifier := NewEd25519Verifier()
+	privateKeyBytes, publicKeyBytes, err := NewEd25519KeysBuilder().Keys(KeyParameters{})
+	assert.NoError(t, err)
+
+	dataToBeSigned := []byte("test data")
+	signature, err := signer.Sign(privateKeyBytes, dataToBeSigned)
+	assert.NoError(t, err)
+	assert.Len(t, signature, 64)
+
+	// Ed25519 signatures are deterministic
+	again, err := signer.Sign(privateKeyBytes, dataToBeSigned)
+	assert.NoError(t, err)
+	assert.Equal(t, signature, again)
+
+	assert.NoError(t, verifier.Verify(publicKeyBytes, dataToBeSigned, signature))
+	assert.Equal(t, ErrSignatureMismatch, verifier.Verify(publicKeyBytes, []byte("tampered data"), signature))
+}
@@ -0,0 +1,78 @@
+package algorithms
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// KeyParameters tunes the key pairs built for an algorithm.
+// Parameters not relevant to an algorithm are left zero.
+type KeyParameters struct {
+	RSABits int
+	Curve   string
+}
+
+var ErrInvalidKeyParameters = errors.New("invalid key parameters")
+
+// Key parameters policy
+// Sizes below 2048 bits, and curves below 256 bits, are not allowed anymore.
+var (
+	AllowedRSABits = []int{2048, 3072, 4096}
+	AllowedCurves  = []string{"P-256", "P-384", "P-521"}
+)
+
+const (
+	DefaultRSABits = 2048
+	DefaultCurve   = "P-384"
+)
+
+// resolveRSAParameters applies the default RSA key size and checks the requested one against the policy.
+func resolveRSAParameters(requested KeyParameters) (KeyParameters, error) {
+	if requested.Curve != "" {
+		return KeyParameters{}, fmt.Errorf("%w: curve does not apply to RSA keys", ErrInvalidKeyParameters)
+	}
+	if requested.RSABits == 0 {
+		requested.RSABits = DefaultRSABits
+	}
+	if !slices.Contains(AllowedRSABits, requested.RSABits) {
+		return KeyParameters{}, fmt.Errorf("%w: RSA key size must be one of %v", ErrInvalidKeyParameters, AllowedRSABits)
+	}
+	return requested, nil
+}
+
+// resolveECCParameters applies the default curve and checks the requested one against the policy.
+func resolveECCParameters(requested KeyParameters) (KeyParameters, error) {
+	if requested.RSABits != 0 {
+		return KeyParameters{}, fmt.Errorf("%w: RSA key size does not apply to ECC keys", ErrInvalidKeyParameters)
+	}
+	if requested.Curve == "" {
+		requested.Curve = DefaultCurve
+	}
+	if !slices.Contains(AllowedCurves, requested.Curve) {
+		return KeyParameters{}, fmt.Errorf("%w: curve must be one of %v", ErrInvalidKeyParameters, AllowedCurves)
+	}
+	return requested, nil
+}
+
+// resolveNoParameters refuses any parameter, for algorithms with a fixed key shape.
+func resolveNoParameters(requested KeyParameters) (KeyParameters, error) {
+	if requested != (KeyParameters{}) {
+		return KeyParameters{}, fmt.Errorf("%w: the algorithm takes no key parameters", ErrInvalidKeyParameters)
+	}
+	return requested, nil
+}
+
+// ellipticCurve returns the curve with the given name.
+func ellipticCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("%w: unknown curve %s", ErrInvalidKeyParameters, name)
+}
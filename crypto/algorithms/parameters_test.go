@@ -0,0 +1,91 @@
+package algorithms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRSAParameters(t *testing.T) {
+	generator := NewRSAKeysBuilder()
+
+	parameters, err := generator.Parameters(KeyParameters{})
+	assert.NoError(t, err)
+	assert.Equal(t, KeyParameters{RSABits: DefaultRSABits}, parameters)
+
+	parameters, err = generator.Parameters(KeyParameters{RSABits: 4096})
+	assert.NoError(t, err)
+	assert.Equal(t, 4096, parameters.RSABits)
+
+	_, err = generator.Parameters(KeyParameters{RSABits: 512})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+
+	_, err = generator.Parameters(KeyParameters{Curve: "P-256"})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+}
+
+func TestECCParameters(t *testing.T) {
+	generator := NewECCKeysBuilder()
+
+	parameters, err := generator.Parameters(KeyParameters{})
+	assert.NoError(t, err)
+	assert.Equal(t, KeyParameters{Curve: DefaultCurve}, parameters)
+
+	parameters, err = generator.Parameters(KeyParameters{Curve: "P-521"})
+	assert.NoError(t, err)
+	assert.Equal(t, "P-521", parameters.Curve)
+
+	_, err = generator.Parameters(KeyParameters{Curve: "secp256k1"})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+
+	_, err = generator.Parameters(KeyParameters{RSABits: 2048})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+}
+
+func TestEd25519Parameters(t *testing.T) {
+	generator := NewEd25519KeysBuilder()
+
+	parameters, err := generator.Parameters(KeyParameters{})
+	assert.NoError(t, err)
+	assert.Equal(t, KeyParameters{}, parameters)
+
+	_, _, err = generator.Keys(KeyParameters{Curve: "P-256"})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+}
+
+func TestECCParametersFixedCurve(t *testing.T) {
+	generator := NewECCKeysBuilder().WithCurve("P-521")
+
+	parameters, err := generator.Parameters(KeyParameters{})
+	assert.NoError(t, err)
+	assert.Equal(t, KeyParameters{Curve: "P-521"}, parameters)
+
+	_, err = generator.Parameters(KeyParameters{Curve: "P-256"})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+}
+
+// TestPublicKeyOfPrivateKey tests that the public key derived from a private key is the one built along with it.
+func TestPublicKeyOfPrivateKey(t *testing.T) {
+	builders := map[string]interface {
+		Keys(parameters KeyParameters) ([]byte, []byte, error)
+		PublicKey(privateKeyBytes []byte) ([]byte, error)
+	}{
+		"RSA":     NewRSAKeysBuilder(),
+		"ECC":     NewECCKeysBuilder(),
+		"Ed25519": NewEd25519KeysBuilder(),
+	}
+
+	for name, builder := range builders {
+		t.Run(name, func(t *testing.T) {
+			privateKeyBytes, publicKeyBytes, err := builder.Keys(KeyParameters{})
+			assert.NoError(t, err)
+
+			derived, err := builder.PublicKey(privateKeyBytes)
+			assert.NoError(t, err)
+			assert.Equal(t, publicKeyBytes, derived)
+
+			_, err = builder.PublicKey([]byte("not a key"))
+			assert.Equal(t, ErrInvalidPEM, err)
+		})
+	}
+}
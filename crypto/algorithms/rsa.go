@@ -26,25 +26,35 @@ func NewRSAMarshaler() RSAMarshaler {
 // It returns the public and the private key as a byte slice.
 func (m *RSAMarshaler) Marshal(keyPair RSAKeyPair) ([]byte, []byte, error) {
 	privateKeyBytes := x509.MarshalPKCS1PrivateKey(keyPair.Private)
-	publicKeyBytes := x509.MarshalPKCS1PublicKey(keyPair.Public)
 
 	encodedPrivate := pem.EncodeToMemory(&pem.Block{
 		Type:  "RSA_PRIVATE_KEY",
 		Bytes: privateKeyBytes,
 	})
 
-	encodePublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PUBLIC_KEY",
-		Bytes: publicKeyBytes,
-	})
+	encodePublic, err := m.MarshalPublic(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	return encodePublic, encodedPrivate, nil
 }
 
+// MarshalPublic encodes an RSA public key alone, as Marshal does.
+func (m *RSAMarshaler) MarshalPublic(publicKey *rsa.PublicKey) ([]byte, error) {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA_PUBLIC_KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(publicKey),
+	}), nil
+}
+
 // Unmarshal takes an encoded RSA private key and transforms it into a rsa.PrivateKey.
 func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
-	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	der, err := decodePEM(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(der)
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +65,15 @@ func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
 	}, nil
 }
 
+// UnmarshalPublic takes an encoded RSA public key and transforms it into a rsa.PublicKey.
+func (m *RSAMarshaler) UnmarshalPublic(publicKeyBytes []byte) (*rsa.PublicKey, error) {
+	der, err := decodePEM(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKCS1PublicKey(der)
+}
+
 // RSAKeysBuilder builds an RSA key pair.
 type RSAKeysBuilder struct{}
 
@@ -62,10 +81,14 @@ func NewRSAKeysBuilder() RSAKeysBuilder {
 	return RSAKeysBuilder{}
 }
 
-// Pairs builds a new RSAKeyPair.
-func (g RSAKeysBuilder) Pairs() (*RSAKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := rsa.GenerateKey(rand.Reader, 512)
+// Parameters applies the default key size and checks the requested one against the policy.
+func (g RSAKeysBuilder) Parameters(requested KeyParameters) (KeyParameters, error) {
+	return resolveRSAParameters(requested)
+}
+
+// Pairs builds a new RSAKeyPair of the given size in bits.
+func (g RSAKeysBuilder) Pairs(bits int) (*RSAKeyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, err
 	}
@@ -77,51 +100,161 @@ func (g RSAKeysBuilder) Pairs() (*RSAKeyPair, error) {
 }
 
 // Keys builds a new RSAKeyPair and returns the public and private key as a byte slice.
-func (g RSAKeysBuilder) Keys() ([]byte, []byte, error) {
-	keypair, err := g.Pairs()
+func (g RSAKeysBuilder) Keys(parameters KeyParameters) ([]byte, []byte, error) {
+	parameters, err := g.Parameters(parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+	keypair, err := g.Pairs(parameters.RSABits)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	engine := NewRSAMarshaler()
-	_, privateKeyBytes, err := engine.Marshal(*keypair)
+	publicKeyBytes, privateKeyBytes, err := engine.Marshal(*keypair)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	publicKeyBytes := x509.MarshalPKCS1PublicKey(keypair.Public)
 	return privateKeyBytes, publicKeyBytes, nil
 }
 
+// PublicKey returns the encoded public key of an encoded private key.
+func (g RSAKeysBuilder) PublicKey(privateKeyBytes []byte) ([]byte, error) {
+	engine := NewRSAMarshaler()
+	keypair, err := engine.Unmarshal(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.MarshalPublic(keypair.Public)
+}
+
+// RSAPadding is the signature scheme used by RSA signers and verifiers.
+type RSAPadding string
+
+const (
+	RSAPaddingPKCS1 RSAPadding = "PKCS1"
+	RSAPaddingPSS   RSAPadding = "PSS"
+)
+
+// rsaPSSOptions salts PSS signatures with as many bytes as the hash sum.
+var rsaPSSOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+
+// rsaSign signs a hash sum with the given padding.
+func rsaSign(privateKey *rsa.PrivateKey, padding RSAPadding, hash crypto.Hash, hashSum []byte) ([]byte, error) {
+	if padding == RSAPaddingPSS {
+		return rsa.SignPSS(rand.Reader, privateKey, hash, hashSum, rsaPSSOptions)
+	}
+	return rsa.SignPKCS1v15(rand.Reader, privateKey, hash, hashSum)
+}
+
+// rsaVerify checks a signature of a hash sum with the given padding.
+func rsaVerify(publicKey *rsa.PublicKey, padding RSAPadding, hash crypto.Hash, hashSum, signature []byte) error {
+	if padding == RSAPaddingPSS {
+		return rsa.VerifyPSS(publicKey, hash, hashSum, signature, rsaPSSOptions)
+	}
+	return rsa.VerifyPKCS1v15(publicKey, hash, hashSum, signature)
+}
+
 // RSASigner signs a message using an RSA private key.
+// By default, it uses PKCS#1 v1.5 padding over a SHA-256 hash sum.
 type RSASigner struct {
 	marshaller RSAMarshaler
+	padding    RSAPadding
+	hash       crypto.Hash
 }
 
 // NewRSASigner creates a new RSASigner.
 func NewRSASigner() RSASigner {
 	return RSASigner{
 		marshaller: NewRSAMarshaler(),
+		padding:    RSAPaddingPKCS1,
+		hash:       crypto.SHA256,
 	}
 }
 
+// WithScheme returns a copy of the signer using the given padding and hash function.
+func (sg RSASigner) WithScheme(padding RSAPadding, hash crypto.Hash) RSASigner {
+	sg.padding = padding
+	sg.hash = hash
+	return sg
+}
+
 // Sign signs data using an RSA private key.
 func (sg RSASigner) Sign(privateKeyBytes, dataToBeSigned []byte) ([]byte, error) {
-	hash, err := GetHashSum(dataToBeSigned)
+	hash, err := HashSum(sg.hash, dataToBeSigned)
 	if err != nil {
 		return nil, err
 	}
+	return sg.SignDigest(privateKeyBytes, sg.hash, hash)
+}
+
+// SignDigest signs a digest computed beforehand with the given hash function, using an RSA private key.
+// The digest is signed as it is, with the padding of the signer.
+func (sg RSASigner) SignDigest(privateKeyBytes []byte, hash crypto.Hash, digest []byte) ([]byte, error) {
+	if err := checkDigest(hash, digest); err != nil {
+		return nil, err
+	}
 	keyPair, err := sg.marshaller.Unmarshal(privateKeyBytes)
 	if err != nil {
 		return nil, err
 	}
-	signature, err := rsa.SignPKCS1v15(rand.Reader, keyPair.Private, crypto.SHA256, hash[:])
+	signature, err := rsaSign(keyPair.Private, sg.padding, hash, digest)
 	if err != nil {
 		return nil, err
 	}
-	err = rsa.VerifyPKCS1v15(keyPair.Public, crypto.SHA256, hash, signature)
+	err = rsaVerify(keyPair.Public, sg.padding, hash, digest, signature)
 	if err != nil {
 		return nil, err
 	}
 	return signature, nil
 }
+
+// RSAVerifier verifies signatures made by an RSASigner.
+// It must be given the same padding and hash function as the signer.
+type RSAVerifier struct {
+	marshaller RSAMarshaler
+	padding    RSAPadding
+	hash       crypto.Hash
+}
+
+// NewRSAVerifier creates a new RSAVerifier.
+func NewRSAVerifier() RSAVerifier {
+	return RSAVerifier{
+		marshaller: NewRSAMarshaler(),
+		padding:    RSAPaddingPKCS1,
+		hash:       crypto.SHA256,
+	}
+}
+
+// WithScheme returns a copy of the verifier using the given padding and hash function.
+func (v RSAVerifier) WithScheme(padding RSAPadding, hash crypto.Hash) RSAVerifier {
+	v.padding = padding
+	v.hash = hash
+	return v
+}
+
+// Verify checks a signature of data using an RSA public key.
+func (v RSAVerifier) Verify(publicKeyBytes, signedData, signature []byte) error {
+	hash, err := HashSum(v.hash, signedData)
+	if err != nil {
+		return err
+	}
+	return v.VerifyDigest(publicKeyBytes, v.hash, hash, signature)
+}
+
+// VerifyDigest checks a signature made by SignDigest, using an RSA public key.
+func (v RSAVerifier) VerifyDigest(publicKeyBytes []byte, hash crypto.Hash, digest, signature []byte) error {
+	if err := checkDigest(hash, digest); err != nil {
+		return err
+	}
+	publicKey, err := v.marshaller.UnmarshalPublic(publicKeyBytes)
+	if err != nil {
+		return err
+	}
+	if err := rsaVerify(publicKey, v.padding, hash, digest, signature); err != nil {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
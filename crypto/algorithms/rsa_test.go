@@ -1,8 +1,11 @@
 package algorithms
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -48,7 +51,7 @@ func TestRSAMarshaler(t *testing.T) {
 func TestRSAKeysBuilder(t *testing.T) {
 	generator := RSAKeysBuilder{}
 
-	keyPair, err := generator.Pairs()
+	keyPair, err := generator.Pairs(DefaultRSABits)
 	assert.NoError(t, err, "RSA generator should not produce an error")
 	assert.NotNil(t, keyPair, "RSA key pair should not be nil")
 
@@ -60,7 +63,7 @@ func TestRSAKeysBuilder(t *testing.T) {
 func TestRSASignatureGeneration(t *testing.T) {
 	signer := NewRSASigner()
 	generator := NewRSAKeysBuilder()
-	keyPair, err := generator.Pairs()
+	keyPair, err := generator.Pairs(DefaultRSABits)
 	assert.NoError(t, err)
 
 	marshaler := NewRSAMarshaler()
@@ -72,3 +75,67 @@ func TestRSASignatureGeneration(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, signature)
 }
+
+func TestRSASignatureVerification(t *testing.T) {
+	signer := NewRSASigner()
+	verifier := NewRSAVerifier()
+	privateKeyBytes, publicKeyBytes, err := NewRSAKeysBuilder().Keys(KeyParameters{})
+	assert.NoError(t, err)
+
+	dataToBeSigned := []byte("test data")
+	signature, err := signer.Sign(privateKeyBytes, dataToBeSigned)
+	assert.NoError(t, err)
+
+	assert.NoError(t, verifier.Verify(publicKeyBytes, dataToBeSigned, signature))
+	assert.Equal(t, ErrSignatureMismatch, verifier.Verify(publicKeyBytes, []byte("tampered data"), signature))
+	assert.Equal(t, ErrInvalidPEM, verifier.Verify([]byte("not a key"), dataToBeSigned, signature))
+}
+
+func TestRSAPSSSignatureVerification(t *testing.T) {
+	signer := NewRSASigner().WithScheme(RSAPaddingPSS, crypto.SHA384)
+	verifier := NewRSAVerifier().WithScheme(RSAPaddingPSS, crypto.SHA384)
+	privateKeyBytes, publicKeyBytes, err := NewRSAKeysBuilder().Keys(KeyParameters{})
+	assert.NoError(t, err)
+
+	dataToBeSigned := []byte("test data")
+	signature, err := signer.Sign(privateKeyBytes, dataToBeSigned)
+	assert.NoError(t, err)
+
+	// PSS signatures are salted
+	again, err := signer.Sign(privateKeyBytes, dataToBeSigned)
+	assert.NoError(t, err)
+	assert.NotEqual(t, signature, again)
+
+	assert.NoError(t, verifier.Verify(publicKeyBytes, dataToBeSigned, signature))
+	assert.NoError(t, verifier.Verify(publicKeyBytes, dataToBeSigned, again))
+	assert.Equal(t, ErrSignatureMismatch, NewRSAVerifier().Verify(publicKeyBytes, dataToBeSigned, signature))
+}
+
+func TestRSADigestSignature(t *testing.T) {
+	signer := NewRSASigner()
+	verifier := NewRSAVerifier()
+	privateKeyBytes, publicKeyBytes, err := NewRSAKeysBuilder().Keys(KeyParameters{})
+	assert.NoError(t, err)
+
+	digest := sha512.Sum512([]byte("test data"))
+	signature, err := signer.SignDigest(privateKeyBytes, crypto.SHA512, digest[:])
+	assert.NoError(t, err)
+
+	// The signature is a plain PKCS#1 v1.5 signature of the digest
+	marshaler := NewRSAMarshaler()
+	publicKey, err := marshaler.UnmarshalPublic(publicKeyBytes)
+	assert.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPKCS1v15(publicKey, crypto.SHA512, digest[:], signature))
+
+	assert.NoError(t, verifier.VerifyDigest(publicKeyBytes, crypto.SHA512, digest[:], signature))
+	assert.Equal(t, ErrSignatureMismatch, verifier.VerifyDigest(publicKeyBytes, crypto.SHA512, make([]byte, sha512.Size), signature))
+
+	// Signing data is signing its SHA-256 digest
+	dataSignature, err := signer.Sign(privateKeyBytes, []byte("test data"))
+	assert.NoError(t, err)
+	dataDigest := sha256.Sum256([]byte("test data"))
+	assert.NoError(t, verifier.VerifyDigest(publicKeyBytes, crypto.SHA256, dataDigest[:], dataSignature))
+
+	_, err = signer.SignDigest(privateKeyBytes, crypto.SHA384, digest[:])
+	assert.Equal(t, ErrInvalidDigest, err)
+}
@@ -1,16 +1,64 @@
 package algorithms
 
 import (
-	"crypto/sha256"
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/pem"
+	"errors"
 	"fmt"
+
+	_ "golang.org/x/crypto/sha3"
 )
 
-// GetHashSum returns the hash sum of the data to be signed.
+var ErrInvalidPEM = errors.New("key is not PEM encoded")
+var ErrSignatureMismatch = errors.New("signature does not match the data")
+var ErrInvalidDigest = errors.New("digest size does not match the hash function")
+
+// Hashes maps the hash names used in algorithm identifiers to their hash functions.
+var Hashes = map[string]crypto.Hash{
+	"SHA256":   crypto.SHA256,
+	"SHA384":   crypto.SHA384,
+	"SHA512":   crypto.SHA512,
+	"SHA3-256": crypto.SHA3_256,
+	"SHA3-384": crypto.SHA3_384,
+	"SHA3-512": crypto.SHA3_512,
+}
+
+// GetHashSum returns the SHA-256 hash sum of the data to be signed.
 func GetHashSum(dataToBeSigned []byte) ([]byte, error) {
-	msgHash := sha256.New()
+	return HashSum(crypto.SHA256, dataToBeSigned)
+}
+
+// HashSum returns the hash sum of the data to be signed, using the given hash function.
+func HashSum(hash crypto.Hash, dataToBeSigned []byte) ([]byte, error) {
+	if !hash.Available() {
+		return nil, fmt.Errorf("failed to get hash sum: hash function %s is not available", hash)
+	}
+	msgHash := hash.New()
 	_, err := msgHash.Write(dataToBeSigned)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get hash sum: %w", err)
 	}
 	return msgHash.Sum(nil), nil
 }
+
+// checkDigest checks that a pre-computed digest has the size of the hash function it was computed with.
+func checkDigest(hash crypto.Hash, digest []byte) error {
+	if !hash.Available() {
+		return fmt.Errorf("hash function %s is not available", hash)
+	}
+	if len(digest) != hash.Size() {
+		return ErrInvalidDigest
+	}
+	return nil
+}
+
+// decodePEM returns the DER bytes of the first PEM block of a key.
+func decodePEM(keyBytes []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	return block.Bytes, nil
+}
@@ -1,38 +1,158 @@
 package crypto
 
 import (
+	"crypto"
 	"errors"
+	"fmt"
 	"github.com/ildomm/ssccg/crypto/algorithms"
+	"slices"
+	"strings"
 )
 
 type keysBuilder interface {
-	Keys() ([]byte, []byte, error)
+	Parameters(requested KeyParameters) (KeyParameters, error)
+	Keys(parameters KeyParameters) ([]byte, []byte, error)
+	PublicKey(privateKeyBytes []byte) ([]byte, error)
 }
 
 type signer interface {
 	Sign(privateKeyBytes, dataToBeSigned []byte) ([]byte, error)
 }
 
+type verifier interface {
+	Verify(publicKeyBytes, signedData, signature []byte) error
+}
+
+// digestSigner is implemented by the signers able to sign a digest computed beforehand.
+type digestSigner interface {
+	SignDigest(privateKeyBytes []byte, hash crypto.Hash, digest []byte) ([]byte, error)
+}
+
+// digestVerifier is implemented by the verifiers of the digestSigner signatures.
+type digestVerifier interface {
+	VerifyDigest(publicKeyBytes []byte, hash crypto.Hash, digest, signature []byte) error
+}
+
 var ErrCryptoEngineNotFound = errors.New("crypto algorithm not found")
+var ErrSignatureMismatch = algorithms.ErrSignatureMismatch
+var ErrInvalidKeyParameters = algorithms.ErrInvalidKeyParameters
+var ErrInvalidDigest = algorithms.ErrInvalidDigest
+var ErrDigestNotSupported = errors.New("crypto algorithm does not sign digests")
+var ErrInvalidDigestHash = fmt.Errorf("digest hash algorithm must be one of %v", DigestHashes)
+
+// DigestHashes are the hash functions digests can be computed with, to be signed as they are.
+var DigestHashes = []string{"SHA256", "SHA384", "SHA512"}
+
+// KeyParameters tunes the key pairs built for an algorithm, e.g. the RSA key size or the ECC curve.
+type KeyParameters = algorithms.KeyParameters
+
+// Key families
+const (
+	FamilyRSA     = "RSA"
+	FamilyECDSA   = "ECDSA"
+	FamilyEd25519 = "ED25519"
+)
+
+// Scheme describes the signature scheme behind an algorithm identifier,
+// for key stores producing signatures outside of the registered signers.
+type Scheme struct {
+	Family  string
+	Padding algorithms.RSAPadding
+	Hash    crypto.Hash
+	// Curve is only set when the identifier fixes it
+	Curve string
+}
 
 var algorithmKeyBuildersRegistry = make(map[string]keysBuilder)
 var algorithmSignersRegistry = make(map[string]signer)
+var algorithmVerifiersRegistry = make(map[string]verifier)
+var algorithmSchemesRegistry = make(map[string]Scheme)
 
 // RegisterAlgorithm registers a new algorithm.
-func RegisterAlgorithm(name string, builder keysBuilder, signer signer) {
+func RegisterAlgorithm(name string, builder keysBuilder, signer signer, verifier verifier) {
 	algorithmKeyBuildersRegistry[name] = builder
 	algorithmSignersRegistry[name] = signer
+	algorithmVerifiersRegistry[name] = verifier
+}
+
+// RegisterScheme registers the signature scheme of an algorithm.
+func RegisterScheme(name string, scheme Scheme) {
+	algorithmSchemesRegistry[name] = scheme
+}
+
+// SchemeOf returns the signature scheme of a registered algorithm.
+func SchemeOf(name string) (Scheme, bool) {
+	scheme, found := algorithmSchemesRegistry[name]
+	return scheme, found
+}
+
+// RSA hash functions, by padding.
+// PKCS#1 v1.5 signatures are only defined for the SHA-2 family.
+var rsaSchemes = map[algorithms.RSAPadding][]string{
+	algorithms.RSAPaddingPKCS1: {"SHA256", "SHA384", "SHA512"},
+	algorithms.RSAPaddingPSS:   {"SHA256", "SHA384", "SHA512", "SHA3-256", "SHA3-384", "SHA3-512"},
+}
+
+// ECDSA hash functions, by curve.
+// Each curve is paired with the hash functions of the same strength.
+var eccSchemes = map[string][]string{
+	"P-256": {"SHA256", "SHA3-256"},
+	"P-384": {"SHA384", "SHA3-384"},
+	"P-521": {"SHA512", "SHA3-512"},
 }
 
 // init registers the cryptography algorithms.
+// Identifiers carry the whole signature scheme, e.g. RSA-PSS-SHA384 or ECDSA-P256-SHA256.
 func init() {
-	RegisterAlgorithm("RSA", algorithms.NewRSAKeysBuilder(), algorithms.NewRSASigner())
-	RegisterAlgorithm("ECDSA", algorithms.NewECCKeysBuilder(), algorithms.NewECCSigner())
+	// Plain identifiers use PKCS#1 v1.5 and SHA-256 for RSA, and SHA-256 on any curve for ECDSA
+	RegisterAlgorithm("RSA", algorithms.NewRSAKeysBuilder(), algorithms.NewRSASigner(), algorithms.NewRSAVerifier())
+	RegisterAlgorithm("ECDSA", algorithms.NewECCKeysBuilder(), algorithms.NewECCSigner(), algorithms.NewECCVerifier())
+	RegisterAlgorithm("ED25519", algorithms.NewEd25519KeysBuilder(), algorithms.NewEd25519Signer(), algorithms.NewEd25519Verifier())
+	RegisterScheme("RSA", Scheme{Family: FamilyRSA, Padding: algorithms.RSAPaddingPKCS1, Hash: crypto.SHA256})
+	RegisterScheme("ECDSA", Scheme{Family: FamilyECDSA, Hash: crypto.SHA256})
+	RegisterScheme("ED25519", Scheme{Family: FamilyEd25519})
+
+	for padding, hashes := range rsaSchemes {
+		for _, hashName := range hashes {
+			hash := algorithms.Hashes[hashName]
+			name := fmt.Sprintf("RSA-%s-%s", padding, hashName)
+			RegisterAlgorithm(
+				name,
+				algorithms.NewRSAKeysBuilder(),
+				algorithms.NewRSASigner().WithScheme(padding, hash),
+				algorithms.NewRSAVerifier().WithScheme(padding, hash),
+			)
+			RegisterScheme(name, Scheme{Family: FamilyRSA, Padding: padding, Hash: hash})
+		}
+	}
+
+	for curve, hashes := range eccSchemes {
+		for _, hashName := range hashes {
+			hash := algorithms.Hashes[hashName]
+			name := fmt.Sprintf("ECDSA-%s-%s", strings.ReplaceAll(curve, "-", ""), hashName)
+			RegisterAlgorithm(
+				name,
+				algorithms.NewECCKeysBuilder().WithCurve(curve),
+				algorithms.NewECCSigner().WithHash(hash),
+				algorithms.NewECCVerifier().WithHash(hash),
+			)
+			RegisterScheme(name, Scheme{Family: FamilyECDSA, Hash: hash, Curve: curve})
+		}
+	}
 }
 
 // IsAlgorithmRegistered checks if a specific algorithm is registered.
 func IsAlgorithmRegistered(name string) bool {
 	_, kbOk := algorithmKeyBuildersRegistry[name]
 	_, sOk := algorithmSignersRegistry[name]
-	return kbOk && sOk
+	_, vOk := algorithmVerifiersRegistry[name]
+	return kbOk && sOk && vOk
+}
+
+// DigestHash returns the hash function of a digest, by the name used in algorithm identifiers.
+func DigestHash(name string) (crypto.Hash, error) {
+	if !slices.Contains(DigestHashes, name) {
+		return 0, ErrInvalidDigestHash
+	}
+	return algorithms.Hashes[name], nil
 }
@@ -15,7 +15,41 @@ func TestAlgorithmRegistration(t *testing.T) {
 		assert.True(t, crypto.IsAlgorithmRegistered("ECDSA"))
 	})
 
+	t.Run("ED25519_Registered", func(t *testing.T) {
+		assert.True(t, crypto.IsAlgorithmRegistered("ED25519"))
+	})
+
+	t.Run("Schemes_Registered", func(t *testing.T) {
+		for _, algorithm := range []string{
+			"RSA-PKCS1-SHA256", "RSA-PKCS1-SHA384", "RSA-PKCS1-SHA512",
+			"RSA-PSS-SHA256", "RSA-PSS-SHA384", "RSA-PSS-SHA512",
+			"RSA-PSS-SHA3-256", "RSA-PSS-SHA3-384", "RSA-PSS-SHA3-512",
+			"ECDSA-P256-SHA256", "ECDSA-P384-SHA384", "ECDSA-P521-SHA512",
+			"ECDSA-P256-SHA3-256", "ECDSA-P384-SHA3-384", "ECDSA-P521-SHA3-512",
+		} {
+			assert.True(t, crypto.IsAlgorithmRegistered(algorithm), algorithm)
+		}
+	})
+
+	t.Run("MismatchedSchemes_NotRegistered", func(t *testing.T) {
+		assert.False(t, crypto.IsAlgorithmRegistered("RSA-PKCS1-SHA3-256"))
+		assert.False(t, crypto.IsAlgorithmRegistered("ECDSA-P256-SHA512"))
+	})
+
 	t.Run("UnregisteredAlgorithm", func(t *testing.T) {
 		assert.False(t, crypto.IsAlgorithmRegistered("NonExistent"))
 	})
 }
+
+func TestDigestHash(t *testing.T) {
+	for _, name := range crypto.DigestHashes {
+		hash, err := crypto.DigestHash(name)
+		assert.NoError(t, err)
+		assert.True(t, hash.Available(), name)
+	}
+
+	for _, name := range []string{"", "MD5", "SHA3-256", "sha256"} {
+		_, err := crypto.DigestHash(name)
+		assert.Equal(t, crypto.ErrInvalidDigestHash, err, name)
+	}
+}
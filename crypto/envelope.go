@@ -0,0 +1,242 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedKeyPrefix marks a private key sealed by a KeyEnvelope, and the version of its format.
+// A sealed key reads "enc:v1:<KEK ID>:<wrapped data key>:<encrypted private key>".
+const sealedKeyPrefix = "enc:v1:"
+
+// KEKSize is the size in bytes of a key encryption key, for AES-256.
+const KEKSize = 32
+
+var ErrInvalidKEK = fmt.Errorf("key encryption key must be %d bytes long", KEKSize)
+var ErrUnknownKEK = errors.New("private key is wrapped by an unknown key encryption key")
+var ErrMalformedSealedKey = errors.New("malformed sealed private key")
+var ErrKeyEnvelopeMissing = errors.New("private key is sealed but no key encryption key is configured")
+
+// KeyEnvelope encrypts private keys at rest with envelope encryption.
+// Each private key is encrypted with its own random data key, and the data key is wrapped
+// with a key encryption key (KEK). Both use AES-256-GCM.
+// Keys are always wrapped with the current KEK, previous KEKs are only kept to open older keys.
+type KeyEnvelope struct {
+	currentKEK string
+	keks       map[string]cipher.AEAD
+}
+
+// NewKeyEnvelope creates a new KeyEnvelope wrapping keys with the given KEK.
+func NewKeyEnvelope(kek []byte) (*KeyEnvelope, error) {
+	envelope := &KeyEnvelope{
+		keks: make(map[string]cipher.AEAD),
+	}
+	id, err := envelope.addKEK(kek)
+	if err != nil {
+		return nil, err
+	}
+	envelope.currentKEK = id
+	return envelope, nil
+}
+
+// WithPreviousKEK adds a KEK that is no longer used to wrap keys, but can still open them.
+func (e *KeyEnvelope) WithPreviousKEK(kek []byte) (*KeyEnvelope, error) {
+	if _, err := e.addKEK(kek); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CurrentKEKID returns the ID of the KEK wrapping new keys.
+func (e *KeyEnvelope) CurrentKEKID() string {
+	return e.currentKEK
+}
+
+// KEKID identifies a KEK without revealing it, by a prefix of its SHA-256 hash sum.
+func KEKID(kek []byte) string {
+	sum := sha256.Sum256(kek)
+	return hex.EncodeToString(sum[:8])
+}
+
+// IsSealed checks if a private key was sealed by a KeyEnvelope.
+func IsSealed(privateKey []byte) bool {
+	return bytes.HasPrefix(privateKey, []byte(sealedKeyPrefix))
+}
+
+// Seal encrypts a private key with a new data key, wrapped with the current KEK.
+func (e *KeyEnvelope) Seal(privateKey []byte) ([]byte, error) {
+	dataKey := make([]byte, KEKSize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	encryptedKey, err := encrypt(dataKey, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return e.wrap(dataKey, encryptedKey)
+}
+
+// Open decrypts a sealed private key.
+// The returned key should be cleared once used.
+func (e *KeyEnvelope) Open(sealed []byte) ([]byte, error) {
+	dataKey, encryptedKey, err := e.unwrap(sealed)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	return decrypt(dataKey, encryptedKey)
+}
+
+// Rewrap wraps the data key of a sealed private key with the current KEK.
+// The private key itself is not encrypted again, and keys not sealed yet are sealed.
+// It returns whether the key changed.
+func (e *KeyEnvelope) Rewrap(privateKey []byte) ([]byte, bool, error) {
+	if !IsSealed(privateKey) {
+		sealed, err := e.Seal(privateKey)
+		return sealed, err == nil, err
+	}
+
+	kekID, _, _, err := splitSealedKey(privateKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if kekID == e.currentKEK {
+		return privateKey, false, nil
+	}
+
+	dataKey, encryptedKey, err := e.unwrap(privateKey)
+	if err != nil {
+		return nil, false, err
+	}
+	defer clear(dataKey)
+
+	rewrapped, err := e.wrap(dataKey, encryptedKey)
+	return rewrapped, err == nil, err
+}
+
+// addKEK registers a KEK by its ID.
+func (e *KeyEnvelope) addKEK(kek []byte) (string, error) {
+	if len(kek) != KEKSize {
+		return "", ErrInvalidKEK
+	}
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return "", err
+	}
+	id := KEKID(kek)
+	e.keks[id] = aead
+	return id, nil
+}
+
+// wrap encrypts the data key with the current KEK and assembles the sealed key.
+// The KEK ID is authenticated along with the wrapped data key.
+func (e *KeyEnvelope) wrap(dataKey, encryptedKey []byte) ([]byte, error) {
+	wrappedKey, err := seal(e.keks[e.currentKEK], dataKey, []byte(e.currentKEK))
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(sealedKeyPrefix + e.currentKEK +
+		":" + base64.StdEncoding.EncodeToString(wrappedKey) +
+		":" + base64.StdEncoding.EncodeToString(encryptedKey)), nil
+}
+
+// unwrap decrypts the data key of a sealed key, and returns it along with the encrypted private key.
+func (e *KeyEnvelope) unwrap(sealed []byte) ([]byte, []byte, error) {
+	kekID, wrappedKey, encryptedKey, err := splitSealedKey(sealed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, found := e.keks[kekID]
+	if !found {
+		return nil, nil, ErrUnknownKEK
+	}
+
+	dataKey, err := open(aead, wrappedKey, []byte(kekID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, encryptedKey, nil
+}
+
+// splitSealedKey returns the KEK ID, the wrapped data key and the encrypted private key of a sealed key.
+func splitSealedKey(sealed []byte) (string, []byte, []byte, error) {
+	if !IsSealed(sealed) {
+		return "", nil, nil, ErrMalformedSealedKey
+	}
+
+	parts := strings.Split(string(sealed[len(sealedKeyPrefix):]), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformedSealedKey
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformedSealedKey
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformedSealedKey
+	}
+	return parts[0], wrappedKey, encryptedKey, nil
+}
+
+// encrypt encrypts plaintext with AES-256-GCM under key.
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, plaintext, nil)
+}
+
+// decrypt decrypts a ciphertext made by encrypt.
+func decrypt(key, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, ciphertext, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, prepended to the ciphertext.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a ciphertext made by seal.
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrMalformedSealedKey
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedSealedKey, err)
+	}
+	return plaintext, nil
+}
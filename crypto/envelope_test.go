@@ -0,0 +1,102 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKEK(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, KEKSize)
+}
+
+func TestNewKeyEnvelopeInvalidKEK(t *testing.T) {
+	_, err := NewKeyEnvelope([]byte("too short"))
+	assert.Equal(t, ErrInvalidKEK, err)
+}
+
+func TestKeyEnvelopeSealAndOpen(t *testing.T) {
+	envelope, err := NewKeyEnvelope(newTestKEK(1))
+	require.NoError(t, err)
+
+	privateKey := []byte("private key")
+	sealed, err := envelope.Seal(privateKey)
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, string(sealed), string(privateKey))
+
+	opened, err := envelope.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKey, opened)
+
+	// Each key gets its own data key
+	again, err := envelope.Seal(privateKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+}
+
+func TestKeyEnvelopeOpenWithAnotherKEK(t *testing.T) {
+	envelope, _ := NewKeyEnvelope(newTestKEK(1))
+	other, _ := NewKeyEnvelope(newTestKEK(2))
+
+	sealed, err := envelope.Seal([]byte("private key"))
+	require.NoError(t, err)
+
+	_, err = other.Open(sealed)
+	assert.Equal(t, ErrUnknownKEK, err)
+}
+
+func TestKeyEnvelopeOpenTampered(t *testing.T) {
+	envelope, _ := NewKeyEnvelope(newTestKEK(1))
+
+	_, err := envelope.Open([]byte("enc:v1:not a sealed key"))
+	assert.ErrorIs(t, err, ErrMalformedSealedKey)
+
+	sealed, err := envelope.Seal([]byte("private key"))
+	require.NoError(t, err)
+	// Point the wrapped data key to another KEK ID, which is authenticated
+	tampered := bytes.Replace(sealed, []byte(envelope.CurrentKEKID()), []byte(KEKID(newTestKEK(2))), 1)
+	withOther, _ := envelope.WithPreviousKEK(newTestKEK(2))
+	_, err = withOther.Open(tampered)
+	assert.ErrorIs(t, err, ErrMalformedSealedKey)
+}
+
+func TestKeyEnvelopeRewrap(t *testing.T) {
+	previous, _ := NewKeyEnvelope(newTestKEK(1))
+	privateKey := []byte("private key")
+	sealed, err := previous.Seal(privateKey)
+	require.NoError(t, err)
+
+	current, _ := NewKeyEnvelope(newTestKEK(2))
+	current, err = current.WithPreviousKEK(newTestKEK(1))
+	require.NoError(t, err)
+
+	rewrapped, changed, err := current.Rewrap(sealed)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, string(rewrapped), current.CurrentKEKID())
+
+	// Only the data key is wrapped again, the encrypted private key is kept
+	assert.Equal(t, sealed[bytes.LastIndexByte(sealed, ':'):], rewrapped[bytes.LastIndexByte(rewrapped, ':'):])
+
+	opened, err := current.Open(rewrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKey, opened)
+
+	// Keys wrapped with the current KEK are left as they are
+	again, changed, err := current.Rewrap(rewrapped)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, rewrapped, again)
+}
+
+func TestKeyEnvelopeRewrapPlaintext(t *testing.T) {
+	envelope, _ := NewKeyEnvelope(newTestKEK(1))
+
+	sealed, changed, err := envelope.Rewrap([]byte("private key"))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, IsSealed(sealed))
+}
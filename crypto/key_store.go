@@ -0,0 +1,46 @@
+package crypto
+
+import (
+	"crypto"
+	"errors"
+	"strings"
+)
+
+var ErrUnknownKeyHandle = errors.New("key handle does not belong to the key store")
+
+// KeyStore holds private keys, and signs with them.
+// Private keys are referenced by handles, so the key material itself never has to leave the store.
+// Handles are prefixed by the name of the store holding the key, e.g. "local:" or "pkcs11:".
+type KeyStore interface {
+	// Generate builds a new key pair, and returns the handle of the private key along with the encoded public key.
+	Generate(algorithm string, parameters KeyParameters) (string, []byte, error)
+
+	// PublicKey returns the encoded public key of the private key referenced by handle.
+	PublicKey(algorithm, handle string) ([]byte, error)
+
+	// Sign signs data with the private key referenced by handle.
+	Sign(algorithm, handle string, dataToBeSigned []byte) ([]byte, error)
+
+	// SignDigest signs a digest computed beforehand with the given hash function, with the private key referenced by handle.
+	SignDigest(algorithm, handle string, hash crypto.Hash, digest []byte) ([]byte, error)
+
+	// Delete destroys the key pair referenced by handle, e.g. a key generated for a device that was never stored.
+	Delete(handle string) error
+
+	// Close releases the resources held by the store.
+	Close()
+}
+
+// keyHandle builds the handle of a key, from the name of its store and its reference within the store.
+func keyHandle(store, reference string) string {
+	return store + ":" + reference
+}
+
+// keyReference returns the reference of a key within a store, from its handle.
+func keyReference(store, handle string) (string, error) {
+	reference, found := strings.CutPrefix(handle, store+":")
+	if !found {
+		return "", ErrUnknownKeyHandle
+	}
+	return reference, nil
+}
@@ -12,11 +12,30 @@ func (kg *KeysBuilder) IsValidAlgorithm(algorithm string) bool {
 	return IsAlgorithmRegistered(algorithm)
 }
 
-// Build builds a new key pair using a specific algorithm.
-func (kg *KeysBuilder) Build(algorithm string) ([]byte, []byte, error) {
+// Parameters validates the requested key parameters against the policy of a specific algorithm.
+// It returns the parameters with the algorithm defaults applied.
+func (kg *KeysBuilder) Parameters(algorithm string, requested KeyParameters) (KeyParameters, error) {
+	if !kg.IsValidAlgorithm(algorithm) {
+		return KeyParameters{}, ErrCryptoEngineNotFound
+	}
+
+	return algorithmKeyBuildersRegistry[algorithm].Parameters(requested)
+}
+
+// Build builds a new key pair using a specific algorithm and key parameters.
+func (kg *KeysBuilder) Build(algorithm string, parameters KeyParameters) ([]byte, []byte, error) {
 	if !kg.IsValidAlgorithm(algorithm) {
 		return nil, nil, ErrCryptoEngineNotFound
 	}
 
-	return algorithmKeyBuildersRegistry[algorithm].Keys()
+	return algorithmKeyBuildersRegistry[algorithm].Keys(parameters)
+}
+
+// PublicKey returns the public key of a private key built by a specific algorithm.
+func (kg *KeysBuilder) PublicKey(algorithm string, privateKeyBytes []byte) ([]byte, error) {
+	if !kg.IsValidAlgorithm(algorithm) {
+		return nil, ErrCryptoEngineNotFound
+	}
+
+	return algorithmKeyBuildersRegistry[algorithm].PublicKey(privateKeyBytes)
 }
@@ -1,13 +1,14 @@
 package crypto
 
 import (
+	"encoding/pem"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
 func TestBuildKeysRSA(t *testing.T) {
 	kg := NewKeysBuilder()
-	privateKeyBytes, publicKeyBytes, err := kg.Build("RSA")
+	privateKeyBytes, publicKeyBytes, err := kg.Build("RSA", KeyParameters{})
 	assert.NoError(t, err)
 	assert.NotNil(t, privateKeyBytes)
 	assert.NotNil(t, publicKeyBytes)
@@ -15,7 +16,7 @@ func TestBuildKeysRSA(t *testing.T) {
 
 func TestBuildKeysECC(t *testing.T) {
 	kg := NewKeysBuilder()
-	privateKeyBytes, publicKeyBytes, err := kg.Build("ECDSA")
+	privateKeyBytes, publicKeyBytes, err := kg.Build("ECDSA", KeyParameters{})
 	assert.NoError(t, err)
 	assert.NotNil(t, privateKeyBytes)
 	assert.NotNil(t, publicKeyBytes)
@@ -23,7 +24,50 @@ func TestBuildKeysECC(t *testing.T) {
 
 func TestBuildKeysInvalid(t *testing.T) {
 	kg := NewKeysBuilder()
-	_, _, err := kg.Build("Invalid")
+	_, _, err := kg.Build("Invalid", KeyParameters{})
 	assert.Error(t, err)
 	assert.Equal(t, ErrCryptoEngineNotFound, err)
 }
+
+func TestBuildKeysPublicKeyIsPEM(t *testing.T) {
+	kg := NewKeysBuilder()
+	for _, algorithm := range []string{"RSA", "ECDSA", "ED25519"} {
+		_, publicKeyBytes, err := kg.Build(algorithm, KeyParameters{})
+		assert.NoError(t, err)
+
+		block, _ := pem.Decode(publicKeyBytes)
+		assert.NotNil(t, block, "%s public key should be PEM encoded", algorithm)
+	}
+}
+
+func TestBuildKeysWithParameters(t *testing.T) {
+	kg := NewKeysBuilder()
+	_, _, err := kg.Build("ECDSA", KeyParameters{Curve: "P-256"})
+	assert.NoError(t, err)
+
+	_, _, err = kg.Build("RSA", KeyParameters{RSABits: 1024})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+}
+
+func TestBuildKeysCurveFixedByAlgorithm(t *testing.T) {
+	kg := NewKeysBuilder()
+	parameters, err := kg.Parameters("ECDSA-P256-SHA256", KeyParameters{})
+	assert.NoError(t, err)
+	assert.Equal(t, KeyParameters{Curve: "P-256"}, parameters)
+
+	_, err = kg.Parameters("ECDSA-P256-SHA256", KeyParameters{Curve: "P-384"})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+}
+
+func TestKeysParameters(t *testing.T) {
+	kg := NewKeysBuilder()
+	parameters, err := kg.Parameters("RSA", KeyParameters{})
+	assert.NoError(t, err)
+	assert.Equal(t, KeyParameters{RSABits: 2048}, parameters)
+
+	_, err = kg.Parameters("ED25519", KeyParameters{RSABits: 2048})
+	assert.ErrorIs(t, err, ErrInvalidKeyParameters)
+
+	_, err = kg.Parameters("Invalid", KeyParameters{})
+	assert.Equal(t, ErrCryptoEngineNotFound, err)
+}
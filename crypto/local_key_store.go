@@ -0,0 +1,121 @@
+package crypto
+
+import "crypto"
+
+// LocalKeyStoreName prefixes the handles of keys held by a LocalKeyStore.
+const LocalKeyStoreName = "local"
+
+// LocalKeyStore is the software KeyStore.
+// The handle carries the encoded private key itself, sealed when an envelope is set,
+// and is stored along with the device.
+type LocalKeyStore struct {
+	keysBuilder *KeysBuilder
+	signer      *Signer
+	envelope    *KeyEnvelope
+}
+
+// NewLocalKeyStore creates a new LocalKeyStore.
+func NewLocalKeyStore() *LocalKeyStore {
+	return &LocalKeyStore{
+		keysBuilder: NewKeysBuilder(),
+		signer:      NewSigner(),
+	}
+}
+
+// WithEnvelope makes the store seal the private keys it generates, and open them to sign.
+func (ks *LocalKeyStore) WithEnvelope(envelope *KeyEnvelope) *LocalKeyStore {
+	ks.envelope = envelope
+	ks.signer.WithEnvelope(envelope)
+	return ks
+}
+
+func (ks *LocalKeyStore) Close() {
+	// Nothing to do here for the software key store
+}
+
+// Generate builds a new key pair.
+// Only the sealed private key leaves the memory, when an envelope is set.
+func (ks *LocalKeyStore) Generate(algorithm string, parameters KeyParameters) (string, []byte, error) {
+	privateKey, publicKey, err := ks.keysBuilder.Build(algorithm, parameters)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if ks.envelope != nil {
+		sealed, err := ks.envelope.Seal(privateKey)
+		clear(privateKey)
+		if err != nil {
+			return "", nil, err
+		}
+		privateKey = sealed
+	}
+
+	return keyHandle(LocalKeyStoreName, string(privateKey)), publicKey, nil
+}
+
+// PublicKey derives the public key from the private key referenced by handle.
+func (ks *LocalKeyStore) PublicKey(algorithm, handle string) ([]byte, error) {
+	privateKey, err := keyReference(LocalKeyStoreName, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyBytes := []byte(privateKey)
+	if IsSealed(privateKeyBytes) {
+		if ks.envelope == nil {
+			return nil, ErrKeyEnvelopeMissing
+		}
+		if privateKeyBytes, err = ks.envelope.Open(privateKeyBytes); err != nil {
+			return nil, err
+		}
+		defer clear(privateKeyBytes)
+	}
+
+	return ks.keysBuilder.PublicKey(algorithm, privateKeyBytes)
+}
+
+// Sign signs data with the private key referenced by handle.
+func (ks *LocalKeyStore) Sign(algorithm, handle string, dataToBeSigned []byte) ([]byte, error) {
+	privateKey, err := keyReference(LocalKeyStoreName, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	return ks.signer.Sign(algorithm, []byte(privateKey), dataToBeSigned)
+}
+
+// SignDigest signs a digest with the private key referenced by handle.
+func (ks *LocalKeyStore) SignDigest(algorithm, handle string, hash crypto.Hash, digest []byte) ([]byte, error) {
+	privateKey, err := keyReference(LocalKeyStoreName, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	return ks.signer.SignDigest(algorithm, []byte(privateKey), hash, digest)
+}
+
+// Delete checks the handle belongs to the store.
+// The private key lives in the handle only, so it is gone once the handle is dropped.
+func (ks *LocalKeyStore) Delete(handle string) error {
+	_, err := keyReference(LocalKeyStoreName, handle)
+	return err
+}
+
+// Rewrap wraps the private key referenced by handle with the current key encryption key of the envelope.
+// It returns the new handle, and whether it changed.
+func (ks *LocalKeyStore) Rewrap(handle string) (string, bool, error) {
+	if ks.envelope == nil {
+		return "", false, ErrKeyEnvelopeMissing
+	}
+
+	privateKey, err := keyReference(LocalKeyStoreName, handle)
+	if err != nil {
+		return "", false, err
+	}
+
+	rewrapped, changed, err := ks.envelope.Rewrap([]byte(privateKey))
+	if err != nil || !changed {
+		return handle, false, err
+	}
+	return keyHandle(LocalKeyStoreName, string(rewrapped)), true, nil
+}
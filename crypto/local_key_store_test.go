@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalKeyStoreSignatures(t *testing.T) {
+	store := NewLocalKeyStore()
+	data := []byte("test data")
+
+	handle, publicKey, err := store.Generate("ECDSA", KeyParameters{})
+	require.NoError(t, err)
+	assert.Contains(t, handle, LocalKeyStoreName+":")
+
+	derived, err := store.PublicKey("ECDSA", handle)
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, derived)
+
+	signature, err := store.Sign("ECDSA", handle, data)
+	require.NoError(t, err)
+	assert.NoError(t, NewVerifier().Verify("ECDSA", publicKey, data, signature))
+
+	assert.NoError(t, store.Delete(handle))
+}
+
+func TestLocalKeyStoreDigestSignatures(t *testing.T) {
+	envelope, _ := NewKeyEnvelope(newTestKEK(1))
+	store := NewLocalKeyStore().WithEnvelope(envelope)
+	digest := sha256.Sum256([]byte("test data"))
+
+	handle, publicKey, err := store.Generate("ECDSA", KeyParameters{})
+	require.NoError(t, err)
+
+	signature, err := store.SignDigest("ECDSA", handle, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	assert.NoError(t, NewVerifier().VerifyDigest("ECDSA", publicKey, crypto.SHA256, digest[:], signature))
+}
+
+func TestLocalKeyStoreWithEnvelope(t *testing.T) {
+	envelope, _ := NewKeyEnvelope(newTestKEK(1))
+	store := NewLocalKeyStore().WithEnvelope(envelope)
+	data := []byte("test data")
+
+	handle, publicKey, err := store.Generate("ED25519", KeyParameters{})
+	require.NoError(t, err)
+	reference, err := keyReference(LocalKeyStoreName, handle)
+	require.NoError(t, err)
+	assert.True(t, IsSealed([]byte(reference)))
+
+	derived, err := store.PublicKey("ED25519", handle)
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, derived)
+
+	signature, err := store.Sign("ED25519", handle, data)
+	require.NoError(t, err)
+	assert.NoError(t, NewVerifier().Verify("ED25519", publicKey, data, signature))
+
+	// Without the envelope, the key cannot be used
+	_, err = NewLocalKeyStore().Sign("ED25519", handle, data)
+	assert.Equal(t, ErrKeyEnvelopeMissing, err)
+}
+
+func TestLocalKeyStoreRewrap(t *testing.T) {
+	previous, _ := NewKeyEnvelope(newTestKEK(1))
+	handle, publicKey, err := NewLocalKeyStore().WithEnvelope(previous).Generate("ECDSA", KeyParameters{})
+	require.NoError(t, err)
+
+	current, _ := NewKeyEnvelope(newTestKEK(2))
+	current, _ = current.WithPreviousKEK(newTestKEK(1))
+	store := NewLocalKeyStore().WithEnvelope(current)
+
+	rewrapped, changed, err := store.Rewrap(handle)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, rewrapped, current.CurrentKEKID())
+
+	derived, err := store.PublicKey("ECDSA", rewrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, derived)
+
+	_, changed, err = store.Rewrap(rewrapped)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	_, _, err = NewLocalKeyStore().Rewrap(handle)
+	assert.Equal(t, ErrKeyEnvelopeMissing, err)
+}
+
+func TestLocalKeyStoreUnknownHandle(t *testing.T) {
+	store := NewLocalKeyStore()
+
+	_, err := store.Sign("ECDSA", "pkcs11:00ff", []byte("test data"))
+	assert.Equal(t, ErrUnknownKeyHandle, err)
+
+	_, err = store.PublicKey("ECDSA", "private key")
+	assert.Equal(t, ErrUnknownKeyHandle, err)
+
+	assert.Equal(t, ErrUnknownKeyHandle, store.Delete("pkcs11:00ff"))
+}
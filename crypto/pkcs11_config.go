@@ -0,0 +1,20 @@
+package crypto
+
+import "errors"
+
+// PKCS11KeyStoreName prefixes the handles of keys held by a PKCS11KeyStore.
+const PKCS11KeyStoreName = "pkcs11"
+
+var ErrPKCS11NotSupported = errors.New("PKCS#11 support is not built in, build with the pkcs11 tag")
+var ErrPKCS11TokenNotFound = errors.New("PKCS#11 token not found")
+var ErrPKCS11KeyNotFound = errors.New("PKCS#11 key not found")
+
+// PKCS11Config locates the token holding the keys of a PKCS11KeyStore.
+type PKCS11Config struct {
+	// ModulePath is the path of the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	ModulePath string
+	// TokenLabel is the label of the token, within the slots of the module
+	TokenLabel string
+	// PIN is the user PIN of the token
+	PIN string
+}
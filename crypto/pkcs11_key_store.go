@@ -0,0 +1,491 @@
+//go:build pkcs11
+
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ildomm/ssccg/crypto/algorithms"
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS#11 v3.0 constants, not defined by the pkcs11 package
+const (
+	ckmECEdwardsKeyPairGen = 0x00001055
+	ckmEdDSA               = 0x00001057
+	ckgMGF1SHA3_256        = 0x00000006
+	ckgMGF1SHA3_384        = 0x00000007
+	ckgMGF1SHA3_512        = 0x00000008
+)
+
+// pkcs11Curves maps the curve names of the key parameters to their object identifiers.
+var pkcs11Curves = map[string]struct {
+	oid   asn1.ObjectIdentifier
+	curve elliptic.Curve
+}{
+	"P-256": {asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}, elliptic.P256()},
+	"P-384": {asn1.ObjectIdentifier{1, 3, 132, 0, 34}, elliptic.P384()},
+	"P-521": {asn1.ObjectIdentifier{1, 3, 132, 0, 35}, elliptic.P521()},
+}
+
+var ed25519OID = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// pkcs11Hashes maps the hash functions of the schemes to their mechanisms.
+// PKCS#1 v1.5 signatures hash within the token, PSS signatures are given the hash sum.
+var pkcs11Hashes = map[crypto.Hash]struct {
+	digest  uint
+	mgf     uint
+	rsaPKCS uint
+}{
+	crypto.SHA256:   {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, pkcs11.CKM_SHA256_RSA_PKCS},
+	crypto.SHA384:   {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384, pkcs11.CKM_SHA384_RSA_PKCS},
+	crypto.SHA512:   {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512, pkcs11.CKM_SHA512_RSA_PKCS},
+	crypto.SHA3_256: {pkcs11.CKM_SHA3_256, ckgMGF1SHA3_256, 0},
+	crypto.SHA3_384: {pkcs11.CKM_SHA3_384, ckgMGF1SHA3_384, 0},
+	crypto.SHA3_512: {pkcs11.CKM_SHA3_512, ckgMGF1SHA3_512, 0},
+}
+
+// pkcs1DigestInfoPrefixes are the DER encoded DigestInfo headers preceding a digest in PKCS#1 v1.5 signatures.
+var pkcs1DigestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// ecdsaSignature is the ASN.1 form of ECDSA signatures, made by the software signers.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// PKCS11KeyStore keeps private keys in a PKCS#11 token, e.g. an HSM.
+// Keys are generated within the token as sensitive and not extractable, so they never leave it.
+// The handle carries the CKA_ID of the key pair.
+type PKCS11KeyStore struct {
+	ctx         *pkcs11.Ctx
+	slot        uint
+	session     pkcs11.SessionHandle
+	keysBuilder *KeysBuilder
+}
+
+// NewPKCS11KeyStore loads the PKCS#11 module and logs in the token.
+func NewPKCS11KeyStore(config PKCS11Config) (*PKCS11KeyStore, error) {
+	ctx := pkcs11.New(config.ModulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("could not load PKCS#11 module %s", config.ModulePath)
+	}
+	if err := ctx.Initialize(); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	ks := &PKCS11KeyStore{
+		ctx:         ctx,
+		keysBuilder: NewKeysBuilder(),
+	}
+	if err := ks.login(config); err != nil {
+		ctx.Finalize() //nolint:all
+		ctx.Destroy()
+		return nil, err
+	}
+	return ks, nil
+}
+
+// login opens the session kept for the lifetime of the store.
+// The login state is shared by all the sessions opened on the token afterwards.
+func (ks *PKCS11KeyStore) login(config PKCS11Config) error {
+	slots, err := ks.ctx.GetSlotList(true)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, slot := range slots {
+		info, err := ks.ctx.GetTokenInfo(slot)
+		if err == nil && strings.TrimSpace(info.Label) == config.TokenLabel {
+			ks.slot, found = slot, true
+			break
+		}
+	}
+	if !found {
+		return ErrPKCS11TokenNotFound
+	}
+
+	if ks.session, err = ks.ctx.OpenSession(ks.slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION); err != nil {
+		return err
+	}
+	if err := ks.ctx.Login(ks.session, pkcs11.CKU_USER, config.PIN); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		ks.ctx.CloseSession(ks.session) //nolint:all
+		return err
+	}
+	return nil
+}
+
+// Close logs out of the token and unloads the module.
+func (ks *PKCS11KeyStore) Close() {
+	ks.ctx.Logout(ks.session)       //nolint:all
+	ks.ctx.CloseSession(ks.session) //nolint:all
+	ks.ctx.Finalize()               //nolint:all
+	ks.ctx.Destroy()
+}
+
+// Generate builds a new key pair within the token.
+func (ks *PKCS11KeyStore) Generate(algorithm string, parameters KeyParameters) (string, []byte, error) {
+	scheme, found := SchemeOf(algorithm)
+	if !found {
+		return "", nil, ErrCryptoEngineNotFound
+	}
+	parameters, err := ks.keysBuilder.Parameters(algorithm, parameters)
+	if err != nil {
+		return "", nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	reference := hex.EncodeToString(id)
+
+	publicTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, reference),
+	}
+	privateTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, reference),
+	}
+
+	var mechanism uint
+	switch scheme.Family {
+	case FamilyRSA:
+		mechanism = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
+		publicTemplate = append(publicTemplate,
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, parameters.RSABits),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{0x01, 0x00, 0x01}))
+	case FamilyECDSA:
+		ecParams, err := asn1.Marshal(pkcs11Curves[parameters.Curve].oid)
+		if err != nil {
+			return "", nil, err
+		}
+		mechanism = pkcs11.CKM_EC_KEY_PAIR_GEN
+		publicTemplate = append(publicTemplate, pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, ecParams))
+	case FamilyEd25519:
+		ecParams, err := asn1.Marshal(ed25519OID)
+		if err != nil {
+			return "", nil, err
+		}
+		mechanism = ckmECEdwardsKeyPairGen
+		publicTemplate = append(publicTemplate, pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, ecParams))
+	default:
+		return "", nil, ErrCryptoEngineNotFound
+	}
+
+	err = ks.withSession(func(session pkcs11.SessionHandle) error {
+		_, _, err := ks.ctx.GenerateKeyPair(session,
+			[]*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)},
+			publicTemplate, privateTemplate)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	handle := keyHandle(PKCS11KeyStoreName, reference)
+	publicKey, err := ks.PublicKey(algorithm, handle)
+	if err != nil {
+		return "", nil, err
+	}
+	return handle, publicKey, nil
+}
+
+// PublicKey reads the public key from the token, and encodes it as the software keys builders do.
+func (ks *PKCS11KeyStore) PublicKey(algorithm, handle string) ([]byte, error) {
+	scheme, found := SchemeOf(algorithm)
+	if !found {
+		return nil, ErrCryptoEngineNotFound
+	}
+	id, err := ks.keyID(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes []*pkcs11.Attribute
+	err = ks.withSession(func(session pkcs11.SessionHandle) error {
+		object, err := ks.findObject(session, pkcs11.CKO_PUBLIC_KEY, id)
+		if err != nil {
+			return err
+		}
+
+		template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil), pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil)}
+		if scheme.Family == FamilyRSA {
+			template = []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil), pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil)}
+		}
+		attributes, err = ks.ctx.GetAttributeValue(session, object, template)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch scheme.Family {
+	case FamilyRSA:
+		marshaler := algorithms.NewRSAMarshaler()
+		return marshaler.MarshalPublic(&rsa.PublicKey{
+			N: new(big.Int).SetBytes(attributes[0].Value),
+			E: int(new(big.Int).SetBytes(attributes[1].Value).Int64()),
+		})
+	case FamilyECDSA:
+		publicKey, err := ecdsaPublicKey(attributes[0].Value, ecPoint(attributes[1].Value))
+		if err != nil {
+			return nil, err
+		}
+		return algorithms.NewECCMarshaler().MarshalPublic(publicKey)
+	case FamilyEd25519:
+		point := ecPoint(attributes[1].Value)
+		if len(point) != ed25519.PublicKeySize {
+			return nil, errors.New("unsupported Ed25519 public key encoding")
+		}
+		return algorithms.NewEd25519Marshaler().MarshalPublic(ed25519.PublicKey(point))
+	}
+	return nil, ErrCryptoEngineNotFound
+}
+
+// Sign signs data within the token, with the scheme of the algorithm.
+// Signatures are the same as the ones made by the software signers, so the verifiers are shared.
+func (ks *PKCS11KeyStore) Sign(algorithm, handle string, dataToBeSigned []byte) ([]byte, error) {
+	scheme, found := SchemeOf(algorithm)
+	if !found {
+		return nil, ErrCryptoEngineNotFound
+	}
+
+	message := dataToBeSigned
+	var mechanism *pkcs11.Mechanism
+	var err error
+	switch scheme.Family {
+	case FamilyRSA:
+		hash, found := pkcs11Hashes[scheme.Hash]
+		if !found {
+			return nil, ErrCryptoEngineNotFound
+		}
+		if scheme.Padding == algorithms.RSAPaddingPSS {
+			if message, err = algorithms.HashSum(scheme.Hash, dataToBeSigned); err != nil {
+				return nil, err
+			}
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS,
+				pkcs11.NewPSSParams(hash.digest, hash.mgf, uint(scheme.Hash.Size())))
+		} else {
+			mechanism = pkcs11.NewMechanism(hash.rsaPKCS, nil)
+		}
+	case FamilyECDSA:
+		if message, err = algorithms.HashSum(scheme.Hash, dataToBeSigned); err != nil {
+			return nil, err
+		}
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	case FamilyEd25519:
+		mechanism = pkcs11.NewMechanism(ckmEdDSA, nil)
+	default:
+		return nil, ErrCryptoEngineNotFound
+	}
+
+	return ks.sign(scheme.Family, handle, mechanism, message)
+}
+
+// SignDigest signs a digest within the token, with the padding of the algorithm and the given hash function.
+// PKCS#1 v1.5 signatures are given the DigestInfo of the digest, as the token does not hash it again.
+func (ks *PKCS11KeyStore) SignDigest(algorithm, handle string, hash crypto.Hash, digest []byte) ([]byte, error) {
+	scheme, found := SchemeOf(algorithm)
+	if !found {
+		return nil, ErrCryptoEngineNotFound
+	}
+	if len(digest) != hash.Size() {
+		return nil, ErrInvalidDigest
+	}
+
+	message := digest
+	var mechanism *pkcs11.Mechanism
+	switch scheme.Family {
+	case FamilyRSA:
+		mechanisms, found := pkcs11Hashes[hash]
+		if !found {
+			return nil, ErrInvalidDigestHash
+		}
+		if scheme.Padding == algorithms.RSAPaddingPSS {
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS,
+				pkcs11.NewPSSParams(mechanisms.digest, mechanisms.mgf, uint(hash.Size())))
+		} else {
+			prefix, found := pkcs1DigestInfoPrefixes[hash]
+			if !found {
+				return nil, ErrInvalidDigestHash
+			}
+			message = append(append([]byte{}, prefix...), digest...)
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		}
+	case FamilyECDSA:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	case FamilyEd25519:
+		return nil, ErrDigestNotSupported
+	default:
+		return nil, ErrCryptoEngineNotFound
+	}
+
+	return ks.sign(scheme.Family, handle, mechanism, message)
+}
+
+// sign signs a message within the token, with the private key referenced by handle.
+func (ks *PKCS11KeyStore) sign(family, handle string, mechanism *pkcs11.Mechanism, message []byte) ([]byte, error) {
+	id, err := ks.keyID(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	err = ks.withSession(func(session pkcs11.SessionHandle) error {
+		object, err := ks.findObject(session, pkcs11.CKO_PRIVATE_KEY, id)
+		if err != nil {
+			return err
+		}
+		if err := ks.ctx.SignInit(session, []*pkcs11.Mechanism{mechanism}, object); err != nil {
+			return err
+		}
+		signature, err = ks.ctx.Sign(session, message)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens return the raw r and s values of ECDSA signatures
+	if family == FamilyECDSA {
+		half := len(signature) / 2
+		return asn1.Marshal(ecdsaSignature{
+			R: new(big.Int).SetBytes(signature[:half]),
+			S: new(big.Int).SetBytes(signature[half:]),
+		})
+	}
+	return signature, nil
+}
+
+// Delete destroys the private and public key objects of a key pair in the token.
+func (ks *PKCS11KeyStore) Delete(handle string) error {
+	id, err := ks.keyID(handle)
+	if err != nil {
+		return err
+	}
+
+	return ks.withSession(func(session pkcs11.SessionHandle) error {
+		found := false
+		for _, class := range []uint{pkcs11.CKO_PRIVATE_KEY, pkcs11.CKO_PUBLIC_KEY} {
+			object, err := ks.findObject(session, class, id)
+			if errors.Is(err, ErrPKCS11KeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := ks.ctx.DestroyObject(session, object); err != nil {
+				return err
+			}
+			found = true
+		}
+		if !found {
+			return ErrPKCS11KeyNotFound
+		}
+		return nil
+	})
+}
+
+// keyID returns the CKA_ID of a key pair, from its handle.
+func (ks *PKCS11KeyStore) keyID(handle string) ([]byte, error) {
+	reference, err := keyReference(PKCS11KeyStoreName, handle)
+	if err != nil {
+		return nil, err
+	}
+	id, err := hex.DecodeString(reference)
+	if err != nil {
+		return nil, ErrUnknownKeyHandle
+	}
+	return id, nil
+}
+
+// withSession runs fn in a session of its own, as sessions cannot be used concurrently.
+func (ks *PKCS11KeyStore) withSession(fn func(session pkcs11.SessionHandle) error) error {
+	session, err := ks.ctx.OpenSession(ks.slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return err
+	}
+	defer ks.ctx.CloseSession(session) //nolint:all
+
+	return fn(session)
+}
+
+// findObject returns the key of the given class with the given CKA_ID.
+func (ks *PKCS11KeyStore) findObject(session pkcs11.SessionHandle, class uint, id []byte) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+	if err := ks.ctx.FindObjectsInit(session, template); err != nil {
+		return 0, err
+	}
+	objects, _, err := ks.ctx.FindObjects(session, 1)
+	if finalErr := ks.ctx.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, ErrPKCS11KeyNotFound
+	}
+	return objects[0], nil
+}
+
+// ecPoint returns the point of an EC public key, unwrapping it from the DER octet string most tokens use.
+func ecPoint(value []byte) []byte {
+	var point []byte
+	if rest, err := asn1.Unmarshal(value, &point); err != nil || len(rest) > 0 {
+		return value
+	}
+	return point
+}
+
+// ecdsaPublicKey assembles an ECDSA public key from its curve parameters and its uncompressed point.
+func ecdsaPublicKey(ecParams, point []byte) (*ecdsa.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(ecParams, &oid); err != nil {
+		return nil, err
+	}
+
+	for _, known := range pkcs11Curves {
+		if !known.oid.Equal(oid) {
+			continue
+		}
+		size := (known.curve.Params().BitSize + 7) / 8
+		if len(point) != 1+2*size || point[0] != 0x04 {
+			return nil, errors.New("unsupported EC point encoding")
+		}
+		return &ecdsa.PublicKey{
+			Curve: known.curve,
+			X:     new(big.Int).SetBytes(point[1 : 1+size]),
+			Y:     new(big.Int).SetBytes(point[1+size:]),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported curve %s", oid)
+}
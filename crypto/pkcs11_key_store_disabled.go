@@ -0,0 +1,35 @@
+//go:build !pkcs11
+
+package crypto
+
+import "crypto"
+
+// PKCS11KeyStore is only available when built with the pkcs11 tag.
+type PKCS11KeyStore struct{}
+
+// NewPKCS11KeyStore fails, as PKCS#11 support is not built in.
+func NewPKCS11KeyStore(config PKCS11Config) (*PKCS11KeyStore, error) {
+	return nil, ErrPKCS11NotSupported
+}
+
+func (ks *PKCS11KeyStore) Close() {}
+
+func (ks *PKCS11KeyStore) Generate(algorithm string, parameters KeyParameters) (string, []byte, error) {
+	return "", nil, ErrPKCS11NotSupported
+}
+
+func (ks *PKCS11KeyStore) PublicKey(algorithm, handle string) ([]byte, error) {
+	return nil, ErrPKCS11NotSupported
+}
+
+func (ks *PKCS11KeyStore) Sign(algorithm, handle string, dataToBeSigned []byte) ([]byte, error) {
+	return nil, ErrPKCS11NotSupported
+}
+
+func (ks *PKCS11KeyStore) SignDigest(algorithm, handle string, hash crypto.Hash, digest []byte) ([]byte, error) {
+	return nil, ErrPKCS11NotSupported
+}
+
+func (ks *PKCS11KeyStore) Delete(handle string) error {
+	return ErrPKCS11NotSupported
+}
@@ -0,0 +1,107 @@
+//go:build pkcs11
+
+package crypto
+
+import (
+	"crypto"
+	"crypto/sha512"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// PKCS#11 test token, e.g. a SoftHSM token initialized by `make pkcs11-test`
+const (
+	testPKCS11ModuleEnvVar     = "TEST_PKCS11_MODULE"
+	testPKCS11TokenLabelEnvVar = "TEST_PKCS11_TOKEN_LABEL"
+	testPKCS11PINEnvVar        = "TEST_PKCS11_PIN"
+)
+
+// newTestPKCS11KeyStore logs in the test token, skipping the test when no token is available.
+func newTestPKCS11KeyStore(t *testing.T) *PKCS11KeyStore {
+	module, found := os.LookupEnv(testPKCS11ModuleEnvVar)
+	if !found {
+		t.Skipf("%s not set, skipping PKCS#11 test", testPKCS11ModuleEnvVar)
+	}
+
+	store, err := NewPKCS11KeyStore(PKCS11Config{
+		ModulePath: module,
+		TokenLabel: os.Getenv(testPKCS11TokenLabelEnvVar),
+		PIN:        os.Getenv(testPKCS11PINEnvVar),
+	})
+	require.NoError(t, err)
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestPKCS11KeyStoreSignatures(t *testing.T) {
+	store := newTestPKCS11KeyStore(t)
+	verifier := NewVerifier()
+	data := []byte("test data")
+
+	for _, algorithm := range []string{"RSA", "RSA-PSS-SHA384", "ECDSA", "ECDSA-P256-SHA256", "ED25519"} {
+		t.Run(algorithm, func(t *testing.T) {
+			handle, publicKey, err := store.Generate(algorithm, KeyParameters{})
+			require.NoError(t, err)
+			assert.Contains(t, handle, PKCS11KeyStoreName+":")
+
+			again, err := store.PublicKey(algorithm, handle)
+			assert.NoError(t, err)
+			assert.Equal(t, publicKey, again)
+
+			// Signatures made in the token are checked by the software verifiers
+			signature, err := store.Sign(algorithm, handle, data)
+			require.NoError(t, err)
+			assert.NoError(t, verifier.Verify(algorithm, publicKey, data, signature))
+			assert.Equal(t, ErrSignatureMismatch, verifier.Verify(algorithm, publicKey, []byte("other data"), signature))
+		})
+	}
+}
+
+func TestPKCS11KeyStoreDigestSignatures(t *testing.T) {
+	store := newTestPKCS11KeyStore(t)
+	verifier := NewVerifier()
+	digest := sha512.Sum384([]byte("test data"))
+
+	for _, algorithm := range []string{"RSA", "RSA-PSS-SHA256", "ECDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			handle, publicKey, err := store.Generate(algorithm, KeyParameters{})
+			require.NoError(t, err)
+
+			signature, err := store.SignDigest(algorithm, handle, crypto.SHA384, digest[:])
+			require.NoError(t, err)
+			assert.NoError(t, verifier.VerifyDigest(algorithm, publicKey, crypto.SHA384, digest[:], signature))
+		})
+	}
+
+	handle, _, err := store.Generate("ED25519", KeyParameters{})
+	require.NoError(t, err)
+	_, err = store.SignDigest("ED25519", handle, crypto.SHA384, digest[:])
+	assert.Equal(t, ErrDigestNotSupported, err)
+}
+
+func TestPKCS11KeyStoreDelete(t *testing.T) {
+	store := newTestPKCS11KeyStore(t)
+
+	handle, _, err := store.Generate("ECDSA", KeyParameters{})
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(handle))
+
+	_, err = store.Sign("ECDSA", handle, []byte("test data"))
+	assert.Equal(t, ErrPKCS11KeyNotFound, err)
+	_, err = store.PublicKey("ECDSA", handle)
+	assert.Equal(t, ErrPKCS11KeyNotFound, err)
+	assert.Equal(t, ErrPKCS11KeyNotFound, store.Delete(handle))
+}
+
+func TestPKCS11KeyStoreUnknownHandle(t *testing.T) {
+	store := newTestPKCS11KeyStore(t)
+
+	_, err := store.Sign("ECDSA", "local:key", []byte("test data"))
+	assert.Equal(t, ErrUnknownKeyHandle, err)
+
+	_, err = store.Sign("ECDSA", "pkcs11:00ff", []byte("test data"))
+	assert.Equal(t, ErrPKCS11KeyNotFound, err)
+}
@@ -1,22 +1,76 @@
 package crypto
 
-type Signer struct{}
+import "crypto"
+
+type Signer struct {
+	envelope *KeyEnvelope
+}
 
 // NewSigner creates a new Signer.
 func NewSigner() *Signer {
 	return &Signer{}
 }
 
+// WithEnvelope sets the envelope opening sealed private keys.
+func (sg *Signer) WithEnvelope(envelope *KeyEnvelope) *Signer {
+	sg.envelope = envelope
+	return sg
+}
+
 // IsValidAlgorithm checks if a specific algorithm is registered.
 func (sg *Signer) IsValidAlgorithm(algorithm string) bool {
 	return IsAlgorithmRegistered(algorithm)
 }
 
 // Sign signs a message using a specific algorithm.
+// Sealed private keys are opened in memory only, and cleared once the message is signed.
 func (sg *Signer) Sign(algorithm string, privateKeyBytes, dataToBeSigned []byte) ([]byte, error) {
 	if !sg.IsValidAlgorithm(algorithm) {
 		return nil, ErrCryptoEngineNotFound
 	}
 
+	privateKeyBytes, release, err := sg.open(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	return algorithmSignersRegistry[algorithm].Sign(privateKeyBytes, dataToBeSigned)
 }
+
+// SignDigest signs a digest computed beforehand with the given hash function, using a specific algorithm.
+// The digest is not hashed again, so the signature is the one of the data it was computed from.
+// It returns ErrDigestNotSupported for the algorithms hashing the message themselves, such as Ed25519.
+func (sg *Signer) SignDigest(algorithm string, privateKeyBytes []byte, hash crypto.Hash, digest []byte) ([]byte, error) {
+	if !sg.IsValidAlgorithm(algorithm) {
+		return nil, ErrCryptoEngineNotFound
+	}
+	signer, ok := algorithmSignersRegistry[algorithm].(digestSigner)
+	if !ok {
+		return nil, ErrDigestNotSupported
+	}
+
+	privateKeyBytes, release, err := sg.open(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return signer.SignDigest(privateKeyBytes, hash, digest)
+}
+
+// open returns a private key ready to sign with, opening it when sealed.
+// The returned function clears the opened key, and must be called once signed.
+func (sg *Signer) open(privateKeyBytes []byte) ([]byte, func(), error) {
+	if !IsSealed(privateKeyBytes) {
+		return privateKeyBytes, func() {}, nil
+	}
+	if sg.envelope == nil {
+		return nil, nil, ErrKeyEnvelopeMissing
+	}
+	opened, err := sg.envelope.Open(privateKeyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return opened, func() { clear(opened) }, nil
+}
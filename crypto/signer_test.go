@@ -12,3 +12,21 @@ func TestSignWithInvalidAlgorithm(t *testing.T) {
 	_, err := sg.Sign("Invalid", nil, dataToBeSigned)
 	assert.Equal(t, ErrCryptoEngineNotFound, err)
 }
+
+func TestSignWithSealedKey(t *testing.T) {
+	envelope, err := NewKeyEnvelope(newTestKEK(1))
+	assert.NoError(t, err)
+
+	privateKey, publicKey, err := NewKeysBuilder().Build("ECDSA", KeyParameters{})
+	assert.NoError(t, err)
+	sealed, err := envelope.Seal(privateKey)
+	assert.NoError(t, err)
+
+	dataToBeSigned := []byte("test data")
+	_, err = NewSigner().Sign("ECDSA", sealed, dataToBeSigned)
+	assert.Equal(t, ErrKeyEnvelopeMissing, err)
+
+	signature, err := NewSigner().WithEnvelope(envelope).Sign("ECDSA", sealed, dataToBeSigned)
+	assert.NoError(t, err)
+	assert.NoError(t, NewVerifier().Verify("ECDSA", publicKey, dataToBeSigned, signature))
+}
@@ -0,0 +1,38 @@
+package crypto
+
+import "crypto"
+
+type Verifier struct{}
+
+// NewVerifier creates a new Verifier.
+func NewVerifier() *Verifier {
+	return &Verifier{}
+}
+
+// IsValidAlgorithm checks if a specific algorithm is registered.
+func (vf *Verifier) IsValidAlgorithm(algorithm string) bool {
+	return IsAlgorithmRegistered(algorithm)
+}
+
+// Verify checks a signature of data using a specific algorithm.
+// It returns ErrSignatureMismatch when the signature was not made over data with the matching private key.
+func (vf *Verifier) Verify(algorithm string, publicKeyBytes, signedData, signature []byte) error {
+	if !vf.IsValidAlgorithm(algorithm) {
+		return ErrCryptoEngineNotFound
+	}
+
+	return algorithmVerifiersRegistry[algorithm].Verify(publicKeyBytes, signedData, signature)
+}
+
+// VerifyDigest checks a signature made by Signer.SignDigest, using a specific algorithm.
+func (vf *Verifier) VerifyDigest(algorithm string, publicKeyBytes []byte, hash crypto.Hash, digest, signature []byte) error {
+	if !vf.IsValidAlgorithm(algorithm) {
+		return ErrCryptoEngineNotFound
+	}
+	verifier, ok := algorithmVerifiersRegistry[algorithm].(digestVerifier)
+	if !ok {
+		return ErrDigestNotSupported
+	}
+
+	return verifier.VerifyDigest(publicKeyBytes, hash, digest, signature)
+}
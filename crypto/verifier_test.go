@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyWithInvalidAlgorithm(t *testing.T) {
+	vf := NewVerifier()
+	err := vf.Verify("Invalid", nil, []byte("test data"), nil)
+	assert.Equal(t, ErrCryptoEngineNotFound, err)
+}
+
+func TestVerifySignatures(t *testing.T) {
+	kg := NewKeysBuilder()
+	sg := NewSigner()
+	vf := NewVerifier()
+	data := []byte("test data")
+
+	for _, algorithm := range []string{"RSA", "ECDSA", "ED25519", "RSA-PSS-SHA384", "RSA-PKCS1-SHA512", "ECDSA-P256-SHA256", "ECDSA-P521-SHA3-512"} {
+		t.Run(algorithm, func(t *testing.T) {
+			privateKey, publicKey, err := kg.Build(algorithm, KeyParameters{})
+			assert.NoError(t, err)
+
+			signature, err := sg.Sign(algorithm, privateKey, data)
+			assert.NoError(t, err)
+
+			assert.NoError(t, vf.Verify(algorithm, publicKey, data, signature))
+			assert.Equal(t, ErrSignatureMismatch, vf.Verify(algorithm, publicKey, []byte("other data"), signature))
+
+			// A signature made by another key pair does not verify either
+			_, otherPublicKey, _ := kg.Build(algorithm, KeyParameters{})
+			assert.Equal(t, ErrSignatureMismatch, vf.Verify(algorithm, otherPublicKey, data, signature))
+		})
+	}
+}
+
+func TestVerifyWithAnotherScheme(t *testing.T) {
+	kg := NewKeysBuilder()
+	sg := NewSigner()
+	vf := NewVerifier()
+	data := []byte("test data")
+
+	privateKey, publicKey, err := kg.Build("RSA-PSS-SHA256", KeyParameters{})
+	assert.NoError(t, err)
+	signature, err := sg.Sign("RSA-PSS-SHA256", privateKey, data)
+	assert.NoError(t, err)
+
+	// The same key pair does not verify a signature made with another padding or hash function
+	assert.Equal(t, ErrSignatureMismatch, vf.Verify("RSA-PKCS1-SHA256", publicKey, data, signature))
+	assert.Equal(t, ErrSignatureMismatch, vf.Verify("RSA-PSS-SHA512", publicKey, data, signature))
+}
+
+func TestVerifyDigestSignatures(t *testing.T) {
+	kg := NewKeysBuilder()
+	sg := NewSigner()
+	vf := NewVerifier()
+	digest := sha512.Sum512([]byte("test data"))
+
+	// Any digest hash goes with any scheme, the hash function of the algorithm only applies to signed data
+	for _, algorithm := range []string{"RSA", "ECDSA", "RSA-PSS-SHA256", "ECDSA-P256-SHA256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			privateKey, publicKey, err := kg.Build(algorithm, KeyParameters{})
+			assert.NoError(t, err)
+
+			signature, err := sg.SignDigest(algorithm, privateKey, crypto.SHA512, digest[:])
+			assert.NoError(t, err)
+
+			assert.NoError(t, vf.VerifyDigest(algorithm, publicKey, crypto.SHA512, digest[:], signature))
+			assert.Equal(t, ErrSignatureMismatch, vf.VerifyDigest(algorithm, publicKey, crypto.SHA512, make([]byte, sha512.Size), signature))
+
+			_, err = sg.SignDigest(algorithm, privateKey, crypto.SHA256, digest[:])
+			assert.Equal(t, ErrInvalidDigest, err)
+		})
+	}
+
+	privateKey, publicKey, err := kg.Build("ED25519", KeyParameters{})
+	assert.NoError(t, err)
+	_, err = sg.SignDigest("ED25519", privateKey, crypto.SHA512, digest[:])
+	assert.Equal(t, ErrDigestNotSupported, err)
+	assert.Equal(t, ErrDigestNotSupported, vf.VerifyDigest("ED25519", publicKey, crypto.SHA512, digest[:], nil))
+}
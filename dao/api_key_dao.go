@@ -0,0 +1,13 @@
+package dao
+
+import (
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+)
+
+type APIKeyDAO interface {
+	CreateAPIKey(tenantId, name string, scopes []string, deviceIds []uuid.UUID) (*domain.APIKey, string, error)
+	ListAPIKeys(tenantId string) ([]domain.APIKey, error)
+	DeleteAPIKey(tenantId string, id uuid.UUID) error
+	Authenticate(key string) (*domain.APIKey, error)
+}
@@ -0,0 +1,159 @@
+package dao
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
+	"slices"
+	"time"
+)
+
+var ErrInvalidAPIKeyName = errors.New("API key name must not be empty")
+var ErrInvalidScopes = fmt.Errorf("API key scopes must be some of %v", domain.Scopes)
+var ErrInvalidTenant = fmt.Errorf("tenant ID must be between 1 and %d characters long", domain.MaxTenantIDLength)
+var ErrUnauthenticated = errors.New("missing or invalid API key")
+
+// APIKeyPrefix starts the API keys handed out by the service, so they are told apart from other secrets
+const APIKeyPrefix = "ssccg_"
+
+// apiKeySize is the number of random bytes of an API key
+const apiKeySize = 32
+
+// AdminAPIKeyName names the key given by configuration, it is not stored
+const AdminAPIKeyName = "admin"
+
+type apiKeyDao struct {
+	querier      persistence.Querier
+	adminKeyHash string
+	now          func() time.Time
+}
+
+func NewAPIKeyDAO(querier persistence.Querier) *apiKeyDao {
+	return &apiKeyDao{
+		querier: querier,
+		now:     time.Now,
+	}
+}
+
+// WithAdminKey accepts the given key with the admin scope, to bootstrap the API keys.
+func (dm *apiKeyDao) WithAdminKey(key string) *apiKeyDao {
+	dm.adminKeyHash = hashAPIKey(key)
+	return dm
+}
+
+// WithClock sets the clock timestamping the API keys.
+func (dm *apiKeyDao) WithClock(now func() time.Time) *apiKeyDao {
+	dm.now = now
+	return dm
+}
+
+// hashAPIKey returns the hex encoded SHA-256 hash of a key.
+// Keys are random, a fast hash does not make them easier to guess.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey creates a new API key of a tenant
+// It does check the tenant, the name and the scopes, return error if they are not valid
+// It does generate a random key, and store only its hash
+// It returns the newly created key, along with the key itself, which cannot be retrieved again
+func (dm *apiKeyDao) CreateAPIKey(tenantId, name string, scopes []string, deviceIds []uuid.UUID) (*domain.APIKey, string, error) {
+	if !domain.IsValidTenantID(tenantId) {
+		return nil, "", ErrInvalidTenant
+	}
+	if name == "" {
+		return nil, "", ErrInvalidAPIKeyName
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScopes
+	}
+	for _, scope := range scopes {
+		if !domain.IsValidScope(scope) {
+			return nil, "", ErrInvalidScopes
+		}
+	}
+
+	secret := make([]byte, apiKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := domain.APIKey{
+		ID:        uuid.New(),
+		TenantID:  tenantId,
+		Name:      name,
+		KeyHash:   hashAPIKey(key),
+		Scopes:    scopes,
+		DeviceIDs: deviceIds,
+		CreatedAt: dm.now().UTC().Truncate(time.Microsecond),
+	}
+	if err := dm.querier.SaveAPIKey(apiKey); err != nil {
+		return nil, "", err
+	}
+	return &apiKey, key, nil
+}
+
+// ListAPIKeys returns the stored API keys of a tenant, or of every tenant for AllTenants, oldest first
+// The admin key given by configuration is not listed
+func (dm *apiKeyDao) ListAPIKeys(tenantId string) ([]domain.APIKey, error) {
+	apiKeys, err := dm.querier.GetAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	if tenantId == domain.AllTenants {
+		return apiKeys, nil
+	}
+
+	tenantKeys := make([]domain.APIKey, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		if apiKey.TenantID == tenantId {
+			tenantKeys = append(tenantKeys, apiKey)
+		}
+	}
+	return tenantKeys, nil
+}
+
+// DeleteAPIKey revokes an API key of a tenant, or of any tenant for AllTenants
+// It does return error if the tenant has no key with the ID
+func (dm *apiKeyDao) DeleteAPIKey(tenantId string, id uuid.UUID) error {
+	apiKeys, err := dm.ListAPIKeys(tenantId)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(apiKeys, func(apiKey domain.APIKey) bool { return apiKey.ID == id }) {
+		return persistence.ErrAPIKeyNotFound
+	}
+	return dm.querier.DeleteAPIKey(id)
+}
+
+// Authenticate returns the API key matching the key given by a caller
+// It does accept the admin key given by configuration, with the admin scope over every tenant
+// It does return ErrUnauthenticated if the key is unknown
+func (dm *apiKeyDao) Authenticate(key string) (*domain.APIKey, error) {
+	if key == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	keyHash := hashAPIKey(key)
+	if dm.adminKeyHash != "" && subtle.ConstantTimeCompare([]byte(keyHash), []byte(dm.adminKeyHash)) == 1 {
+		return &domain.APIKey{TenantID: domain.AllTenants, Name: AdminAPIKeyName, Scopes: []string{domain.ScopeAdmin}}, nil
+	}
+
+	apiKey, err := dm.querier.GetAPIKeyByHash(keyHash)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil {
+		return nil, ErrUnauthenticated
+	}
+	return apiKey, nil
+}
@@ -0,0 +1,112 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
+	"github.com/ildomm/ssccg/test_helpers"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	km := NewAPIKeyDAO(querier).WithClock(func() time.Time { return now })
+
+	deviceId := uuid.New()
+	apiKey, key, err := km.CreateAPIKey(domain.DefaultTenant, "terminal", []string{domain.ScopeSignaturesCreate}, []uuid.UUID{deviceId})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, APIKeyPrefix))
+	assert.Equal(t, "terminal", apiKey.Name)
+	assert.Equal(t, now, apiKey.CreatedAt)
+	assert.Equal(t, domain.DefaultTenant, apiKey.TenantID)
+
+	// Only the hash of the key is stored
+	assert.NotContains(t, apiKey.KeyHash, strings.TrimPrefix(key, APIKeyPrefix))
+	keys, err := km.ListAPIKeys(domain.DefaultTenant)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.APIKey{*apiKey}, keys)
+
+	authenticated, err := km.Authenticate(key)
+	assert.NoError(t, err)
+	assert.Equal(t, apiKey, authenticated)
+
+	_, other, err := km.CreateAPIKey(domain.DefaultTenant, "other", []string{domain.ScopeDevicesRead}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	_, _, err = km.CreateAPIKey(domain.DefaultTenant, "", []string{domain.ScopeDevicesRead}, nil)
+	assert.Equal(t, ErrInvalidAPIKeyName, err)
+	_, _, err = km.CreateAPIKey("", "terminal", []string{domain.ScopeDevicesRead}, nil)
+	assert.Equal(t, ErrInvalidTenant, err)
+	_, _, err = km.CreateAPIKey(domain.AllTenants, "terminal", []string{domain.ScopeDevicesRead}, nil)
+	assert.Equal(t, ErrInvalidTenant, err)
+	_, _, err = km.CreateAPIKey(domain.DefaultTenant, "none", nil, nil)
+	assert.Equal(t, ErrInvalidScopes, err)
+	_, _, err = km.CreateAPIKey(domain.DefaultTenant, "unknown", []string{"devices:delete"}, nil)
+	assert.Equal(t, ErrInvalidScopes, err)
+}
+
+func TestAuthenticate(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	km := NewAPIKeyDAO(querier)
+
+	_, err := km.Authenticate("")
+	assert.Equal(t, ErrUnauthenticated, err)
+	_, err = km.Authenticate("unknown")
+	assert.Equal(t, ErrUnauthenticated, err)
+
+	// The admin key is only accepted once configured
+	_, err = km.Authenticate("bootstrap")
+	assert.Equal(t, ErrUnauthenticated, err)
+	km.WithAdminKey("bootstrap")
+	admin, err := km.Authenticate("bootstrap")
+	assert.NoError(t, err)
+	assert.Equal(t, AdminAPIKeyName, admin.Name)
+	assert.True(t, admin.HasScope(domain.ScopeAdmin))
+	assert.Equal(t, domain.AllTenants, admin.TenantID)
+
+	apiKey, key, err := km.CreateAPIKey(domain.DefaultTenant, "terminal", []string{domain.ScopeSignaturesCreate}, nil)
+	require.NoError(t, err)
+	assert.NoError(t, km.DeleteAPIKey(domain.DefaultTenant, apiKey.ID))
+	_, err = km.Authenticate(key)
+	assert.Equal(t, ErrUnauthenticated, err)
+	assert.Equal(t, persistence.ErrAPIKeyNotFound, km.DeleteAPIKey(domain.DefaultTenant, apiKey.ID))
+}
+
+func TestAuthenticateStorageError(t *testing.T) {
+	querier := test_helpers.NewMockQuerier()
+	querier.On("GetAPIKeyByHash", hashAPIKey("key")).Return(nil, errors.New("connection lost"))
+
+	_, err := NewAPIKeyDAO(querier).Authenticate("key")
+	assert.EqualError(t, err, "connection lost")
+}
+
+func TestAPIKeyTenants(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	km := NewAPIKeyDAO(querier)
+
+	retail, _, err := km.CreateAPIKey("retail", "terminal", []string{domain.ScopeSignaturesCreate}, nil)
+	require.NoError(t, err)
+	other, _, err := km.CreateAPIKey(domain.DefaultTenant, "terminal", []string{domain.ScopeSignaturesCreate}, nil)
+	require.NoError(t, err)
+
+	keys, err := km.ListAPIKeys("retail")
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.APIKey{*retail}, keys)
+	keys, err = km.ListAPIKeys(domain.AllTenants)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	// Keys of other tenants are not found
+	assert.Equal(t, persistence.ErrAPIKeyNotFound, km.DeleteAPIKey("retail", other.ID))
+	assert.NoError(t, km.DeleteAPIKey(domain.AllTenants, other.ID))
+	assert.NoError(t, km.DeleteAPIKey("retail", retail.ID))
+}
@@ -0,0 +1,121 @@
+package dao
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+)
+
+// genesisSignature returns the value the first transaction of a device links to, in place of a previous signature
+func genesisSignature(deviceId uuid.UUID) string {
+	return base64.StdEncoding.EncodeToString([]byte(deviceId.String()))
+}
+
+// signatureCheck verifies the signature of a single transaction
+type signatureCheck func(transaction domain.SignedTransaction) error
+
+// auditChain walks the transactions of a device in sign counter order
+// It does report missing counters, counters used more than once, and transactions extending an already extended one
+// It does check each back-link against the signature of the previous transaction
+// It does check each signature with verify
+// It does check the device sign counter against the last transaction
+func auditChain(device domain.Device, transactions []domain.SignedTransaction, verify signatureCheck) *domain.ChainAudit {
+	audit := &domain.ChainAudit{
+		DeviceID:            device.ID,
+		Valid:               true,
+		TransactionsChecked: len(transactions),
+	}
+
+	ordered := append([]domain.SignedTransaction(nil), transactions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].SignCounter < ordered[j].SignCounter
+	})
+
+	// extendedAt maps each signature to the counter of the transaction linking to it
+	extendedAt := map[string]int{}
+	expectedCounter := 1
+	previousSign := genesisSignature(device.ID)
+	lastCounter := 0
+
+	for i := 0; i < len(ordered); {
+		// Transactions sharing the same counter are handled together
+		counter := ordered[i].SignCounter
+		end := i + 1
+		for end < len(ordered) && ordered[end].SignCounter == counter {
+			end++
+		}
+		group := ordered[i:end]
+		i = end
+
+		linkKnown := true
+		if counter > expectedCounter {
+			audit.AddIssue(domain.ChainAuditIssue{
+				SignCounter: expectedCounter,
+				Kind:        domain.AuditIssueGap,
+				Detail:      fmt.Sprintf("missing sign counters %d to %d", expectedCounter, counter-1),
+			})
+			// The signature the transaction should link to is missing
+			linkKnown = false
+		}
+
+		if len(group) > 1 {
+			audit.AddIssue(domain.ChainAuditIssue{
+				SignCounter: counter,
+				Kind:        domain.AuditIssueDuplicateCounter,
+				Detail:      fmt.Sprintf("sign counter used by %d transactions", len(group)),
+			})
+		}
+
+		for _, transaction := range group {
+			transactionID := transaction.ID
+
+			if linkKnown && transaction.PreviousDeviceSign != previousSign {
+				audit.AddIssue(domain.ChainAuditIssue{
+					SignCounter:   counter,
+					Kind:          domain.AuditIssueBrokenLink,
+					TransactionID: &transactionID,
+					Detail:        "previous signature does not match the previous transaction",
+				})
+			}
+
+			if extendedCounter, extended := extendedAt[transaction.PreviousDeviceSign]; extended && extendedCounter != counter {
+				audit.AddIssue(domain.ChainAuditIssue{
+					SignCounter:   counter,
+					Kind:          domain.AuditIssueFork,
+					TransactionID: &transactionID,
+					Detail:        fmt.Sprintf("previous signature already extended at sign counter %d", extendedCounter),
+				})
+			} else if !extended {
+				extendedAt[transaction.PreviousDeviceSign] = counter
+			}
+
+			if err := verify(transaction); err != nil {
+				audit.AddIssue(domain.ChainAuditIssue{
+					SignCounter:   counter,
+					Kind:          domain.AuditIssueInvalidSignature,
+					TransactionID: &transactionID,
+					Detail:        err.Error(),
+				})
+			}
+		}
+
+		// The first transaction of a duplicated counter is taken as the one being extended
+		previousSign = group[0].Sign
+		lastCounter = counter
+		expectedCounter = counter + 1
+	}
+
+	// The first counter not accounted for by both the device and its transactions
+	if device.SignCounter != lastCounter {
+		audit.AddIssue(domain.ChainAuditIssue{
+			SignCounter: min(device.SignCounter, lastCounter) + 1,
+			Kind:        domain.AuditIssueCounterMismatch,
+			Detail:      fmt.Sprintf("device sign counter is %d but the last transaction has %d", device.SignCounter, lastCounter),
+		})
+	}
+
+	return audit
+}
@@ -0,0 +1,120 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildTestChain builds a well linked chain of transactions with fake signatures
+func buildTestChain(device domain.Device, length int) []domain.SignedTransaction {
+	transactions := make([]domain.SignedTransaction, 0, length)
+	previous := genesisSignature(device.ID)
+	for counter := 1; counter <= length; counter++ {
+		transaction := domain.SignedTransaction{
+			ID:                 uuid.New(),
+			DeviceID:           device.ID,
+			SignCounter:        counter,
+			PreviousDeviceSign: previous,
+			Sign:               fmt.Sprintf("sign-%d", counter),
+		}
+		transactions = append(transactions, transaction)
+		previous = transaction.Sign
+	}
+	return transactions
+}
+
+func acceptAll(domain.SignedTransaction) error {
+	return nil
+}
+
+func issueKinds(audit *domain.ChainAudit) []string {
+	kinds := make([]string, 0, len(audit.Issues))
+	for _, issue := range audit.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return kinds
+}
+
+func TestAuditChain(t *testing.T) {
+	device := domain.Device{ID: uuid.New(), SignCounter: 5}
+
+	t.Run("ValidChain", func(t *testing.T) {
+		audit := auditChain(device, buildTestChain(device, 5), acceptAll)
+		assert.True(t, audit.Valid)
+		assert.Equal(t, 5, audit.TransactionsChecked)
+		assert.Nil(t, audit.FirstInvalidCounter)
+		assert.Empty(t, audit.Issues)
+	})
+
+	t.Run("EmptyChain", func(t *testing.T) {
+		audit := auditChain(domain.Device{ID: device.ID}, nil, acceptAll)
+		assert.True(t, audit.Valid)
+	})
+
+	t.Run("UnorderedChain", func(t *testing.T) {
+		chain := buildTestChain(device, 5)
+		chain[0], chain[4] = chain[4], chain[0]
+		audit := auditChain(device, chain, acceptAll)
+		assert.True(t, audit.Valid)
+	})
+
+	t.Run("Gap", func(t *testing.T) {
+		chain := buildTestChain(device, 5)
+		chain = append(chain[:2], chain[3:]...)
+		audit := auditChain(device, chain, acceptAll)
+		assert.False(t, audit.Valid)
+		assert.Equal(t, []string{domain.AuditIssueGap}, issueKinds(audit))
+		assert.Equal(t, 3, *audit.FirstInvalidCounter)
+	})
+
+	t.Run("DuplicateCounter", func(t *testing.T) {
+		chain := buildTestChain(device, 5)
+		duplicate := chain[2]
+		duplicate.ID = uuid.New()
+		duplicate.Sign = "sign-3-duplicate"
+		chain = append(chain, duplicate)
+		audit := auditChain(device, chain, acceptAll)
+		assert.Equal(t, []string{domain.AuditIssueDuplicateCounter}, issueKinds(audit))
+		assert.Equal(t, 3, *audit.FirstInvalidCounter)
+	})
+
+	t.Run("Fork", func(t *testing.T) {
+		chain := buildTestChain(device, 5)
+		chain[3].PreviousDeviceSign = chain[1].Sign
+		audit := auditChain(device, chain, acceptAll)
+		assert.Equal(t, []string{domain.AuditIssueBrokenLink, domain.AuditIssueFork}, issueKinds(audit))
+		assert.Equal(t, 4, *audit.FirstInvalidCounter)
+		assert.Equal(t, &chain[3].ID, audit.Issues[1].TransactionID)
+	})
+
+	t.Run("BrokenLink", func(t *testing.T) {
+		chain := buildTestChain(device, 5)
+		chain[1].PreviousDeviceSign = "unknown"
+		audit := auditChain(device, chain, acceptAll)
+		assert.Equal(t, []string{domain.AuditIssueBrokenLink}, issueKinds(audit))
+		assert.Equal(t, 2, *audit.FirstInvalidCounter)
+	})
+
+	t.Run("InvalidSignature", func(t *testing.T) {
+		chain := buildTestChain(device, 5)
+		audit := auditChain(device, chain, func(transaction domain.SignedTransaction) error {
+			if transaction.SignCounter >= 4 {
+				return errors.New("signature does not match the data")
+			}
+			return nil
+		})
+		assert.Equal(t, []string{domain.AuditIssueInvalidSignature, domain.AuditIssueInvalidSignature}, issueKinds(audit))
+		assert.Equal(t, 4, *audit.FirstInvalidCounter)
+	})
+
+	t.Run("CounterMismatch", func(t *testing.T) {
+		audit := auditChain(device, buildTestChain(device, 4), acceptAll)
+		assert.Equal(t, []string{domain.AuditIssueCounterMismatch}, issueKinds(audit))
+		assert.Equal(t, 5, *audit.FirstInvalidCounter)
+	})
+}
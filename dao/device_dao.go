@@ -2,13 +2,32 @@ package dao
 
 import (
 	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/crypto"
 	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
 )
 
 type DeviceDAO interface {
-	CreateDevice(id uuid.UUID, label, algorithm string) (*domain.Device, error)
-	GetDevices() ([]domain.Device, error)
+	CreateDevice(id uuid.UUID, label, algorithm string, parameters crypto.KeyParameters) (*domain.Device, error)
+	ListDevices(filter persistence.DeviceFilter, page persistence.Page) ([]domain.Device, error)
 	GetDevice(id uuid.UUID) (*domain.Device, error)
 	CreateSignedTransaction(deviceId uuid.UUID, data []byte) (*domain.SignedTransaction, error)
-	GetSignedTransactions(deviceId uuid.UUID) ([]domain.SignedTransaction, error)
+	CreateDigestSignedTransaction(deviceId uuid.UUID, hashAlgorithm string, digest []byte) (*domain.SignedTransaction, error)
+	CreateIdempotentSignedTransaction(deviceId uuid.UUID, idempotencyKey string, data []byte) (*domain.SignedTransaction, bool, error)
+	CreateSignedTransactions(deviceId uuid.UUID, data [][]byte, mode string) ([]domain.BatchSignature, error)
+	ListSignedTransactions(deviceId uuid.UUID, filter persistence.SignedTransactionFilter, page persistence.Page) ([]domain.SignedTransaction, error)
+	GetSignedTransaction(deviceId uuid.UUID, signCounter int) (*domain.SignedTransaction, error)
+	GetSignedTransactionByID(id uuid.UUID) (*domain.SignedTransaction, error)
+	VerifySignedTransaction(deviceId uuid.UUID, request domain.SignatureVerificationRequest) (*domain.SignatureVerification, error)
+	AuditSignedTransactions(deviceId uuid.UUID) (*domain.ChainAudit, error)
+	GetDeviceKeys(deviceId uuid.UUID) ([]domain.DeviceKey, error)
+	RotateDeviceKey(deviceId uuid.UUID) (*domain.KeyRotation, error)
+	ChangeDeviceStatus(deviceId uuid.UUID, status, reason string) (*domain.Device, error)
+	GetDeviceStatusChanges(deviceId uuid.UUID) ([]domain.DeviceStatusChange, error)
+}
+
+// TenantDeviceDAO is a DeviceDAO which can be scoped to the devices of a tenant
+type TenantDeviceDAO interface {
+	DeviceDAO
+	ForTenant(tenantId string) DeviceDAO
 }
@@ -1,49 +1,223 @@
 package dao
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/ildomm/ssccg/crypto"
 	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/metrics"
 	"github.com/ildomm/ssccg/persistence"
-	"sync"
+	"log"
+	"slices"
+	"time"
 )
 
 var ErrDeviceExists = errors.New("device already exists")
+var ErrDeviceIDUnavailable = errors.New("device ID cannot be used, choose another one")
 var ErrInvalidAlgorithm = errors.New("invalid algorithm")
+var ErrSignedTransactionNotFound = errors.New("signed transaction not found")
+var ErrInvalidVerificationRequest = errors.New("either a transaction ID or signed data with its signature must be given")
+var ErrRewrapNotSupported = errors.New("the key store does not wrap private keys")
+var ErrNoKeyForSignCounter = errors.New("no device key is valid for the sign counter")
+var ErrDeviceNotActive = errors.New("device is not active")
+var ErrInvalidDeviceStatus = errors.New("invalid device status")
+var ErrInvalidStatusTransition = errors.New("device status cannot change to the requested one")
+var ErrInvalidIdempotencyKey = fmt.Errorf("idempotency key must be between 1 and %d characters long", MaxIdempotencyKeyLength)
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with different data")
+var ErrInvalidBatch = fmt.Errorf("a batch must have between 1 and %d items", MaxBatchSize)
+var ErrInvalidBatchMode = errors.New("invalid batch mode")
+
+// MaxIdempotencyKeyLength is the longest idempotency key accepted
+const MaxIdempotencyKeyLength = 255
+
+// MaxBatchSize is the largest number of items signed in a batch
+const MaxBatchSize = 1000
+
+// DefaultIdempotencyRetention is how long an idempotency key is remembered by default
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+// BatchItemError reports the item failing to sign in an atomic batch
+type BatchItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// keyRewrapper is implemented by the key stores wrapping the private keys they hand out with a key encryption key
+type keyRewrapper interface {
+	Rewrap(handle string) (string, bool, error)
+}
 
 type deviceDao struct {
 	querier     persistence.Querier
 	keysBuilder *crypto.KeysBuilder
-	Signer      *crypto.Signer
-	lock        sync.Mutex
+	keyStore    crypto.KeyStore
+	Verifier    *crypto.Verifier
+	locker      *deviceLocker
+	now         func() time.Time
+	tenantId    string
+	metrics     *metrics.Metrics
+
+	idempotencyRetention time.Duration
 }
 
 func NewDeviceDAO(querier persistence.Querier) *deviceDao {
 	dm := deviceDao{
 		querier:     querier,
 		keysBuilder: crypto.NewKeysBuilder(),
-		Signer:      crypto.NewSigner(),
+		keyStore:    crypto.NewLocalKeyStore(),
+		Verifier:    crypto.NewVerifier(),
+		locker:      newDeviceLocker(),
+		now:         time.Now,
+		tenantId:    domain.DefaultTenant,
+
+		idempotencyRetention: DefaultIdempotencyRetention,
 	}
 	return &dm
 }
 
+// WithKeyStore sets the key store generating the key pairs of new devices, and signing with them.
+func (dm *deviceDao) WithKeyStore(keyStore crypto.KeyStore) *deviceDao {
+	dm.keyStore = keyStore
+	return dm
+}
+
+// WithIdempotencyRetention sets how long an idempotency key is remembered after its transaction is signed.
+func (dm *deviceDao) WithIdempotencyRetention(retention time.Duration) *deviceDao {
+	dm.idempotencyRetention = retention
+	return dm
+}
+
+// WithClock sets the clock timestamping the devices, signed transactions, device status changes and idempotency keys.
+func (dm *deviceDao) WithClock(now func() time.Time) *deviceDao {
+	dm.now = now
+	return dm
+}
+
+// WithMetrics sets the metrics recording the signatures, key generations and device lock waits.
+func (dm *deviceDao) WithMetrics(m *metrics.Metrics) *deviceDao {
+	dm.metrics = m
+	return dm
+}
+
+// ForTenant returns the DAO scoped to the devices of a tenant, sharing the storage, key store and device locks.
+// Devices of other tenants are not found, as if they did not exist.
+func (dm *deviceDao) ForTenant(tenantId string) DeviceDAO {
+	scoped := *dm
+	scoped.tenantId = tenantId
+	return &scoped
+}
+
+// getDevice returns a device of the tenant of the DAO, within querier
+// It does return ErrDeviceNotFound for the devices of other tenants
+func (dm *deviceDao) getDevice(querier persistence.Querier, deviceId uuid.UUID) (*domain.Device, error) {
+	device, err := querier.GetDevice(deviceId)
+	return dm.tenantDevice(device, err)
+}
+
+// getDeviceForUpdate returns a device of the tenant of the DAO, locked until the end of the unit of work tx
+// It does lock the device across service instances, the device locks of the DAO only serializing this instance
+func (dm *deviceDao) getDeviceForUpdate(tx persistence.Querier, deviceId uuid.UUID) (*domain.Device, error) {
+	device, err := tx.GetDeviceForUpdate(deviceId)
+	return dm.tenantDevice(device, err)
+}
+
+// tenantDevice returns the device read, or ErrDeviceNotFound when it belongs to another tenant
+func (dm *deviceDao) tenantDevice(device *domain.Device, err error) (*domain.Device, error) {
+	if err != nil {
+		return nil, err
+	}
+	if device == nil || device.TenantID != dm.tenantId {
+		return nil, persistence.ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+// deviceIDConflict returns the error refusing to create a device with the ID of an existing one.
+// The ID of a device of another tenant is only told to be unavailable, so the device is not disclosed.
+func (dm *deviceDao) deviceIDConflict(existing domain.Device) error {
+	if existing.TenantID != dm.tenantId {
+		return ErrDeviceIDUnavailable
+	}
+	return ErrDeviceExists
+}
+
+// savedDeviceConflict returns the error refusing to create a device whose ID was taken since it was checked.
+func (dm *deviceDao) savedDeviceConflict(deviceId uuid.UUID) error {
+	existing, err := dm.querier.GetDevice(deviceId)
+	if err != nil {
+		return ErrDeviceIDUnavailable
+	}
+	return dm.deviceIDConflict(*existing)
+}
+
+// lock locks the device, recording the time waited for it, and returns the function that unlocks it.
+func (dm *deviceDao) lock(deviceId uuid.UUID) func() {
+	start := time.Now()
+	unlock := dm.locker.Lock(deviceId)
+	dm.metrics.ObserveLockWait(time.Since(start))
+	return unlock
+}
+
+// generateKey generates a key pair in the key store, recording the time taken.
+func (dm *deviceDao) generateKey(algorithm string, parameters crypto.KeyParameters) (string, []byte, error) {
+	start := time.Now()
+	keyHandle, publicKey, err := dm.keyStore.Generate(algorithm, parameters)
+	if err == nil {
+		dm.metrics.ObserveKeyGeneration(algorithm, time.Since(start))
+	}
+	return keyHandle, publicKey, err
+}
+
+// discardKey deletes a key pair generated for a device that was not stored, so it is not left behind in the key store.
+// The deletion failing is only logged, the error returned being the one that prevented storing the device.
+func (dm *deviceDao) discardKey(keyHandle string) {
+	if err := dm.keyStore.Delete(keyHandle); err != nil {
+		log.Println("Could not delete the key pair of a device not stored: ", err)
+	}
+}
+
+// timestamp returns the current time of the clock, in UTC and to the microsecond stored by Postgres.
+// Signed data covering a timestamp must read the same once stored.
+func (dm *deviceDao) timestamp() time.Time {
+	return dm.now().UTC().Truncate(time.Microsecond)
+}
+
 // CreateDevice creates a new device with a new key pair
 // It does check if the device already exists, return error if it does exist
+// It does check the ID against the devices of every tenant, device IDs being unique across tenants
+// It does refuse the IDs of the devices of other tenants without telling they exist, return error if so
+// It does refuse the ID the same way when a device is created with it concurrently
 // It does check if the algorithm is supported, return error if it does not
-// It does build a new key pair based on algorithm
-// It does start the sign counter at 0
-// It does store the device in the database
+// It does check the key parameters against the algorithm policy, return error if they are not allowed
+// It does generate a new key pair in the key store, based on algorithm and key parameters
+// It does keep only the handle of the private key
+// It does start the sign counter at 0, the key pair signing from the first transaction on
+// It does start the device as active
+// It does sign the device transactions with the latest signed data format
+// It does timestamp the device creation
+// It does assign the device to the tenant of the DAO
+// It does store the device in the database, deleting the key pair when it cannot
 // It returns the newly created device
-func (dm *deviceDao) CreateDevice(id uuid.UUID, label, algorithm string) (*domain.Device, error) {
+func (dm *deviceDao) CreateDevice(id uuid.UUID, label, algorithm string, parameters crypto.KeyParameters) (*domain.Device, error) {
 	// Check if device exists
 	existingDevice, err := dm.querier.GetDevice(id)
 	if err != nil && !errors.Is(err, persistence.ErrDeviceNotFound) {
 		return nil, err
 	}
 	if existingDevice != nil {
-		return nil, ErrDeviceExists
+		return nil, dm.deviceIDConflict(*existingDevice)
 	}
 
 	// Validate algorithm
@@ -51,54 +225,74 @@ func (dm *deviceDao) CreateDevice(id uuid.UUID, label, algorithm string) (*domai
 		return nil, ErrInvalidAlgorithm
 	}
 
-	// Builds key pair
-	privateKey, publicKey, err := dm.keysBuilder.Build(algorithm)
+	// Apply the algorithm defaults, and validate the key parameters
+	parameters, err = dm.keysBuilder.Parameters(algorithm, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generates key pair
+	keyHandle, publicKey, err := dm.generateKey(algorithm, parameters)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create device
 	device := domain.Device{
-		ID:            id,
-		Label:         label,
-		SignAlgorithm: algorithm,
-		PrivateKey:    string(privateKey),
-		PublicKey:     string(publicKey),
-		SignCounter:   0,
+		ID:               id,
+		TenantID:         dm.tenantId,
+		Label:            label,
+		SignAlgorithm:    algorithm,
+		RSABits:          parameters.RSABits,
+		Curve:            parameters.Curve,
+		KeyHandle:        keyHandle,
+		PublicKey:        string(publicKey),
+		KeyValidFrom:     1,
+		SignCounter:      0,
+		Status:           domain.DeviceStatusActive,
+		SignedDataFormat: domain.LatestSignedDataFormat,
+		CreatedAt:        dm.timestamp(),
 	}
+	device.UpdatedAt = device.CreatedAt
 
 	// Store device in database
 	err = dm.querier.SaveDevice(device)
 	if err != nil {
+		dm.discardKey(keyHandle)
+		if errors.Is(err, persistence.ErrDeviceExists) {
+			// Created concurrently, since checked
+			return nil, dm.savedDeviceConflict(id)
+		}
 		return nil, err
 	}
 
 	return &device, nil
 }
 
-// GetDevices returns all devices from the database
-func (dm *deviceDao) GetDevices() ([]domain.Device, error) {
-	return dm.querier.GetDevices()
+// ListDevices returns a page of the devices of the tenant passing the filter, in creation order
+func (dm *deviceDao) ListDevices(filter persistence.DeviceFilter, page persistence.Page) ([]domain.Device, error) {
+	filter.TenantID = dm.tenantId
+	return dm.querier.ListDevices(filter, page)
 }
 
-// GetDevice returns a device from the database
+// GetDevice returns a device of the tenant from the database
 func (dm *deviceDao) GetDevice(id uuid.UUID) (*domain.Device, error) {
-	return dm.querier.GetDevice(id)
+	return dm.getDevice(dm.querier, id)
 }
 
 // previousDeviceSignature returns the previous device signature
 // It does return the device id if no previous signature exists
 // It does return the previous signature if it exists
-func (dm *deviceDao) previousDeviceSignature(deviceId uuid.UUID, signCounter int) (string, error) {
+func (dm *deviceDao) previousDeviceSignature(querier persistence.Querier, deviceId uuid.UUID, signCounter int) (string, error) {
 
-	previousSignedTransaction, err := dm.querier.GetSignedTransaction(deviceId, signCounter)
+	previousSignedTransaction, err := querier.GetSignedTransaction(deviceId, signCounter)
 	if err != nil {
 		return "", err
 	}
 
 	// If no previous signed transaction exists, return the device id
 	if previousSignedTransaction == nil {
-		return base64.StdEncoding.EncodeToString([]byte(deviceId.String())), nil
+		return genesisSignature(deviceId), nil
 	}
 
 	return previousSignedTransaction.Sign, nil
@@ -106,29 +300,222 @@ func (dm *deviceDao) previousDeviceSignature(deviceId uuid.UUID, signCounter int
 
 // CreateSignedTransaction creates a new signed transaction
 // It does check if the device exists, return error if it does not exist
+// It does check if the device is active, return error if it is not
 // It does generate a new signature based on the device's algorithm
 // It does increment the device's sign counter and update the device in the database
 // It does persist the device sign counter with the transaction
 // It does store the signed transaction in the database
+// It does run all database operations in a single database transaction
 // It returns the newly created signed transaction
 func (dm *deviceDao) CreateSignedTransaction(deviceId uuid.UUID, data []byte) (*domain.SignedTransaction, error) {
+	return dm.createSignedTransaction(deviceId, data, "")
+}
 
-	// Lock to prevent concurrent access
-	// Doing so, we prevent the sign counter to be incremented twice wrongly
-	dm.lock.Lock()
-	defer dm.lock.Unlock()
+// CreateDigestSignedTransaction creates a new signed transaction for a digest computed by the client
+// It does check if the hash algorithm is supported and the digest has its size, return error if not
+// It does otherwise sign as CreateSignedTransaction does, the digest standing in for the raw data of the signed data
+// It returns the newly created signed transaction
+func (dm *deviceDao) CreateDigestSignedTransaction(deviceId uuid.UUID, hashAlgorithm string, digest []byte) (*domain.SignedTransaction, error) {
+	hash, err := crypto.DigestHash(hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(digest) != hash.Size() {
+		return nil, crypto.ErrInvalidDigest
+	}
 
-	// Check if device exists
-	device, err := dm.querier.GetDevice(deviceId)
+	return dm.createSignedTransaction(deviceId, digest, hashAlgorithm)
+}
+
+// createSignedTransaction signs data, or a digest when its hash algorithm is given, in its own database transaction
+func (dm *deviceDao) createSignedTransaction(deviceId uuid.UUID, data []byte, hashAlgorithm string) (*domain.SignedTransaction, error) {
+
+	// Lock the device to prevent concurrent access
+	// Doing so, we prevent the sign counter to be incremented twice wrongly,
+	// while other devices can still sign in parallel
+	unlock := dm.lock(deviceId)
+	defer unlock()
+
+	var transaction domain.SignedTransaction
+	err := dm.querier.WithTx(func(tx persistence.Querier) error {
+		signed, err := dm.signTransaction(tx, deviceId, data, hashAlgorithm)
+		if err != nil {
+			return err
+		}
+		transaction = *signed
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if device == nil {
-		return nil, persistence.ErrDeviceNotFound
+
+	return &transaction, nil
+}
+
+// CreateIdempotentSignedTransaction creates a new signed transaction, unless one was already signed for the idempotency key
+// It does check if the idempotency key is valid, return error if it is not
+// It does return the transaction signed for the key when the same data is given again
+// It does check if the key was used with other data, return error if it was
+// It does forget the keys older than the retention window, signing again for them
+// It does store the key along with the new signed transaction, in a single database transaction
+// It does lock the device before reading the key, even across service instances, so a key is never saved twice
+// It returns the signed transaction, and whether it was signed by an earlier request
+func (dm *deviceDao) CreateIdempotentSignedTransaction(deviceId uuid.UUID, idempotencyKey string, data []byte) (*domain.SignedTransaction, bool, error) {
+	if idempotencyKey == "" || len(idempotencyKey) > MaxIdempotencyKeyLength {
+		return nil, false, ErrInvalidIdempotencyKey
+	}
+
+	// Lock the device, so retries racing each other sign only once
+	unlock := dm.lock(deviceId)
+	defer unlock()
+
+	requestHash := sha256.Sum256(data)
+	now := dm.timestamp()
+
+	var transaction domain.SignedTransaction
+	replayed := false
+	err := dm.querier.WithTx(func(tx persistence.Querier) error {
+		// Checked before replaying, so transactions of other tenants are not disclosed
+		// Locked before reading the key, so retries racing each other on other instances see the key saved by the first one
+		if _, err := dm.getDeviceForUpdate(tx, deviceId); err != nil {
+			return err
+		}
+
+		stored, err := tx.GetIdempotencyKey(deviceId, idempotencyKey)
+		if err != nil {
+			return err
+		}
+
+		expiredUpTo := now.Add(-dm.idempotencyRetention)
+		if stored != nil && stored.CreatedAt.After(expiredUpTo) {
+			if stored.RequestHash != hex.EncodeToString(requestHash[:]) {
+				return ErrIdempotencyKeyReused
+			}
+
+			original, err := tx.GetSignedTransactionByID(stored.TransactionID)
+			if err != nil {
+				return err
+			}
+			if original == nil {
+				return ErrSignedTransactionNotFound
+			}
+			transaction = *original
+			replayed = true
+			return nil
+		}
+
+		signed, err := dm.signTransaction(tx, deviceId, data, "")
+		if err != nil {
+			return err
+		}
+		transaction = *signed
+
+		return tx.SaveIdempotencyKey(domain.IdempotencyKey{
+			DeviceID:      deviceId,
+			Key:           idempotencyKey,
+			RequestHash:   hex.EncodeToString(requestHash[:]),
+			TransactionID: signed.ID,
+			CreatedAt:     now,
+		}, expiredUpTo)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &transaction, replayed, nil
+}
+
+// CreateSignedTransactions signs a batch of data items in order, with consecutive sign counters
+// It does check the batch size and mode, return error if they are not valid
+// It does check if the device exists and is active, return error if it is not
+// It does keep the device locked for the whole batch, so no other signature is interleaved
+// It does sign all items in a single database transaction in atomic mode, returning the failing item error
+// It does sign each item in its own database transaction in partial mode, reporting the failing items in their results
+// It returns the outcome of each item, in the order of the batch
+func (dm *deviceDao) CreateSignedTransactions(deviceId uuid.UUID, data [][]byte, mode string) ([]domain.BatchSignature, error) {
+	if len(data) == 0 || len(data) > MaxBatchSize {
+		return nil, ErrInvalidBatch
+	}
+	if !domain.IsValidBatchMode(mode) {
+		return nil, ErrInvalidBatchMode
+	}
+
+	unlock := dm.lock(deviceId)
+	defer unlock()
+
+	// Checked up front, so a partial batch does not fail item by item for the same reason
+	device, err := dm.getDevice(dm.querier, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if device.Status != domain.DeviceStatusActive {
+		return nil, ErrDeviceNotActive
+	}
+
+	results := make([]domain.BatchSignature, len(data))
+	if mode == domain.BatchModeAtomic {
+		err := dm.querier.WithTx(func(tx persistence.Querier) error {
+			for i, item := range data {
+				signed, err := dm.signTransaction(tx, deviceId, item, "")
+				if err != nil {
+					return &BatchItemError{Index: i, Err: err}
+				}
+				results[i].Transaction = signed
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
 	}
 
+	for i, item := range data {
+		err := dm.querier.WithTx(func(tx persistence.Querier) error {
+			signed, err := dm.signTransaction(tx, deviceId, item, "")
+			if err != nil {
+				return err
+			}
+			results[i].Transaction = signed
+			return nil
+		})
+		if err != nil {
+			results[i] = domain.BatchSignature{Err: err}
+		}
+	}
+	return results, nil
+}
+
+// PurgeIdempotencyKeys deletes the idempotency keys older than the retention window
+// It returns the number of keys deleted
+func (dm *deviceDao) PurgeIdempotencyKeys() (int, error) {
+	return dm.querier.DeleteIdempotencyKeys(dm.timestamp().Add(-dm.idempotencyRetention))
+}
+
+// signTransaction builds, signs and stores the next transaction of a device within the unit of work tx
+// The data is a digest when its hash algorithm is given
+// The device is locked and its status checked within tx, so a concurrent status change or key rotation is seen
+// Storing the transaction and incrementing the sign counter either both happen or none does
+// Only the sign counter of the device is written, never its key or status
+func (dm *deviceDao) signTransaction(tx persistence.Querier, deviceId uuid.UUID, data []byte, hashAlgorithm string) (signed *domain.SignedTransaction, err error) {
+	// Check if device exists, and lock it
+	device, err := dm.getDeviceForUpdate(tx, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Suspended and decommissioned devices do not sign
+	if device.Status != domain.DeviceStatusActive {
+		return nil, ErrDeviceNotActive
+	}
+
+	start := time.Now()
+	defer func() {
+		dm.metrics.ObserveSignature(device.SignAlgorithm, err, time.Since(start))
+	}()
+
 	// Get previous signed transaction
-	previousSignature, err := dm.previousDeviceSignature(deviceId, device.SignCounter)
+	previousSignature, err := dm.previousDeviceSignature(tx, deviceId, device.SignCounter)
 	if err != nil {
 		return nil, err
 	}
@@ -140,30 +527,28 @@ func (dm *deviceDao) CreateSignedTransaction(deviceId uuid.UUID, data []byte) (*
 		RawData:            data,
 		SignCounter:        device.SignCounter + 1,
 		PreviousDeviceSign: previousSignature,
+		CreatedAt:          dm.timestamp(),
+		FormatVersion:      device.SignedDataFormat,
+		HashAlgorithm:      hashAlgorithm,
 	}
 
 	// Sign data
-	signature, err := dm.Signer.Sign(device.SignAlgorithm,
-		[]byte(device.PrivateKey),
-		[]byte(transaction.SignedData()))
+	signature, err := dm.keyStore.Sign(device.SignAlgorithm, device.KeyHandle, []byte(transaction.SignedData()))
 	if err != nil {
 		return nil, err
 	}
 	transaction.Sign = base64.StdEncoding.EncodeToString(signature)
 
 	// Store signed transaction in database
-	_, err = dm.querier.SaveSignedTransaction(transaction)
+	_, err = tx.SaveSignedTransaction(transaction)
 	if err != nil {
 		return nil, err
 	}
 
 	// Increment sign counter
-	// This is done after the transaction is stored in the database
-	// to prevent the sign counter to be incremented wrongly
-	// Fail safe measure
-	// When using a real database, this should be done in a transaction
 	device.SignCounter++
-	err = dm.querier.UpdateDevice(*device)
+	device.UpdatedAt = transaction.CreatedAt
+	err = tx.UpdateDeviceSignCounter(*device)
 	if err != nil {
 		return nil, err
 	}
@@ -171,7 +556,426 @@ func (dm *deviceDao) CreateSignedTransaction(deviceId uuid.UUID, data []byte) (*
 	return &transaction, nil
 }
 
-// GetSignedTransactions returns all signed transactions from the database
-func (dm *deviceDao) GetSignedTransactions(deviceId uuid.UUID) ([]domain.SignedTransaction, error) {
-	return dm.querier.GetSignedTransactions(deviceId)
+// ListSignedTransactions returns a page of the signed transactions of a device passing the filter, in sign counter order
+// It does check if the device exists, return error if it does not exist
+func (dm *deviceDao) ListSignedTransactions(deviceId uuid.UUID, filter persistence.SignedTransactionFilter, page persistence.Page) ([]domain.SignedTransaction, error) {
+	if _, err := dm.getDevice(dm.querier, deviceId); err != nil {
+		return nil, err
+	}
+
+	return dm.querier.ListSignedTransactions(deviceId, filter, page)
+}
+
+// GetSignedTransaction returns the signed transaction of a device with the given sign counter
+// It does check if the device exists, return error if it does not exist
+// It does return error if the device has no transaction with the sign counter
+func (dm *deviceDao) GetSignedTransaction(deviceId uuid.UUID, signCounter int) (*domain.SignedTransaction, error) {
+	if _, err := dm.getDevice(dm.querier, deviceId); err != nil {
+		return nil, err
+	}
+
+	transaction, err := dm.querier.GetSignedTransaction(deviceId, signCounter)
+	if err != nil {
+		return nil, err
+	}
+	if transaction == nil {
+		return nil, ErrSignedTransactionNotFound
+	}
+	return transaction, nil
+}
+
+// GetSignedTransactionByID returns a signed transaction by its ID, whichever device of the tenant signed it
+// It does return error if no transaction has the ID, or its device belongs to another tenant
+func (dm *deviceDao) GetSignedTransactionByID(id uuid.UUID) (*domain.SignedTransaction, error) {
+	transaction, err := dm.querier.GetSignedTransactionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if transaction == nil {
+		return nil, ErrSignedTransactionNotFound
+	}
+
+	if _, err := dm.getDevice(dm.querier, transaction.DeviceID); err != nil {
+		if errors.Is(err, persistence.ErrDeviceNotFound) {
+			return nil, ErrSignedTransactionNotFound
+		}
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// VerifySignedTransaction verifies a signature against the device's public keys
+// It does check if the device exists, return error if it does not exist
+// It does look up the stored transaction when a transaction ID is given, return error if it does not exist
+// It does verify a stored transaction with the key valid at its sign counter
+// It does otherwise verify the given signed data and base64 signature as they are, against every key of the device
+// It returns the verification outcome, with the reason when the signature is not valid
+func (dm *deviceDao) VerifySignedTransaction(deviceId uuid.UUID, request domain.SignatureVerificationRequest) (*domain.SignatureVerification, error) {
+	byTransaction := request.TransactionID != uuid.Nil
+	bySignature := request.SignedData != nil && request.Signature != ""
+	partialSignature := (request.SignedData != nil) != (request.Signature != "")
+	if partialSignature || byTransaction == bySignature {
+		return nil, ErrInvalidVerificationRequest
+	}
+
+	device, err := dm.getDevice(dm.querier, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := dm.deviceKeys(dm.querier, *device)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := domain.SignatureVerification{}
+	signature := request.Signature
+	verify := func(publicKey, signature []byte) error {
+		return dm.Verifier.Verify(device.SignAlgorithm, publicKey, request.SignedData, signature)
+	}
+
+	if byTransaction {
+		transaction, err := dm.findSignedTransaction(deviceId, request.TransactionID)
+		if err != nil {
+			return nil, err
+		}
+		verification.TransactionID = &transaction.ID
+		verification.SignCounter = transaction.SignCounter
+		signature = transaction.Sign
+		verify = func(publicKey, signature []byte) error {
+			return dm.Verifier.Verify(device.SignAlgorithm, publicKey, []byte(transaction.SignedData()), signature)
+		}
+
+		// Only the key the device signed with at that sign counter is trusted
+		key, found := keyCovering(keys, transaction.SignCounter)
+		if !found {
+			verification.Reason = domain.VerificationReasonSignatureMismatch
+			return &verification, nil
+		}
+		keys = []domain.DeviceKey{key}
+	} else {
+		// Signed data given as is has no trusted sign counter, the newest keys are tried first
+		slices.Reverse(keys)
+	}
+
+	return dm.verifySignature(keys, signature, verification, verify)
+}
+
+// findSignedTransaction returns a transaction of a device by its ID
+func (dm *deviceDao) findSignedTransaction(deviceId, transactionId uuid.UUID) (*domain.SignedTransaction, error) {
+	transaction, err := dm.querier.GetSignedTransactionByID(transactionId)
+	if err != nil {
+		return nil, err
+	}
+	if transaction == nil || transaction.DeviceID != deviceId {
+		return nil, ErrSignedTransactionNotFound
+	}
+	return transaction, nil
+}
+
+// verifySignature completes the verification outcome of a base64 signature, checked by verify
+// The signature is valid when any of the given keys verifies it
+// A signature that does not verify is reported in the outcome, not as an error
+func (dm *deviceDao) verifySignature(keys []domain.DeviceKey, signature string, verification domain.SignatureVerification, verify func(publicKey, signature []byte) error) (*domain.SignatureVerification, error) {
+	decodedSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		verification.Reason = domain.VerificationReasonMalformedSignature
+		return &verification, nil
+	}
+
+	for _, key := range keys {
+		err = verify([]byte(key.PublicKey), decodedSignature)
+		if errors.Is(err, crypto.ErrSignatureMismatch) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		verification.Valid = true
+		return &verification, nil
+	}
+
+	verification.Reason = domain.VerificationReasonSignatureMismatch
+	return &verification, nil
+}
+
+// AuditSignedTransactions walks the whole signature chain of a device
+// It does check if the device exists, return error if it does not exist
+// It does verify every signature and every back-link, in sign counter order
+// It does report gaps, duplicate counters and forks
+// It returns the audit outcome, with the first offending sign counter if any
+func (dm *deviceDao) AuditSignedTransactions(deviceId uuid.UUID) (*domain.ChainAudit, error) {
+	device, err := dm.getDevice(dm.querier, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := dm.querier.GetSignedTransactions(deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := dm.deviceKeys(dm.querier, *device)
+	if err != nil {
+		return nil, err
+	}
+
+	return auditChain(*device, transactions, func(transaction domain.SignedTransaction) error {
+		key, found := keyCovering(keys, transaction.SignCounter)
+		if !found {
+			return ErrNoKeyForSignCounter
+		}
+		signature, err := base64.StdEncoding.DecodeString(transaction.Sign)
+		if err != nil {
+			return err
+		}
+		return dm.Verifier.Verify(device.SignAlgorithm, []byte(key.PublicKey), []byte(transaction.SignedData()), signature)
+	}), nil
+}
+
+// GetDeviceKeys returns the public keys of a device, with the sign counters each one is valid for
+// It does check if the device exists, return error if it does not exist
+// It returns the retired keys in validity order, followed by the current one
+func (dm *deviceDao) GetDeviceKeys(deviceId uuid.UUID) ([]domain.DeviceKey, error) {
+	device, err := dm.getDevice(dm.querier, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return dm.deviceKeys(dm.querier, *device)
+}
+
+// deviceKeys returns the retired keys of a device in validity order, followed by the current one
+func (dm *deviceDao) deviceKeys(querier persistence.Querier, device domain.Device) ([]domain.DeviceKey, error) {
+	keys, err := querier.GetDeviceKeys(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, device.CurrentKey()), nil
+}
+
+// keyCovering returns the key which signed the transaction with the given sign counter
+func keyCovering(keys []domain.DeviceKey, signCounter int) (domain.DeviceKey, bool) {
+	for _, key := range keys {
+		if key.Covers(signCounter) {
+			return key, true
+		}
+	}
+	return domain.DeviceKey{}, false
+}
+
+// RotateDeviceKey replaces the key pair of a device, without breaking its signature chain
+// It does check if the device exists, return error if it does not exist
+// It does check if the device is active, return error if it is not
+// It does lock the device within the database transaction, checking again it is active
+// It does generate a new key pair in the key store, with the algorithm and key parameters of the device
+// It does fall back to the algorithm defaults when the device key parameters are no longer allowed
+// It does sign a rotation record announcing the new public key with the retired key, as the next transaction of the chain
+// It does keep the retired public key, valid up to the rotation record
+// It does run all database operations in a single database transaction, deleting the new key pair when it fails
+// It returns the retired and the new key, along with the rotation record
+func (dm *deviceDao) RotateDeviceKey(deviceId uuid.UUID) (*domain.KeyRotation, error) {
+	unlock := dm.lock(deviceId)
+	defer unlock()
+
+	device, err := dm.getDevice(dm.querier, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if device.Status != domain.DeviceStatusActive {
+		return nil, ErrDeviceNotActive
+	}
+
+	// Keys made before a stricter policy are replaced by keys with the defaults
+	parameters, err := dm.keysBuilder.Parameters(device.SignAlgorithm,
+		crypto.KeyParameters{RSABits: device.RSABits, Curve: device.Curve})
+	if errors.Is(err, crypto.ErrInvalidKeyParameters) {
+		parameters, err = dm.keysBuilder.Parameters(device.SignAlgorithm, crypto.KeyParameters{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keyHandle, publicKey, err := dm.generateKey(device.SignAlgorithm, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	var rotation domain.KeyRotation
+	err = dm.querier.WithTx(func(tx persistence.Querier) error {
+		// Locked, so the retired key and the status are the ones of the device now, even when changed by another instance
+		device, err := dm.getDeviceForUpdate(tx, deviceId)
+		if err != nil {
+			return err
+		}
+		if device.Status != domain.DeviceStatusActive {
+			return ErrDeviceNotActive
+		}
+
+		// The rotation record is the last transaction signed with the retired key
+		validFrom := device.SignCounter + 2
+		record, err := dm.signTransaction(tx, deviceId, domain.NewKeyRotationRecord(string(publicKey), validFrom), "")
+		if err != nil {
+			return err
+		}
+
+		retiredKey := device.CurrentKey()
+		retiredKey.ValidTo = record.SignCounter
+		if err := tx.SaveDeviceKey(retiredKey); err != nil {
+			return err
+		}
+
+		// Reload the device, its sign counter was incremented by the rotation record
+		device, err = dm.getDevice(tx, deviceId)
+		if err != nil {
+			return err
+		}
+		device.RSABits = parameters.RSABits
+		device.Curve = parameters.Curve
+		device.PublicKey = string(publicKey)
+		device.KeyHandle = keyHandle
+		device.KeyValidFrom = validFrom
+		device.UpdatedAt = dm.timestamp()
+		if err := tx.UpdateDevice(*device); err != nil {
+			return err
+		}
+
+		rotation = domain.KeyRotation{
+			DeviceID:    deviceId,
+			RetiredKey:  retiredKey,
+			CurrentKey:  device.CurrentKey(),
+			Transaction: *record,
+		}
+		return nil
+	})
+	if err != nil {
+		dm.discardKey(keyHandle)
+		return nil, err
+	}
+
+	return &rotation, nil
+}
+
+// ChangeDeviceStatus moves a device to another lifecycle state
+// It does check if the status is a lifecycle state, return error if it is not
+// It does check if the device exists, return error if it does not exist
+// It does check if the device can move to the status from its current one, return error if it cannot
+// It does lock the device within the database transaction, so the status moved from is the current one
+// It does record the change with its timestamp and reason
+// It does run all database operations in a single database transaction
+// It returns the updated device
+func (dm *deviceDao) ChangeDeviceStatus(deviceId uuid.UUID, status, reason string) (*domain.Device, error) {
+	if !domain.IsValidDeviceStatus(status) {
+		return nil, ErrInvalidDeviceStatus
+	}
+
+	// Lock the device, so no signature is made while its status changes
+	unlock := dm.lock(deviceId)
+	defer unlock()
+
+	changedAt := dm.timestamp()
+	var device *domain.Device
+	err := dm.querier.WithTx(func(tx persistence.Querier) error {
+		var err error
+		device, err = dm.getDeviceForUpdate(tx, deviceId)
+		if err != nil {
+			return err
+		}
+
+		if !domain.CanChangeDeviceStatus(device.Status, status) {
+			return ErrInvalidStatusTransition
+		}
+
+		err = tx.SaveDeviceStatusChange(domain.DeviceStatusChange{
+			ID:         uuid.New(),
+			DeviceID:   deviceId,
+			FromStatus: device.Status,
+			ToStatus:   status,
+			Reason:     reason,
+			ChangedAt:  changedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		device.Status = status
+		device.UpdatedAt = changedAt
+		return tx.UpdateDevice(*device)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// GetDeviceStatusChanges returns the lifecycle state changes of a device, oldest first
+// It does check if the device exists, return error if it does not exist
+func (dm *deviceDao) GetDeviceStatusChanges(deviceId uuid.UUID) ([]domain.DeviceStatusChange, error) {
+	if _, err := dm.getDevice(dm.querier, deviceId); err != nil {
+		return nil, err
+	}
+
+	return dm.querier.GetDeviceStatusChanges(deviceId)
+}
+
+// RewrapPrivateKeys wraps the private keys of all devices with the current key encryption key of the key store
+// It does seal the private keys stored unencrypted
+// It does leave the keys already wrapped with the current key encryption key untouched
+// It does leave the keys held by other key stores untouched
+// It does not change any public key
+// It returns the number of devices updated
+func (dm *deviceDao) RewrapPrivateKeys() (int, error) {
+	rewrapper, ok := dm.keyStore.(keyRewrapper)
+	if !ok {
+		return 0, ErrRewrapNotSupported
+	}
+
+	devices, err := dm.querier.GetDevices()
+	if err != nil {
+		return 0, err
+	}
+
+	rewrapped := 0
+	for _, device := range devices {
+		changed, err := dm.rewrapPrivateKey(rewrapper, device.ID)
+		if err != nil {
+			return rewrapped, err
+		}
+		if changed {
+			rewrapped++
+		}
+	}
+	return rewrapped, nil
+}
+
+// rewrapPrivateKey wraps the private key of a device with the current key encryption key
+// The device is locked, so no signature is made while its key is being replaced
+func (dm *deviceDao) rewrapPrivateKey(rewrapper keyRewrapper, deviceId uuid.UUID) (bool, error) {
+	unlock := dm.lock(deviceId)
+	defer unlock()
+
+	changed := false
+	err := dm.querier.WithTx(func(tx persistence.Querier) error {
+		// Locked, so the device is written back as it is now, even when changed by another instance
+		device, err := tx.GetDeviceForUpdate(deviceId)
+		if err != nil {
+			return err
+		}
+
+		keyHandle, rewrapped, err := rewrapper.Rewrap(device.KeyHandle)
+		if errors.Is(err, crypto.ErrUnknownKeyHandle) {
+			return nil
+		}
+		if err != nil || !rewrapped {
+			return err
+		}
+
+		device.KeyHandle = keyHandle
+		device.UpdatedAt = dm.timestamp()
+		changed = true
+		return tx.UpdateDevice(*device)
+	})
+	return changed, err
 }
@@ -1,16 +1,27 @@
 package dao
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha512"
 	"encoding/base64"
 	"errors"
+	"github.com/ildomm/ssccg/crypto"
 	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/metrics"
 	"github.com/ildomm/ssccg/persistence"
 	"github.com/ildomm/ssccg/test_helpers"
 	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateDevice(t *testing.T) {
@@ -18,12 +29,12 @@ func TestCreateDevice(t *testing.T) {
 	sm := NewDeviceDAO(mockQuerier)
 
 	id := uuid.New()
-	device := domain.Device{ID: id, Label: "Test Device", SignAlgorithm: "RSA"}
+	device := domain.Device{ID: id, TenantID: domain.DefaultTenant, Label: "Test Device", SignAlgorithm: "RSA"}
 
 	t.Run("SuccessfulCreation", func(t *testing.T) {
 		mockQuerier.On("GetDevice", id).Return(nil, nil).Once()
 		mockQuerier.On("SaveDevice", mock.Anything).Return(nil).Once()
-		createdDevice, err := sm.CreateDevice(id, "Test Device", "RSA")
+		createdDevice, err := sm.CreateDevice(id, "Test Device", "RSA", crypto.KeyParameters{})
 		assert.NoError(t, err)
 		assert.Equal(t, device.ID, createdDevice.ID)
 		mockQuerier.AssertExpectations(t)
@@ -31,27 +42,81 @@ func TestCreateDevice(t *testing.T) {
 
 	t.Run("AlreadyExists", func(t *testing.T) {
 		mockQuerier.On("GetDevice", id).Return(&device, nil).Once()
-		_, err := sm.CreateDevice(id, "Test Device", "RSA")
+		_, err := sm.CreateDevice(id, "Test Device", "RSA", crypto.KeyParameters{})
 		assert.Equal(t, ErrDeviceExists, err)
 		mockQuerier.AssertExpectations(t)
 	})
 
 	t.Run("UnsupportedAlgorithm", func(t *testing.T) {
 		mockQuerier.On("GetDevice", id).Return(nil, nil).Once()
-		_, err := sm.CreateDevice(id, "Test Device", "Unsupported")
+		_, err := sm.CreateDevice(id, "Test Device", "Unsupported", crypto.KeyParameters{})
 		assert.Equal(t, ErrInvalidAlgorithm, err)
 	})
+
+	t.Run("KeyParameters", func(t *testing.T) {
+		mockQuerier.On("GetDevice", id).Return(nil, nil).Once()
+		mockQuerier.On("SaveDevice", mock.Anything).Return(nil).Once()
+		createdDevice, err := sm.CreateDevice(id, "Test Device", "ECDSA", crypto.KeyParameters{Curve: "P-256"})
+		assert.NoError(t, err)
+		assert.Equal(t, "P-256", createdDevice.Curve)
+		assert.Equal(t, 0, createdDevice.RSABits)
+	})
+
+	t.Run("DefaultKeyParameters", func(t *testing.T) {
+		mockQuerier.On("GetDevice", id).Return(nil, nil).Once()
+		mockQuerier.On("SaveDevice", mock.Anything).Return(nil).Once()
+		createdDevice, err := sm.CreateDevice(id, "Test Device", "RSA", crypto.KeyParameters{})
+		assert.NoError(t, err)
+		assert.Equal(t, 2048, createdDevice.RSABits)
+	})
+
+	t.Run("InvalidKeyParameters", func(t *testing.T) {
+		mockQuerier.On("GetDevice", id).Return(nil, nil).Once()
+		_, err := sm.CreateDevice(id, "Test Device", "RSA", crypto.KeyParameters{RSABits: 1024})
+		assert.ErrorIs(t, err, crypto.ErrInvalidKeyParameters)
+	})
+
+	t.Run("CreatedConcurrently", func(t *testing.T) {
+		// Another tenant creates a device with the ID after it was checked
+		taken := device
+		taken.TenantID = "retail"
+		mockQuerier.On("GetDevice", id).Return(nil, nil).Once()
+		mockQuerier.On("SaveDevice", mock.Anything).Return(persistence.ErrDeviceExists).Once()
+		mockQuerier.On("GetDevice", id).Return(&taken, nil).Once()
+		_, err := sm.CreateDevice(id, "Test Device", "ECDSA", crypto.KeyParameters{})
+		assert.Equal(t, ErrDeviceIDUnavailable, err)
+		mockQuerier.AssertExpectations(t)
+	})
+
+	t.Run("ErrorSavingDevice", func(t *testing.T) {
+		keyStore := &generatingKeyStore{KeyStore: crypto.NewLocalKeyStore(), onGenerate: func() {}}
+		mockQuerier.On("GetDevice", id).Return(nil, nil).Once()
+		mockQuerier.On("SaveDevice", mock.Anything).Return(errors.New("database error")).Once()
+		_, err := NewDeviceDAO(mockQuerier).WithKeyStore(keyStore).CreateDevice(id, "Test Device", "ECDSA", crypto.KeyParameters{})
+		assert.Error(t, err)
+
+		// The key pair of the device not stored is not left behind
+		assert.Len(t, keyStore.generated, 1)
+		assert.Equal(t, keyStore.generated, keyStore.deleted)
+	})
 }
 
-func TestGetDevices(t *testing.T) {
+func TestListDevices(t *testing.T) {
 	mockQuerier := test_helpers.NewMockQuerier()
 	sm := NewDeviceDAO(mockQuerier)
 
+	filter := persistence.DeviceFilter{SignAlgorithm: "RSA"}
+	page := persistence.Page{After: 2, Limit: 10}
 	devices := []domain.Device{{ID: uuid.New()}, {ID: uuid.New()}}
-	mockQuerier.On("GetDevices").Return(devices, nil).Once()
-	retrievedDevices, err := sm.GetDevices()
+	mockQuerier.On("ListDevices", persistence.DeviceFilter{TenantID: domain.DefaultTenant, SignAlgorithm: "RSA"}, page).Return(devices, nil).Once()
+	retrievedDevices, err := sm.ListDevices(filter, page)
 	assert.NoError(t, err)
 	assert.Equal(t, devices, retrievedDevices)
+
+	// Listings are always scoped to the tenant of the DAO
+	mockQuerier.On("ListDevices", persistence.DeviceFilter{TenantID: "retail", SignAlgorithm: "RSA"}, page).Return(devices, nil).Once()
+	_, err = sm.ForTenant("retail").ListDevices(persistence.DeviceFilter{TenantID: domain.DefaultTenant, SignAlgorithm: "RSA"}, page)
+	assert.NoError(t, err)
 	mockQuerier.AssertExpectations(t)
 }
 
@@ -60,7 +125,7 @@ func TestGetDevice(t *testing.T) {
 	sm := NewDeviceDAO(mockQuerier)
 
 	id := uuid.New()
-	device := domain.Device{ID: id}
+	device := domain.Device{ID: id, TenantID: domain.DefaultTenant}
 	mockQuerier.On("GetDevice", id).Return(&device, nil).Once()
 	retrievedDevice, err := sm.GetDevice(id)
 	assert.NoError(t, err)
@@ -74,17 +139,19 @@ func TestCreateSignedTransaction(t *testing.T) {
 
 	deviceID := uuid.New()
 	// GeneratePairs key pair
-	privateKey, publicKey, err := sm.keysBuilder.Build("RSA")
+	keyHandle, publicKey, err := sm.keyStore.Generate("RSA", crypto.KeyParameters{})
 	assert.NoError(t, err)
 
 	// Build device
 	device := domain.Device{
 		ID:            deviceID,
+		TenantID:      domain.DefaultTenant,
 		Label:         "Test Device",
 		SignAlgorithm: "RSA",
-		PrivateKey:    string(privateKey),
+		KeyHandle:     keyHandle,
 		PublicKey:     string(publicKey),
 		SignCounter:   0,
+		Status:        domain.DeviceStatusActive,
 	}
 
 	data := []byte("test data")
@@ -93,8 +160,8 @@ func TestCreateSignedTransaction(t *testing.T) {
 		mockQuerier = test_helpers.NewMockQuerier()
 		sm = NewDeviceDAO(mockQuerier)
 
-		mockQuerier.On("GetDevice", deviceID).Return(&device, nil).Once()
-		mockQuerier.On("UpdateDevice", mock.Anything).Return(nil).Once()
+		mockQuerier.On("GetDeviceForUpdate", deviceID).Return(&device, nil).Once()
+		mockQuerier.On("UpdateDeviceSignCounter", mock.Anything).Return(nil).Once()
 		mockQuerier.On("GetSignedTransaction", deviceID, mock.Anything).Return(nil, nil).Once()
 		mockQuerier.On("SaveSignedTransaction", mock.Anything).Return(uuid.New(), nil).Once()
 		transaction, err := sm.CreateSignedTransaction(deviceID, data)
@@ -107,35 +174,47 @@ func TestCreateSignedTransaction(t *testing.T) {
 		mockQuerier = test_helpers.NewMockQuerier()
 		sm = NewDeviceDAO(mockQuerier)
 
-		mockQuerier.On("GetDevice", deviceID).Return(nil, nil).Once()
+		mockQuerier.On("GetDeviceForUpdate", deviceID).Return(nil, nil).Once()
 		_, err := sm.CreateSignedTransaction(deviceID, data)
 		assert.Equal(t, persistence.ErrDeviceNotFound, err)
 		mockQuerier.AssertExpectations(t)
 	})
 
+	t.Run("DeviceNotActive", func(t *testing.T) {
+		mockQuerier = test_helpers.NewMockQuerier()
+		sm = NewDeviceDAO(mockQuerier)
+
+		suspended := device
+		suspended.Status = domain.DeviceStatusSuspended
+		mockQuerier.On("GetDeviceForUpdate", deviceID).Return(&suspended, nil).Once()
+		_, err := sm.CreateSignedTransaction(deviceID, data)
+		assert.Equal(t, ErrDeviceNotActive, err)
+		mockQuerier.AssertNotCalled(t, "SaveSignedTransaction", mock.Anything)
+	})
+
 	t.Run("ErrorSavingTransaction", func(t *testing.T) {
 		mockQuerier = test_helpers.NewMockQuerier()
 		sm = NewDeviceDAO(mockQuerier)
 
-		mockQuerier.On("GetDevice", deviceID).Return(&device, nil).Once()
+		mockQuerier.On("GetDeviceForUpdate", deviceID).Return(&device, nil).Once()
 		mockQuerier.On("GetSignedTransaction", deviceID, mock.Anything).Return(nil, nil).Once()
 		mockQuerier.On("SaveSignedTransaction", mock.Anything).Return(uuid.Nil, errors.New("database error")).Once()
 
 		_, err := sm.CreateSignedTransaction(deviceID, data)
 		assert.Error(t, err)
-		mockQuerier.AssertNotCalled(t, "UpdateDevice", mock.Anything)
+		mockQuerier.AssertNotCalled(t, "UpdateDeviceSignCounter", mock.Anything)
 	})
 
 	t.Run("ErrorUpdatingDevice", func(t *testing.T) {
 		mockQuerier = test_helpers.NewMockQuerier()
 		sm = NewDeviceDAO(mockQuerier)
 
-		mockQuerier.On("GetDevice", deviceID).Return(&device, nil).Once()
+		mockQuerier.On("GetDeviceForUpdate", deviceID).Return(&device, nil).Once()
 		mockQuerier.On("GetSignedTransaction", deviceID, mock.Anything).Return(nil, nil).Once()
 		mockQuerier.On("SaveSignedTransaction", mock.Anything).Return(uuid.New(), nil).Once()
 
 		// Simulating error in updating the device
-		mockQuerier.On("UpdateDevice", mock.Anything).Return(errors.New("database error")).Once()
+		mockQuerier.On("UpdateDeviceSignCounter", mock.Anything).Return(errors.New("database error")).Once()
 
 		_, err := sm.CreateSignedTransaction(deviceID, data)
 		assert.Error(t, err)
@@ -153,7 +232,7 @@ func TestPreviousDeviceSignature(t *testing.T) {
 	t.Run("NoPreviousSignature", func(t *testing.T) {
 		mockQuerier.On("GetSignedTransaction", deviceId, mock.AnythingOfType("int")).Return(nil, nil).Once()
 
-		signature, err := dao.previousDeviceSignature(deviceId, 1)
+		signature, err := dao.previousDeviceSignature(mockQuerier, deviceId, 1)
 		assert.NoError(t, err)
 		expected := base64.StdEncoding.EncodeToString([]byte(deviceId.String()))
 		assert.Equal(t, expected, signature)
@@ -162,7 +241,7 @@ func TestPreviousDeviceSignature(t *testing.T) {
 	t.Run("PreviousSignatureExists", func(t *testing.T) {
 		mockQuerier.On("GetSignedTransaction", deviceId, mock.AnythingOfType("int")).Return(&domain.SignedTransaction{Sign: prevSignature}, nil).Once()
 
-		signature, err := dao.previousDeviceSignature(deviceId, 1)
+		signature, err := dao.previousDeviceSignature(mockQuerier, deviceId, 1)
 		assert.NoError(t, err)
 		assert.Equal(t, prevSignature, signature)
 	})
@@ -170,21 +249,972 @@ func TestPreviousDeviceSignature(t *testing.T) {
 	t.Run("ErrorFetchingTransaction", func(t *testing.T) {
 		mockQuerier.On("GetSignedTransaction", deviceId, mock.AnythingOfType("int")).Return(nil, errors.New("database error")).Once()
 
-		_, err := dao.previousDeviceSignature(deviceId, 1)
+		_, err := dao.previousDeviceSignature(mockQuerier, deviceId, 1)
 		assert.Error(t, err)
 	})
 }
 
-func TestGetSignedTransactions(t *testing.T) {
+func TestListSignedTransactions(t *testing.T) {
 	mockQuerier := test_helpers.NewMockQuerier()
 	sm := NewDeviceDAO(mockQuerier)
 
 	deviceID := uuid.New()
+	filter := persistence.SignedTransactionFilter{FromSignCounter: 3, ToSignCounter: 9}
+	page := persistence.Page{After: 4, Limit: 2}
 	transactions := []domain.SignedTransaction{{ID: uuid.New()}, {ID: uuid.New()}}
-	mockQuerier.On("GetSignedTransactions", deviceID).Return(transactions, nil).Once()
+	mockQuerier.On("GetDevice", deviceID).Return(&domain.Device{ID: deviceID, TenantID: domain.DefaultTenant}, nil).Once()
+	mockQuerier.On("ListSignedTransactions", deviceID, filter, page).Return(transactions, nil).Once()
 
-	retrievedTransactions, err := sm.GetSignedTransactions(deviceID)
+	retrievedTransactions, err := sm.ListSignedTransactions(deviceID, filter, page)
 	assert.NoError(t, err)
 	assert.Equal(t, transactions, retrievedTransactions)
 	mockQuerier.AssertExpectations(t)
+
+	mockQuerier.On("GetDevice", mock.Anything).Return(nil, persistence.ErrDeviceNotFound).Once()
+	_, err = sm.ListSignedTransactions(uuid.New(), filter, page)
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+}
+
+func TestCreateSignedTransactionChainsInMemory(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	deviceID := uuid.New()
+	_, err := sm.CreateDevice(deviceID, "Test Device", "ECDSA", crypto.KeyParameters{})
+	assert.NoError(t, err)
+
+	first, err := sm.CreateSignedTransaction(deviceID, []byte("first"))
+	assert.NoError(t, err)
+	second, err := sm.CreateSignedTransaction(deviceID, []byte("second"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, first.SignCounter)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(deviceID.String())), first.PreviousDeviceSign)
+	assert.Equal(t, 2, second.SignCounter)
+	assert.Equal(t, first.Sign, second.PreviousDeviceSign)
+
+	device, _ := sm.GetDevice(deviceID)
+	assert.Equal(t, 2, device.SignCounter)
+	transactions, _ := querier.GetSignedTransactions(deviceID)
+	assert.Equal(t, []domain.SignedTransaction{*first, *second}, transactions)
+}
+
+func TestCreateSignedTransactionConcurrentlyOnSameDevice(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	deviceID := uuid.New()
+	_, err := sm.CreateDevice(deviceID, "Test Device", "ECDSA", crypto.KeyParameters{})
+	assert.NoError(t, err)
+
+	const signers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < signers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := sm.CreateSignedTransaction(deviceID, []byte("data"))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Every counter is used exactly once and each transaction links to the previous one
+	transactions, _ := querier.GetSignedTransactions(deviceID)
+	assert.Len(t, transactions, signers)
+	for i, transaction := range transactions {
+		assert.Equal(t, i+1, transaction.SignCounter)
+		if i > 0 {
+			assert.Equal(t, transactions[i-1].Sign, transaction.PreviousDeviceSign)
+		}
+	}
+}
+
+func TestCreateDeviceConcurrentlyWithSameID(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	deviceID := uuid.New()
+	const creators = 20
+	errs := make(chan error, creators)
+	var wg sync.WaitGroup
+	for i := 0; i < creators; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := sm.CreateDevice(deviceID, "Test Device", "ED25519", crypto.KeyParameters{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// A single device is created, the other creations are refused
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.Equal(t, ErrDeviceExists, err)
+	}
+	assert.Equal(t, 1, created)
+}
+
+// BenchmarkCreateSignedTransactionParallel signs on one device per goroutine.
+// As devices do not share a lock, throughput should scale with GOMAXPROCS:
+//
+//	go test -run=^$ -bench=CreateSignedTransactionParallel -cpu=1,2,4,8 ./dao
+func BenchmarkCreateSignedTransactionParallel(b *testing.B) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+	data := []byte("benchmark data")
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		deviceID := uuid.New()
+		if _, err := sm.CreateDevice(deviceID, "Benchmark Device", "ECDSA", crypto.KeyParameters{}); err != nil {
+			b.Error(err)
+			return
+		}
+
+		for pb.Next() {
+			if _, err := sm.CreateSignedTransaction(deviceID, data); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func TestGetSignedTransaction(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	deviceID := uuid.New()
+	_, err := sm.CreateDevice(deviceID, "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+	transaction, err := sm.CreateSignedTransaction(deviceID, []byte("test data"))
+	require.NoError(t, err)
+
+	t.Run("ByCounter", func(t *testing.T) {
+		retrieved, err := sm.GetSignedTransaction(deviceID, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, transaction, retrieved)
+
+		_, err = sm.GetSignedTransaction(deviceID, 2)
+		assert.Equal(t, ErrSignedTransactionNotFound, err)
+		_, err = sm.GetSignedTransaction(uuid.New(), 1)
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	})
+
+	t.Run("ByID", func(t *testing.T) {
+		retrieved, err := sm.GetSignedTransactionByID(transaction.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, transaction, retrieved)
+
+		_, err = sm.GetSignedTransactionByID(uuid.New())
+		assert.Equal(t, ErrSignedTransactionNotFound, err)
+	})
+
+	t.Run("VerifyOtherDeviceTransaction", func(t *testing.T) {
+		otherID := uuid.New()
+		_, err := sm.CreateDevice(otherID, "Other Device", "ED25519", crypto.KeyParameters{})
+		require.NoError(t, err)
+
+		_, err = sm.VerifySignedTransaction(otherID, domain.SignatureVerificationRequest{TransactionID: transaction.ID})
+		assert.Equal(t, ErrSignedTransactionNotFound, err)
+	})
+}
+
+func TestVerifySignedTransaction(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	for _, algorithm := range []string{"RSA", "ECDSA", "RSA-PSS-SHA384", "ECDSA-P256-SHA3-256"} {
+		deviceID := uuid.New()
+		_, err := sm.CreateDevice(deviceID, "Test Device", algorithm, crypto.KeyParameters{})
+		assert.NoError(t, err)
+		transaction, err := sm.CreateSignedTransaction(deviceID, []byte("test data"))
+		assert.NoError(t, err)
+
+		t.Run(algorithm+"ByTransactionID", func(t *testing.T) {
+			verification, err := sm.VerifySignedTransaction(deviceID,
+				domain.SignatureVerificationRequest{TransactionID: transaction.ID})
+			assert.NoError(t, err)
+			assert.True(t, verification.Valid)
+			assert.Empty(t, verification.Reason)
+			assert.Equal(t, &transaction.ID, verification.TransactionID)
+			assert.Equal(t, 1, verification.SignCounter)
+		})
+
+		t.Run(algorithm+"BySignedData", func(t *testing.T) {
+			verification, err := sm.VerifySignedTransaction(deviceID, domain.SignatureVerificationRequest{
+				SignedData: []byte(transaction.SignedData()),
+				Signature:  transaction.Sign,
+			})
+			assert.NoError(t, err)
+			assert.True(t, verification.Valid)
+			assert.Nil(t, verification.TransactionID)
+		})
+
+		t.Run(algorithm+"TamperedData", func(t *testing.T) {
+			verification, err := sm.VerifySignedTransaction(deviceID, domain.SignatureVerificationRequest{
+				SignedData: []byte("1_tampered data_" + transaction.PreviousDeviceSign),
+				Signature:  transaction.Sign,
+			})
+			assert.NoError(t, err)
+			assert.False(t, verification.Valid)
+			assert.Equal(t, domain.VerificationReasonSignatureMismatch, verification.Reason)
+		})
+
+		t.Run(algorithm+"MalformedSignature", func(t *testing.T) {
+			verification, err := sm.VerifySignedTransaction(deviceID, domain.SignatureVerificationRequest{
+				SignedData: []byte(transaction.SignedData()),
+				Signature:  "not base64!",
+			})
+			assert.NoError(t, err)
+			assert.False(t, verification.Valid)
+			assert.Equal(t, domain.VerificationReasonMalformedSignature, verification.Reason)
+		})
+
+		t.Run(algorithm+"UnknownTransaction", func(t *testing.T) {
+			_, err := sm.VerifySignedTransaction(deviceID,
+				domain.SignatureVerificationRequest{TransactionID: uuid.New()})
+			assert.Equal(t, ErrSignedTransactionNotFound, err)
+		})
+	}
+
+	t.Run("InvalidRequest", func(t *testing.T) {
+		_, err := sm.VerifySignedTransaction(uuid.New(), domain.SignatureVerificationRequest{})
+		assert.Equal(t, ErrInvalidVerificationRequest, err)
+
+		_, err = sm.VerifySignedTransaction(uuid.New(), domain.SignatureVerificationRequest{Signature: "signature"})
+		assert.Equal(t, ErrInvalidVerificationRequest, err)
+
+		_, err = sm.VerifySignedTransaction(uuid.New(), domain.SignatureVerificationRequest{
+			TransactionID: uuid.New(), SignedData: []byte("data"), Signature: "signature",
+		})
+		assert.Equal(t, ErrInvalidVerificationRequest, err)
+	})
+
+	t.Run("DeviceNotFound", func(t *testing.T) {
+		_, err := sm.VerifySignedTransaction(uuid.New(),
+			domain.SignatureVerificationRequest{TransactionID: uuid.New()})
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	})
+}
+
+func TestAuditSignedTransactions(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	deviceID := uuid.New()
+	_, err := sm.CreateDevice(deviceID, "Test Device", "ECDSA", crypto.KeyParameters{})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := sm.CreateSignedTransaction(deviceID, []byte("test data"))
+		assert.NoError(t, err)
+	}
+
+	t.Run("ValidChain", func(t *testing.T) {
+		audit, err := sm.AuditSignedTransactions(deviceID)
+		assert.NoError(t, err)
+		assert.True(t, audit.Valid)
+		assert.Equal(t, 3, audit.TransactionsChecked)
+	})
+
+	t.Run("ForgedTransaction", func(t *testing.T) {
+		last, _ := querier.GetSignedTransaction(deviceID, 3)
+		_, err := querier.SaveSignedTransaction(domain.SignedTransaction{
+			ID:                 uuid.New(),
+			DeviceID:           deviceID,
+			RawData:            []byte("forged data"),
+			SignCounter:        4,
+			PreviousDeviceSign: last.Sign,
+			Sign:               last.Sign,
+		})
+		assert.NoError(t, err)
+
+		audit, err := sm.AuditSignedTransactions(deviceID)
+		assert.NoError(t, err)
+		assert.False(t, audit.Valid)
+		assert.Equal(t, 4, *audit.FirstInvalidCounter)
+		assert.Equal(t, []string{domain.AuditIssueInvalidSignature, domain.AuditIssueCounterMismatch}, issueKinds(audit))
+	})
+
+	t.Run("DeviceNotFound", func(t *testing.T) {
+		_, err := sm.AuditSignedTransactions(uuid.New())
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	})
+}
+
+func TestCreateDeviceWithKeyEnvelope(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	envelope, err := crypto.NewKeyEnvelope(bytes.Repeat([]byte{1}, crypto.KEKSize))
+	require.NoError(t, err)
+	sm := NewDeviceDAO(querier).WithKeyStore(crypto.NewLocalKeyStore().WithEnvelope(envelope))
+
+	deviceID := uuid.New()
+	_, err = sm.CreateDevice(deviceID, "Test Device", "ECDSA", crypto.KeyParameters{})
+	require.NoError(t, err)
+
+	// The private key is stored sealed
+	stored, _ := querier.GetDevice(deviceID)
+	assert.True(t, strings.HasPrefix(stored.KeyHandle, crypto.LocalKeyStoreName+":"))
+	assert.True(t, crypto.IsSealed([]byte(strings.TrimPrefix(stored.KeyHandle, crypto.LocalKeyStoreName+":"))))
+
+	transaction, err := sm.CreateSignedTransaction(deviceID, []byte("test data"))
+	require.NoError(t, err)
+	verification, err := sm.VerifySignedTransaction(deviceID, domain.SignatureVerificationRequest{TransactionID: transaction.ID})
+	assert.NoError(t, err)
+	assert.True(t, verification.Valid)
+}
+
+func TestRewrapPrivateKeys(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	previousKEK := bytes.Repeat([]byte{1}, crypto.KEKSize)
+	previous, _ := crypto.NewKeyEnvelope(previousKEK)
+
+	// One device sealed with the previous key encryption key, one stored before keys were encrypted
+	sealedID, plainID := uuid.New(), uuid.New()
+	_, err := NewDeviceDAO(querier).WithKeyStore(crypto.NewLocalKeyStore().WithEnvelope(previous)).CreateDevice(sealedID, "Sealed", "ECDSA", crypto.KeyParameters{})
+	require.NoError(t, err)
+	_, err = NewDeviceDAO(querier).CreateDevice(plainID, "Plain", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+	before, _ := querier.GetDevices()
+
+	current, _ := crypto.NewKeyEnvelope(bytes.Repeat([]byte{2}, crypto.KEKSize))
+	current, err = current.WithPreviousKEK(previousKEK)
+	require.NoError(t, err)
+	sm := NewDeviceDAO(querier).WithKeyStore(crypto.NewLocalKeyStore().WithEnvelope(current))
+
+	rewrapped, err := sm.RewrapPrivateKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rewrapped)
+
+	for _, device := range before {
+		stored, _ := querier.GetDevice(device.ID)
+		assert.Equal(t, device.PublicKey, stored.PublicKey)
+		assert.Contains(t, stored.KeyHandle, current.CurrentKEKID())
+
+		transaction, err := sm.CreateSignedTransaction(device.ID, []byte("test data"))
+		require.NoError(t, err)
+		verification, err := sm.VerifySignedTransaction(device.ID, domain.SignatureVerificationRequest{TransactionID: transaction.ID})
+		assert.NoError(t, err)
+		assert.True(t, verification.Valid)
+	}
+
+	// Nothing is left to wrap again
+	rewrapped, err = sm.RewrapPrivateKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rewrapped)
+}
+
+func TestRewrapPrivateKeysWithoutEnvelope(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+	_, err := sm.CreateDevice(uuid.New(), "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+
+	_, err = sm.RewrapPrivateKeys()
+	assert.Equal(t, crypto.ErrKeyEnvelopeMissing, err)
+}
+
+func TestRewrapPrivateKeysSkipsOtherKeyStores(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "ECDSA", KeyHandle: "pkcs11:00ff"}
+	require.NoError(t, querier.SaveDevice(device))
+
+	envelope, _ := crypto.NewKeyEnvelope(bytes.Repeat([]byte{1}, crypto.KEKSize))
+	rewrapped, err := NewDeviceDAO(querier).WithKeyStore(crypto.NewLocalKeyStore().WithEnvelope(envelope)).RewrapPrivateKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rewrapped)
+
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, device.KeyHandle, stored.KeyHandle)
+}
+
+func TestRotateDeviceKey(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	deviceID := uuid.New()
+	created, err := sm.CreateDevice(deviceID, "Test Device", "ECDSA", crypto.KeyParameters{Curve: "P-256"})
+	require.NoError(t, err)
+	var transactions []domain.SignedTransaction
+	for i := 0; i < 2; i++ {
+		transaction, err := sm.CreateSignedTransaction(deviceID, []byte("test data"))
+		require.NoError(t, err)
+		transactions = append(transactions, *transaction)
+	}
+
+	rotation, err := sm.RotateDeviceKey(deviceID)
+	require.NoError(t, err)
+	transactions = append(transactions, rotation.Transaction)
+	transaction, err := sm.CreateSignedTransaction(deviceID, []byte("test data"))
+	require.NoError(t, err)
+	transactions = append(transactions, *transaction)
+
+	t.Run("Keys", func(t *testing.T) {
+		assert.Equal(t, domain.DeviceKey{DeviceID: deviceID, PublicKey: created.PublicKey, ValidFrom: 1, ValidTo: 3}, rotation.RetiredKey)
+		assert.Equal(t, 4, rotation.CurrentKey.ValidFrom)
+		assert.NotEqual(t, created.PublicKey, rotation.CurrentKey.PublicKey)
+
+		keys, err := sm.GetDeviceKeys(deviceID)
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.DeviceKey{rotation.RetiredKey, rotation.CurrentKey}, keys)
+
+		stored, _ := querier.GetDevice(deviceID)
+		assert.Equal(t, 4, stored.SignCounter)
+		assert.Equal(t, "P-256", stored.Curve)
+		assert.Equal(t, rotation.CurrentKey.PublicKey, stored.PublicKey)
+	})
+
+	t.Run("RotationRecord", func(t *testing.T) {
+		assert.Equal(t, 3, rotation.Transaction.SignCounter)
+		assert.Equal(t, transactions[1].Sign, rotation.Transaction.PreviousDeviceSign)
+		assert.Equal(t, domain.NewKeyRotationRecord(rotation.CurrentKey.PublicKey, 4), rotation.Transaction.RawData)
+		assert.Equal(t, rotation.Transaction.Sign, transaction.PreviousDeviceSign)
+	})
+
+	t.Run("VerifyByTransactionID", func(t *testing.T) {
+		for _, transaction := range transactions {
+			verification, err := sm.VerifySignedTransaction(deviceID,
+				domain.SignatureVerificationRequest{TransactionID: transaction.ID})
+			assert.NoError(t, err)
+			assert.True(t, verification.Valid, "sign counter %d", transaction.SignCounter)
+		}
+	})
+
+	t.Run("VerifyBySignedData", func(t *testing.T) {
+		for _, transaction := range transactions {
+			verification, err := sm.VerifySignedTransaction(deviceID, domain.SignatureVerificationRequest{
+				SignedData: []byte(transaction.SignedData()),
+				Signature:  transaction.Sign,
+			})
+			assert.NoError(t, err)
+			assert.True(t, verification.Valid, "sign counter %d", transaction.SignCounter)
+		}
+	})
+
+	t.Run("Audit", func(t *testing.T) {
+		audit, err := sm.AuditSignedTransactions(deviceID)
+		assert.NoError(t, err)
+		assert.True(t, audit.Valid)
+		assert.Equal(t, 4, audit.TransactionsChecked)
+	})
+
+	t.Run("DeviceNotFound", func(t *testing.T) {
+		_, err := sm.RotateDeviceKey(uuid.New())
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+		_, err = sm.GetDeviceKeys(uuid.New())
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	})
+}
+
+func TestRotateDeviceKeyBelowPolicy(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	// Devices created before the key size policy signed with 512 bit keys
+	deviceID := uuid.New()
+	device, err := sm.CreateDevice(deviceID, "Test Device", "RSA", crypto.KeyParameters{})
+	require.NoError(t, err)
+	device.RSABits = 512
+	require.NoError(t, querier.UpdateDevice(*device))
+
+	_, err = sm.RotateDeviceKey(deviceID)
+	require.NoError(t, err)
+
+	stored, _ := querier.GetDevice(deviceID)
+	assert.Equal(t, 2048, stored.RSABits)
+}
+
+// generatingKeyStore runs onGenerate before generating each key pair with the key store it wraps,
+// and keeps the handles of the key pairs generated and deleted
+type generatingKeyStore struct {
+	crypto.KeyStore
+	onGenerate func()
+	generated  []string
+	deleted    []string
+}
+
+func (s *generatingKeyStore) Generate(algorithm string, parameters crypto.KeyParameters) (string, []byte, error) {
+	s.onGenerate()
+	handle, publicKey, err := s.KeyStore.Generate(algorithm, parameters)
+	s.generated = append(s.generated, handle)
+	return handle, publicKey, err
+}
+
+func (s *generatingKeyStore) Delete(handle string) error {
+	s.deleted = append(s.deleted, handle)
+	return s.KeyStore.Delete(handle)
+}
+
+func TestRotateDeviceKeySuspendedMeanwhile(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	deviceID := uuid.New()
+	created, err := NewDeviceDAO(querier).CreateDevice(deviceID, "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+
+	// Another instance suspends the device while the new key is generated
+	keyStore := &generatingKeyStore{KeyStore: crypto.NewLocalKeyStore(), onGenerate: func() {
+		suspended, _ := querier.GetDevice(deviceID)
+		suspended.Status = domain.DeviceStatusSuspended
+		_ = querier.UpdateDevice(*suspended)
+	}}
+	_, err = NewDeviceDAO(querier).WithKeyStore(keyStore).RotateDeviceKey(deviceID)
+	assert.Equal(t, ErrDeviceNotActive, err)
+
+	stored, _ := querier.GetDevice(deviceID)
+	assert.Equal(t, domain.DeviceStatusSuspended, stored.Status)
+	assert.Equal(t, created.KeyHandle, stored.KeyHandle)
+	assert.Equal(t, 0, stored.SignCounter)
+
+	// The key pair generated for the rotation is not left behind
+	assert.Len(t, keyStore.generated, 1)
+	assert.Equal(t, keyStore.generated, keyStore.deleted)
+}
+
+func TestChangeDeviceStatus(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	changedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sm := NewDeviceDAO(querier).WithClock(func() time.Time { return changedAt })
+
+	deviceID := uuid.New()
+	created, err := sm.CreateDevice(deviceID, "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+	assert.Equal(t, domain.DeviceStatusActive, created.Status)
+
+	t.Run("Suspend", func(t *testing.T) {
+		device, err := sm.ChangeDeviceStatus(deviceID, domain.DeviceStatusSuspended, "device lost")
+		assert.NoError(t, err)
+		assert.Equal(t, domain.DeviceStatusSuspended, device.Status)
+
+		_, err = sm.CreateSignedTransaction(deviceID, []byte("test data"))
+		assert.Equal(t, ErrDeviceNotActive, err)
+		_, err = sm.RotateDeviceKey(deviceID)
+		assert.Equal(t, ErrDeviceNotActive, err)
+	})
+
+	t.Run("Reactivate", func(t *testing.T) {
+		_, err := sm.ChangeDeviceStatus(deviceID, domain.DeviceStatusActive, "device found")
+		assert.NoError(t, err)
+
+		_, err = sm.CreateSignedTransaction(deviceID, []byte("test data"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Decommission", func(t *testing.T) {
+		_, err := sm.ChangeDeviceStatus(deviceID, domain.DeviceStatusDecommissioned, "end of life")
+		assert.NoError(t, err)
+
+		_, err = sm.CreateSignedTransaction(deviceID, []byte("test data"))
+		assert.Equal(t, ErrDeviceNotActive, err)
+
+		// Decommissioning is terminal
+		_, err = sm.ChangeDeviceStatus(deviceID, domain.DeviceStatusActive, "")
+		assert.Equal(t, ErrInvalidStatusTransition, err)
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		changes, err := sm.GetDeviceStatusChanges(deviceID)
+		assert.NoError(t, err)
+		require.Len(t, changes, 3)
+		assert.Equal(t, domain.DeviceStatusActive, changes[0].FromStatus)
+		assert.Equal(t, domain.DeviceStatusSuspended, changes[0].ToStatus)
+		assert.Equal(t, "device lost", changes[0].Reason)
+		assert.Equal(t, changedAt, changes[0].ChangedAt)
+		assert.Equal(t, domain.DeviceStatusDecommissioned, changes[2].ToStatus)
+	})
+
+	t.Run("InvalidStatus", func(t *testing.T) {
+		_, err := sm.ChangeDeviceStatus(deviceID, "lost", "")
+		assert.Equal(t, ErrInvalidDeviceStatus, err)
+	})
+
+	t.Run("DeviceNotFound", func(t *testing.T) {
+		_, err := sm.ChangeDeviceStatus(uuid.New(), domain.DeviceStatusSuspended, "")
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+		_, err = sm.GetDeviceStatusChanges(uuid.New())
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	})
+}
+
+func TestCreateIdempotentSignedTransaction(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sm := NewDeviceDAO(querier).
+		WithClock(func() time.Time { return now }).
+		WithIdempotencyRetention(time.Hour)
+
+	deviceID := uuid.New()
+	_, err := sm.CreateDevice(deviceID, "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+
+	first, replayed, err := sm.CreateIdempotentSignedTransaction(deviceID, "retry-1", []byte("test data"))
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, 1, first.SignCounter)
+
+	t.Run("Replay", func(t *testing.T) {
+		again, replayed, err := sm.CreateIdempotentSignedTransaction(deviceID, "retry-1", []byte("test data"))
+		assert.NoError(t, err)
+		assert.True(t, replayed)
+		assert.Equal(t, first, again)
+
+		device, _ := sm.GetDevice(deviceID)
+		assert.Equal(t, 1, device.SignCounter)
+	})
+
+	t.Run("DifferentData", func(t *testing.T) {
+		_, _, err := sm.CreateIdempotentSignedTransaction(deviceID, "retry-1", []byte("other data"))
+		assert.Equal(t, ErrIdempotencyKeyReused, err)
+	})
+
+	t.Run("OtherDevice", func(t *testing.T) {
+		otherID := uuid.New()
+		_, err := sm.CreateDevice(otherID, "Other Device", "ED25519", crypto.KeyParameters{})
+		require.NoError(t, err)
+
+		transaction, replayed, err := sm.CreateIdempotentSignedTransaction(otherID, "retry-1", []byte("other data"))
+		assert.NoError(t, err)
+		assert.False(t, replayed)
+		assert.Equal(t, otherID, transaction.DeviceID)
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		_, _, err := sm.CreateIdempotentSignedTransaction(deviceID, "", []byte("test data"))
+		assert.Equal(t, ErrInvalidIdempotencyKey, err)
+		_, _, err = sm.CreateIdempotentSignedTransaction(deviceID, strings.Repeat("k", MaxIdempotencyKeyLength+1), []byte("test data"))
+		assert.Equal(t, ErrInvalidIdempotencyKey, err)
+	})
+
+	t.Run("DeviceNotFound", func(t *testing.T) {
+		_, _, err := sm.CreateIdempotentSignedTransaction(uuid.New(), "retry-1", []byte("test data"))
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		now = now.Add(time.Hour)
+
+		transaction, replayed, err := sm.CreateIdempotentSignedTransaction(deviceID, "retry-1", []byte("other data"))
+		assert.NoError(t, err)
+		assert.False(t, replayed)
+		assert.Equal(t, 2, transaction.SignCounter)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+
+		purged, err := sm.PurgeIdempotencyKeys()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, purged)
+	})
+}
+
+// failingKeyStore refuses to sign the transactions of raw data "fail", and signs everything else with the local key store
+type failingKeyStore struct {
+	crypto.KeyStore
+}
+
+func (s failingKeyStore) Sign(algorithm, handle string, dataToBeSigned []byte) ([]byte, error) {
+	if bytes.Contains(dataToBeSigned, []byte(`"raw_data":"`+base64.StdEncoding.EncodeToString([]byte("fail"))+`"`)) {
+		return nil, errors.New("signing failed")
+	}
+	return s.KeyStore.Sign(algorithm, handle, dataToBeSigned)
+}
+
+func TestCreateSignedTransactions(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier).WithKeyStore(failingKeyStore{crypto.NewLocalKeyStore()})
+
+	deviceID := uuid.New()
+	_, err := sm.CreateDevice(deviceID, "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+
+	t.Run("Atomic", func(t *testing.T) {
+		results, err := sm.CreateSignedTransactions(deviceID, [][]byte{[]byte("first"), []byte("second"), []byte("third")}, domain.BatchModeAtomic)
+		assert.NoError(t, err)
+		require.Len(t, results, 3)
+		for i, result := range results {
+			assert.NoError(t, result.Err)
+			assert.Equal(t, i+1, result.Transaction.SignCounter)
+			if i > 0 {
+				assert.Equal(t, results[i-1].Transaction.Sign, result.Transaction.PreviousDeviceSign)
+			}
+		}
+
+		audit, err := sm.AuditSignedTransactions(deviceID)
+		assert.NoError(t, err)
+		assert.True(t, audit.Valid)
+	})
+
+	t.Run("AtomicRollsBack", func(t *testing.T) {
+		_, err := sm.CreateSignedTransactions(deviceID, [][]byte{[]byte("fourth"), []byte("fail"), []byte("sixth")}, domain.BatchModeAtomic)
+		var itemErr *BatchItemError
+		require.ErrorAs(t, err, &itemErr)
+		assert.Equal(t, 1, itemErr.Index)
+
+		device, _ := sm.GetDevice(deviceID)
+		assert.Equal(t, 3, device.SignCounter)
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		results, err := sm.CreateSignedTransactions(deviceID, [][]byte{[]byte("fourth"), []byte("fail"), []byte("fifth")}, domain.BatchModePartial)
+		assert.NoError(t, err)
+		require.Len(t, results, 3)
+		assert.Equal(t, 4, results[0].Transaction.SignCounter)
+		assert.Error(t, results[1].Err)
+		assert.Nil(t, results[1].Transaction)
+		assert.Equal(t, 5, results[2].Transaction.SignCounter)
+		assert.Equal(t, results[0].Transaction.Sign, results[2].Transaction.PreviousDeviceSign)
+	})
+
+	t.Run("InvalidBatch", func(t *testing.T) {
+		_, err := sm.CreateSignedTransactions(deviceID, nil, domain.BatchModeAtomic)
+		assert.Equal(t, ErrInvalidBatch, err)
+		_, err = sm.CreateSignedTransactions(deviceID, make([][]byte, MaxBatchSize+1), domain.BatchModeAtomic)
+		assert.Equal(t, ErrInvalidBatch, err)
+		_, err = sm.CreateSignedTransactions(deviceID, [][]byte{[]byte("data")}, "all")
+		assert.Equal(t, ErrInvalidBatchMode, err)
+	})
+
+	t.Run("DeviceNotFound", func(t *testing.T) {
+		_, err := sm.CreateSignedTransactions(uuid.New(), [][]byte{[]byte("data")}, domain.BatchModePartial)
+		assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	})
+
+	t.Run("DeviceNotActive", func(t *testing.T) {
+		_, err := sm.ChangeDeviceStatus(deviceID, domain.DeviceStatusSuspended, "")
+		require.NoError(t, err)
+
+		_, err = sm.CreateSignedTransactions(deviceID, [][]byte{[]byte("data")}, domain.BatchModePartial)
+		assert.Equal(t, ErrDeviceNotActive, err)
+	})
+}
+
+func TestTimestamps(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := createdAt
+	sm := NewDeviceDAO(querier).WithClock(func() time.Time { return now })
+
+	deviceID := uuid.New()
+	device, err := sm.CreateDevice(deviceID, "Test Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+	assert.Equal(t, createdAt, device.CreatedAt)
+	assert.Equal(t, createdAt, device.UpdatedAt)
+
+	now = createdAt.Add(time.Hour)
+	transaction, err := sm.CreateSignedTransaction(deviceID, []byte("test data"))
+	require.NoError(t, err)
+	assert.Equal(t, now, transaction.CreatedAt)
+
+	device, _ = sm.GetDevice(deviceID)
+	assert.Equal(t, createdAt, device.CreatedAt)
+	assert.Equal(t, now, device.UpdatedAt)
+
+	now = createdAt.Add(2 * time.Hour)
+	device, err = sm.ChangeDeviceStatus(deviceID, domain.DeviceStatusSuspended, "")
+	require.NoError(t, err)
+	assert.Equal(t, now, device.UpdatedAt)
+}
+
+func TestSignedDataFormats(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	// New devices sign with the latest format
+	deviceID := uuid.New()
+	device, err := sm.CreateDevice(deviceID, "Test Device", "ECDSA", crypto.KeyParameters{})
+	require.NoError(t, err)
+	assert.Equal(t, domain.LatestSignedDataFormat, device.SignedDataFormat)
+
+	// Devices created before versioning keep the first format
+	legacyID := uuid.New()
+	legacy, err := sm.CreateDevice(legacyID, "Legacy Device", "ECDSA", crypto.KeyParameters{})
+	require.NoError(t, err)
+	legacy.SignedDataFormat = domain.SignedDataFormatV1
+	require.NoError(t, querier.UpdateDevice(*legacy))
+
+	for id, format := range map[uuid.UUID]int{deviceID: domain.SignedDataFormatV2, legacyID: domain.SignedDataFormatV1} {
+		for _, data := range [][]byte{[]byte("with_underscores"), {0xff, 0x00, 0xfe}} {
+			transaction, err := sm.CreateSignedTransaction(id, data)
+			require.NoError(t, err)
+			assert.Equal(t, format, transaction.FormatVersion)
+
+			verification, err := sm.VerifySignedTransaction(id, domain.SignatureVerificationRequest{TransactionID: transaction.ID})
+			assert.NoError(t, err)
+			assert.True(t, verification.Valid)
+
+			verification, err = sm.VerifySignedTransaction(id, domain.SignatureVerificationRequest{
+				SignedData: []byte(transaction.SignedData()),
+				Signature:  transaction.Sign,
+			})
+			assert.NoError(t, err)
+			assert.True(t, verification.Valid)
+		}
+
+		audit, err := sm.AuditSignedTransactions(id)
+		assert.NoError(t, err)
+		assert.True(t, audit.Valid)
+	}
+}
+
+func TestCreateDigestSignedTransaction(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	sm := NewDeviceDAO(querier)
+
+	deviceID := uuid.New()
+	device, err := sm.CreateDevice(deviceID, "Test Device", "ECDSA", crypto.KeyParameters{})
+	require.NoError(t, err)
+
+	first, err := sm.CreateSignedTransaction(deviceID, []byte("data"))
+	require.NoError(t, err)
+
+	// The digest takes the next sign counter, and chains to the previous signature
+	digest := sha512.Sum384([]byte("a large document"))
+	transaction, err := sm.CreateDigestSignedTransaction(deviceID, "SHA384", digest[:])
+	require.NoError(t, err)
+	assert.Equal(t, 2, transaction.SignCounter)
+	assert.Equal(t, first.Sign, transaction.PreviousDeviceSign)
+	assert.Equal(t, digest[:], transaction.RawData)
+	assert.Equal(t, "SHA384", transaction.HashAlgorithm)
+
+	// The signature is made over the signed data, the digest standing in for the raw data
+	signature, err := base64.StdEncoding.DecodeString(transaction.Sign)
+	require.NoError(t, err)
+	assert.NoError(t, crypto.NewVerifier().Verify("ECDSA", []byte(device.PublicKey), []byte(transaction.SignedData()), signature))
+
+	// The signed data and signature returned verify as they are
+	verification, err := sm.VerifySignedTransaction(deviceID, domain.SignatureVerificationRequest{
+		SignedData: []byte(transaction.SignedData()),
+		Signature:  transaction.Sign,
+	})
+	assert.NoError(t, err)
+	assert.True(t, verification.Valid)
+
+	next, err := sm.CreateSignedTransaction(deviceID, []byte("more data"))
+	require.NoError(t, err)
+	assert.Equal(t, transaction.Sign, next.PreviousDeviceSign)
+
+	verification, err = sm.VerifySignedTransaction(deviceID, domain.SignatureVerificationRequest{TransactionID: transaction.ID})
+	assert.NoError(t, err)
+	assert.True(t, verification.Valid)
+
+	audit, err := sm.AuditSignedTransactions(deviceID)
+	assert.NoError(t, err)
+	assert.True(t, audit.Valid)
+
+	_, err = sm.CreateDigestSignedTransaction(deviceID, "MD5", digest[:16])
+	assert.Equal(t, crypto.ErrInvalidDigestHash, err)
+
+	_, err = sm.CreateDigestSignedTransaction(deviceID, "SHA256", digest[:])
+	assert.Equal(t, crypto.ErrInvalidDigest, err)
+
+	// Ed25519 signs the signed data of a digest as any other
+	ed25519ID := uuid.New()
+	_, err = sm.CreateDevice(ed25519ID, "Ed25519 Device", "ED25519", crypto.KeyParameters{})
+	require.NoError(t, err)
+	ed25519Transaction, err := sm.CreateDigestSignedTransaction(ed25519ID, "SHA384", digest[:])
+	require.NoError(t, err)
+
+	verification, err = sm.VerifySignedTransaction(ed25519ID, domain.SignatureVerificationRequest{
+		SignedData: []byte(ed25519Transaction.SignedData()),
+		Signature:  ed25519Transaction.Sign,
+	})
+	assert.NoError(t, err)
+	assert.True(t, verification.Valid)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	dm := NewDeviceDAO(querier)
+	retail := dm.ForTenant("retail")
+
+	id := uuid.New()
+	device, err := retail.CreateDevice(id, "Retail Device", "ECDSA", crypto.KeyParameters{})
+	require.NoError(t, err)
+	assert.Equal(t, "retail", device.TenantID)
+	transaction, err := retail.CreateSignedTransaction(id, []byte("data"))
+	require.NoError(t, err)
+	_, _, err = retail.CreateIdempotentSignedTransaction(id, "key", []byte("data"))
+	require.NoError(t, err)
+
+	// The owning tenant sees the device and its transactions
+	_, err = retail.GetDevice(id)
+	assert.NoError(t, err)
+	_, err = retail.GetSignedTransactionByID(transaction.ID)
+	assert.NoError(t, err)
+	devices, err := retail.ListDevices(persistence.DeviceFilter{}, persistence.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, devices, 1)
+
+	// Other tenants do not, as if the device did not exist
+	devices, err = dm.ListDevices(persistence.DeviceFilter{}, persistence.Page{})
+	assert.NoError(t, err)
+	assert.Empty(t, devices)
+	_, err = dm.GetDevice(id)
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.CreateSignedTransaction(id, []byte("data"))
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, _, err = dm.CreateIdempotentSignedTransaction(id, "key", []byte("data"))
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.CreateSignedTransactions(id, [][]byte{[]byte("data")}, domain.BatchModeAtomic)
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.ListSignedTransactions(id, persistence.SignedTransactionFilter{}, persistence.Page{})
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.GetSignedTransaction(id, 1)
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.GetSignedTransactionByID(transaction.ID)
+	assert.Equal(t, ErrSignedTransactionNotFound, err)
+	_, err = dm.VerifySignedTransaction(id, domain.SignatureVerificationRequest{TransactionID: transaction.ID})
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.AuditSignedTransactions(id)
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.GetDeviceKeys(id)
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.RotateDeviceKey(id)
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.ChangeDeviceStatus(id, domain.DeviceStatusSuspended, "lost")
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+	_, err = dm.GetDeviceStatusChanges(id)
+	assert.Equal(t, persistence.ErrDeviceNotFound, err)
+
+	// Device IDs are unique across tenants, the ones of other tenants are refused without telling they exist
+	_, err = dm.CreateDevice(id, "Default Device", "ECDSA", crypto.KeyParameters{})
+	assert.Equal(t, ErrDeviceIDUnavailable, err)
+	_, err = dm.ForTenant("retail").CreateDevice(id, "Retail Device", "ECDSA", crypto.KeyParameters{})
+	assert.Equal(t, ErrDeviceExists, err)
+
+	stored, _ := querier.GetDevice(id)
+	assert.Equal(t, 2, stored.SignCounter, "Other tenants must not sign with the device")
+}
+
+// TestDeviceDAOMetrics tests the signatures, key generations and device lock waits are recorded.
+func TestDeviceDAOMetrics(t *testing.T) {
+	querier, _ := persistence.NewInMemoryQuerier(context.TODO())
+	m := metrics.New()
+	deviceDAO := NewDeviceDAO(querier).WithMetrics(m)
+
+	device, err := deviceDAO.CreateDevice(uuid.New(), "metered", "ECDSA", crypto.KeyParameters{})
+	require.NoError(t, err)
+	_, err = deviceDAO.CreateSignedTransaction(device.ID, []byte("data"))
+	require.NoError(t, err)
+	_, err = deviceDAO.CreateSignedTransactions(device.ID, [][]byte{[]byte("first"), []byte("second")}, domain.BatchModeAtomic)
+	require.NoError(t, err)
+
+	// Devices not found or not active are not counted as signatures
+	_, err = deviceDAO.CreateSignedTransaction(uuid.New(), []byte("data"))
+	require.Error(t, err)
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	scraped := rr.Body.String()
+	assert.Contains(t, scraped, `ssccg_signatures_total{algorithm="ECDSA",result="success"} 3`)
+	assert.NotContains(t, scraped, `result="error"`)
+	assert.Contains(t, scraped, `ssccg_key_generation_duration_seconds_count{algorithm="ECDSA"} 1`)
+	assert.Contains(t, scraped, "ssccg_device_lock_wait_duration_seconds_count 3")
 }
@@ -0,0 +1,38 @@
+package dao
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// deviceLockStripes is the number of mutexes shared by all devices.
+// Two devices only wait for each other when they fall in the same stripe.
+const deviceLockStripes = 1024
+
+// deviceLocker serializes operations per device, while letting different devices run in parallel.
+// It is a striped lock: each device ID is hashed to one of a fixed set of mutexes,
+// so the memory used does not grow with the number of devices.
+type deviceLocker struct {
+	stripes [deviceLockStripes]sync.Mutex
+}
+
+func newDeviceLocker() *deviceLocker {
+	return &deviceLocker{}
+}
+
+// Lock locks the device and returns the function that unlocks it.
+func (l *deviceLocker) Lock(id uuid.UUID) func() {
+	stripe := &l.stripes[l.stripeOf(id)]
+	stripe.Lock()
+	return stripe.Unlock
+}
+
+// stripeOf returns the index of the mutex guarding a device.
+// IDs are hashed, as caller chosen UUIDs are not guaranteed to be random.
+func (l *deviceLocker) stripeOf(id uuid.UUID) uint32 {
+	hash := fnv.New32a()
+	hash.Write(id[:]) //nolint:all
+	return hash.Sum32() % deviceLockStripes
+}
@@ -0,0 +1,65 @@
+package dao
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceLockerSerializesSameDevice(t *testing.T) {
+	locker := newDeviceLocker()
+	id := uuid.New()
+
+	counter := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locker.Lock(id)
+			defer unlock()
+			counter++
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 100, counter)
+}
+
+func TestDeviceLockerDoesNotBlockOtherDevices(t *testing.T) {
+	locker := newDeviceLocker()
+
+	// Pick two devices guarded by different stripes
+	first := uuid.New()
+	second := uuid.New()
+	for locker.stripeOf(first) == locker.stripeOf(second) {
+		second = uuid.New()
+	}
+
+	unlock := locker.Lock(first)
+	defer unlock()
+
+	locked := make(chan struct{})
+	go func() {
+		unlockSecond := locker.Lock(second)
+		unlockSecond()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("locking a device blocked another device")
+	}
+}
+
+func TestDeviceLockerStripeIsStable(t *testing.T) {
+	locker := newDeviceLocker()
+	id := uuid.New()
+
+	assert.Equal(t, locker.stripeOf(id), locker.stripeOf(id))
+	assert.Less(t, locker.stripeOf(id), uint32(deviceLockStripes))
+}
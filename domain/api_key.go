@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"slices"
+	"time"
+)
+
+// API key scopes, each one granting a group of routes
+// The admin scope manages the API keys, and grants every other scope.
+const (
+	ScopeDevicesCreate    = "devices:create"
+	ScopeDevicesRead      = "devices:read"
+	ScopeDevicesManage    = "devices:manage"
+	ScopeSignaturesCreate = "signatures:create"
+	ScopeSignaturesRead   = "signatures:read"
+	ScopeAdmin            = "admin"
+)
+
+// DefaultTenant owns the devices and API keys created without tenant, and those created before tenants existed
+const DefaultTenant = "default"
+
+// AllTenants is the tenant of the admin key given by configuration, which manages the API keys of every tenant
+const AllTenants = "*"
+
+// MaxTenantIDLength is the longest tenant ID accepted
+const MaxTenantIDLength = 64
+
+// IsValidTenantID checks if id can name the tenant of a device or API key.
+func IsValidTenantID(id string) bool {
+	return id != "" && id != AllTenants && len(id) <= MaxTenantIDLength
+}
+
+// Scopes are all the scopes an API key can carry
+var Scopes = []string{
+	ScopeDevicesCreate,
+	ScopeDevicesRead,
+	ScopeDevicesManage,
+	ScopeSignaturesCreate,
+	ScopeSignaturesRead,
+	ScopeAdmin,
+}
+
+// IsValidScope checks if scope is a known API key scope.
+func IsValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// APIKey authenticates the callers of the API, and authorizes them by scope and device.
+// Only the SHA-256 hash of the key is kept, the key itself is handed out once, when created.
+type APIKey struct {
+	ID        uuid.UUID   `db:"id"`
+	TenantID  string      `db:"tenant_id"`
+	Name      string      `db:"name"`
+	KeyHash   string      `db:"key_hash"`
+	Scopes    []string    `db:"scopes"`
+	DeviceIDs []uuid.UUID `db:"device_ids"` // Empty allows every device
+	CreatedAt time.Time   `db:"created_at"`
+}
+
+// HasScope checks if the key grants scope.
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// AllowsDevice checks if the key may be used with the device.
+func (k APIKey) AllowsDevice(deviceId uuid.UUID) bool {
+	return len(k.DeviceIDs) == 0 || slices.Contains(k.DeviceIDs, deviceId)
+}
+
+// CoversDevices checks if the key may grant a key restricted to deviceIds, empty standing for every device.
+// Keys restricted to some devices only grant some of them, never every device.
+func (k APIKey) CoversDevices(deviceIds []uuid.UUID) bool {
+	if len(k.DeviceIDs) == 0 {
+		return true
+	}
+	if len(deviceIds) == 0 {
+		return false
+	}
+	for _, deviceId := range deviceIds {
+		if !k.AllowsDevice(deviceId) {
+			return false
+		}
+	}
+	return true
+}
+
+// DeviceTenant returns the tenant of the devices the key may be used with.
+// The admin key given by configuration uses the devices of the default tenant.
+func (k APIKey) DeviceTenant() string {
+	if k.TenantID == AllTenants {
+		return DefaultTenant
+	}
+	return k.TenantID
+}
+
+// ManagesTenant checks if the key may manage the API keys of the tenant.
+func (k APIKey) ManagesTenant(tenantId string) bool {
+	return k.TenantID == AllTenants || k.TenantID == tenantId
+}
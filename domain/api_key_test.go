@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidScope(t *testing.T) {
+	for _, scope := range Scopes {
+		assert.True(t, IsValidScope(scope), scope)
+	}
+	assert.False(t, IsValidScope("devices:delete"))
+	assert.False(t, IsValidScope(""))
+}
+
+func TestAPIKeyHasScope(t *testing.T) {
+	key := APIKey{Scopes: []string{ScopeDevicesRead, ScopeSignaturesCreate}}
+	assert.True(t, key.HasScope(ScopeDevicesRead))
+	assert.True(t, key.HasScope(ScopeSignaturesCreate))
+	assert.False(t, key.HasScope(ScopeDevicesCreate))
+	assert.False(t, key.HasScope(ScopeAdmin))
+
+	// The admin scope grants every other scope
+	admin := APIKey{Scopes: []string{ScopeAdmin}}
+	for _, scope := range Scopes {
+		assert.True(t, admin.HasScope(scope), scope)
+	}
+}
+
+func TestAPIKeyAllowsDevice(t *testing.T) {
+	allowed := uuid.New()
+
+	assert.True(t, APIKey{}.AllowsDevice(allowed))
+
+	key := APIKey{DeviceIDs: []uuid.UUID{allowed}}
+	assert.True(t, key.AllowsDevice(allowed))
+	assert.False(t, key.AllowsDevice(uuid.New()))
+}
+
+func TestAPIKeyCoversDevices(t *testing.T) {
+	allowed := uuid.New()
+
+	assert.True(t, APIKey{}.CoversDevices(nil))
+	assert.True(t, APIKey{}.CoversDevices([]uuid.UUID{allowed}))
+
+	key := APIKey{DeviceIDs: []uuid.UUID{allowed}}
+	assert.True(t, key.CoversDevices([]uuid.UUID{allowed}))
+	assert.False(t, key.CoversDevices([]uuid.UUID{allowed, uuid.New()}))
+	assert.False(t, key.CoversDevices(nil))
+}
+
+func TestIsValidTenantID(t *testing.T) {
+	assert.True(t, IsValidTenantID(DefaultTenant))
+	assert.True(t, IsValidTenantID("retail"))
+	assert.False(t, IsValidTenantID(""))
+	assert.False(t, IsValidTenantID(AllTenants))
+	assert.False(t, IsValidTenantID(string(make([]byte, MaxTenantIDLength+1))))
+}
+
+func TestAPIKeyTenants(t *testing.T) {
+	key := APIKey{TenantID: "retail"}
+	assert.Equal(t, "retail", key.DeviceTenant())
+	assert.True(t, key.ManagesTenant("retail"))
+	assert.False(t, key.ManagesTenant(DefaultTenant))
+
+	// The admin key given by configuration manages every tenant, and uses the devices of the default one
+	admin := APIKey{TenantID: AllTenants}
+	assert.Equal(t, DefaultTenant, admin.DeviceTenant())
+	assert.True(t, admin.ManagesTenant("retail"))
+	assert.True(t, admin.ManagesTenant(DefaultTenant))
+}
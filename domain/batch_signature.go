@@ -0,0 +1,19 @@
+package domain
+
+// Batch modes, deciding what happens to a signing batch when one of its items fails
+// In atomic mode nothing is signed, in partial mode the other items are still signed
+const (
+	BatchModeAtomic  = "atomic"
+	BatchModePartial = "partial"
+)
+
+// IsValidBatchMode checks if mode is a known batch mode
+func IsValidBatchMode(mode string) bool {
+	return mode == BatchModeAtomic || mode == BatchModePartial
+}
+
+// BatchSignature is the outcome of signing one item of a batch, either its signed transaction or the error signing it
+type BatchSignature struct {
+	Transaction *SignedTransaction
+	Err         error
+}
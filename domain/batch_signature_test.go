@@ -0,0 +1,14 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidBatchMode(t *testing.T) {
+	assert.True(t, IsValidBatchMode(BatchModeAtomic))
+	assert.True(t, IsValidBatchMode(BatchModePartial))
+	assert.False(t, IsValidBatchMode(""))
+	assert.False(t, IsValidBatchMode("all"))
+}
@@ -0,0 +1,43 @@
+package domain
+
+import "github.com/google/uuid"
+
+// Kinds of issues found when auditing a signature chain
+const (
+	AuditIssueGap              = "gap"
+	AuditIssueDuplicateCounter = "duplicate_counter"
+	AuditIssueFork             = "fork"
+	AuditIssueBrokenLink       = "broken_link"
+	AuditIssueInvalidSignature = "invalid_signature"
+	AuditIssueCounterMismatch  = "counter_mismatch"
+)
+
+// ChainAuditIssue is a defect found at a given sign counter of a device chain.
+// TransactionID is not set for issues about missing transactions.
+type ChainAuditIssue struct {
+	SignCounter   int
+	Kind          string
+	TransactionID *uuid.UUID
+	Detail        string
+}
+
+// ChainAudit is the outcome of walking the whole signature chain of a device.
+// FirstInvalidCounter is the lowest sign counter with an issue, if any.
+type ChainAudit struct {
+	DeviceID            uuid.UUID
+	Valid               bool
+	TransactionsChecked int
+	FirstInvalidCounter *int
+	Issues              []ChainAuditIssue
+}
+
+// AddIssue records an issue, keeping track of the first offending sign counter.
+func (a *ChainAudit) AddIssue(issue ChainAuditIssue) {
+	a.Issues = append(a.Issues, issue)
+	a.Valid = false
+
+	if a.FirstInvalidCounter == nil || issue.SignCounter < *a.FirstInvalidCounter {
+		counter := issue.SignCounter
+		a.FirstInvalidCounter = &counter
+	}
+}
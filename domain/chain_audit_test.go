@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChainAuditAddIssue tests that AddIssue keeps the lowest offending counter.
+func TestChainAuditAddIssue(t *testing.T) {
+	audit := ChainAudit{DeviceID: uuid.New(), Valid: true}
+
+	audit.AddIssue(ChainAuditIssue{SignCounter: 5, Kind: AuditIssueBrokenLink})
+	audit.AddIssue(ChainAuditIssue{SignCounter: 3, Kind: AuditIssueGap})
+	audit.AddIssue(ChainAuditIssue{SignCounter: 7, Kind: AuditIssueInvalidSignature})
+
+	assert.False(t, audit.Valid)
+	assert.Len(t, audit.Issues, 3)
+	assert.Equal(t, 3, *audit.FirstInvalidCounter)
+}
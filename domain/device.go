@@ -1,12 +1,33 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"time"
+)
 
 type Device struct {
-	ID            uuid.UUID `db:"id"`
-	Label         string    `db:"label"`
-	SignCounter   int       `db:"sign_counter"`
-	SignAlgorithm string    `db:"sign_algorithm"`
-	PublicKey     string    `db:"public_key"`
-	PrivateKey    string    `db:"private_Key"`
+	ID               uuid.UUID `db:"id"`
+	TenantID         string    `db:"tenant_id"` // the tenant owning the device, only its callers see it
+	Label            string    `db:"label"`
+	SignCounter      int       `db:"sign_counter"`
+	SignAlgorithm    string    `db:"sign_algorithm"`
+	RSABits          int       `db:"rsa_bits"`
+	Curve            string    `db:"curve"`
+	PublicKey        string    `db:"public_key"`
+	KeyHandle        string    `db:"key_handle"`
+	KeyValidFrom     int       `db:"key_valid_from"`
+	Status           string    `db:"status"`
+	CreationSeq      int64     `db:"creation_seq"`       // orders devices by creation, assigned by the storage
+	SignedDataFormat int       `db:"signed_data_format"` // format version of the data the device signs, kept for its whole chain
+	CreatedAt        time.Time `db:"created_at"`
+	UpdatedAt        time.Time `db:"updated_at"`
+}
+
+// CurrentKey returns the public key the device signs with, valid from KeyValidFrom on.
+func (d Device) CurrentKey() DeviceKey {
+	return DeviceKey{
+		DeviceID:  d.ID,
+		PublicKey: d.PublicKey,
+		ValidFrom: d.KeyValidFrom,
+	}
 }
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+)
+
+// KeyRotationRecordType tells the transactions recording a key rotation apart from the signed data.
+const KeyRotationRecordType = "key_rotation"
+
+// DeviceKey is a public key of a device, with the range of sign counters it signed.
+// ValidTo is 0 for the key the device currently signs with.
+type DeviceKey struct {
+	DeviceID  uuid.UUID `db:"device_id"`
+	PublicKey string    `db:"public_key"`
+	ValidFrom int       `db:"valid_from"`
+	ValidTo   int       `db:"valid_to"`
+}
+
+// Covers checks if the key signed the transaction with the given sign counter.
+func (k DeviceKey) Covers(signCounter int) bool {
+	return signCounter >= k.ValidFrom && (k.ValidTo == 0 || signCounter <= k.ValidTo)
+}
+
+// KeyRotation is the outcome of a device key rotation.
+// Transaction is the rotation record, signed with the retired key.
+type KeyRotation struct {
+	DeviceID    uuid.UUID
+	RetiredKey  DeviceKey
+	CurrentKey  DeviceKey
+	Transaction SignedTransaction
+}
+
+// KeyRotationRecord is the data of the transaction announcing the new public key of a device.
+// Being signed with the retired key, it vouches for the new key within the signature chain.
+type KeyRotationRecord struct {
+	Type      string `json:"type"`
+	PublicKey string `json:"public_key"`
+	ValidFrom int    `json:"valid_from"`
+}
+
+// NewKeyRotationRecord builds the data of the rotation record for a new public key.
+func NewKeyRotationRecord(publicKey string, validFrom int) []byte {
+	// Marshaling a struct of strings and integers cannot fail
+	data, _ := json.Marshal(KeyRotationRecord{
+		Type:      KeyRotationRecordType,
+		PublicKey: publicKey,
+		ValidFrom: validFrom,
+	})
+	return data
+}
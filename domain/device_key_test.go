@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceKeyCovers(t *testing.T) {
+	retired := DeviceKey{ValidFrom: 1, ValidTo: 5}
+	assert.False(t, retired.Covers(0))
+	assert.True(t, retired.Covers(1))
+	assert.True(t, retired.Covers(5))
+	assert.False(t, retired.Covers(6))
+
+	current := DeviceKey{ValidFrom: 6}
+	assert.False(t, current.Covers(5))
+	assert.True(t, current.Covers(6))
+	assert.True(t, current.Covers(1000))
+}
+
+func TestNewKeyRotationRecord(t *testing.T) {
+	var record KeyRotationRecord
+	require.NoError(t, json.Unmarshal(NewKeyRotationRecord("public key", 7), &record))
+	assert.Equal(t, KeyRotationRecord{Type: KeyRotationRecordType, PublicKey: "public key", ValidFrom: 7}, record)
+}
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Lifecycle states of a device
+// Only active devices sign, a decommissioned device never leaves that state.
+const (
+	DeviceStatusActive         = "active"
+	DeviceStatusSuspended      = "suspended"
+	DeviceStatusDecommissioned = "decommissioned"
+)
+
+// deviceStatusTransitions maps each state to the states a device can move to from it
+var deviceStatusTransitions = map[string][]string{
+	DeviceStatusActive:         {DeviceStatusSuspended, DeviceStatusDecommissioned},
+	DeviceStatusSuspended:      {DeviceStatusActive, DeviceStatusDecommissioned},
+	DeviceStatusDecommissioned: {},
+}
+
+// IsValidDeviceStatus checks if status is a lifecycle state of a device.
+func IsValidDeviceStatus(status string) bool {
+	_, found := deviceStatusTransitions[status]
+	return found
+}
+
+// CanChangeDeviceStatus checks if a device can move from one lifecycle state to another.
+func CanChangeDeviceStatus(from, to string) bool {
+	for _, allowed := range deviceStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceStatusChange records a device moving from one lifecycle state to another.
+type DeviceStatusChange struct {
+	ID         uuid.UUID `db:"id"`
+	DeviceID   uuid.UUID `db:"device_id"`
+	FromStatus string    `db:"from_status"`
+	ToStatus   string    `db:"to_status"`
+	Reason     string    `db:"reason"`
+	ChangedAt  time.Time `db:"changed_at"`
+}
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidDeviceStatus(t *testing.T) {
+	assert.True(t, IsValidDeviceStatus(DeviceStatusActive))
+	assert.True(t, IsValidDeviceStatus(DeviceStatusSuspended))
+	assert.True(t, IsValidDeviceStatus(DeviceStatusDecommissioned))
+	assert.False(t, IsValidDeviceStatus("lost"))
+	assert.False(t, IsValidDeviceStatus(""))
+}
+
+func TestCanChangeDeviceStatus(t *testing.T) {
+	assert.True(t, CanChangeDeviceStatus(DeviceStatusActive, DeviceStatusSuspended))
+	assert.True(t, CanChangeDeviceStatus(DeviceStatusSuspended, DeviceStatusActive))
+	assert.True(t, CanChangeDeviceStatus(DeviceStatusActive, DeviceStatusDecommissioned))
+	assert.True(t, CanChangeDeviceStatus(DeviceStatusSuspended, DeviceStatusDecommissioned))
+
+	assert.False(t, CanChangeDeviceStatus(DeviceStatusActive, DeviceStatusActive))
+	assert.False(t, CanChangeDeviceStatus(DeviceStatusDecommissioned, DeviceStatusActive))
+	assert.False(t, CanChangeDeviceStatus(DeviceStatusDecommissioned, DeviceStatusSuspended))
+	assert.False(t, CanChangeDeviceStatus(DeviceStatusActive, "lost"))
+}
@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// IdempotencyKey remembers the transaction signed for a client supplied key, scoped per device.
+// RequestHash identifies the signed data, so the key cannot be replayed with other data.
+type IdempotencyKey struct {
+	DeviceID      uuid.UUID `db:"device_id"`
+	Key           string    `db:"idempotency_key"`
+	RequestHash   string    `db:"request_hash"`
+	TransactionID uuid.UUID `db:"transaction_id"`
+	CreatedAt     time.Time `db:"created_at"`
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "github.com/google/uuid"
+
+// Reasons a signature verification fails
+const (
+	VerificationReasonSignatureMismatch  = "signature_mismatch"
+	VerificationReasonMalformedSignature = "malformed_signature"
+)
+
+// SignatureVerificationRequest identifies the signature to be verified against a device public key.
+// Either TransactionID refers to a stored transaction, or SignedData and Signature are given as they were returned.
+type SignatureVerificationRequest struct {
+	TransactionID uuid.UUID
+	SignedData    []byte
+	Signature     string
+}
+
+// SignatureVerification is the outcome of a signature verification.
+// Reason explains why the signature is not valid, it is empty otherwise.
+type SignatureVerification struct {
+	Valid         bool
+	Reason        string
+	TransactionID *uuid.UUID
+	SignCounter   int
+}
@@ -1,10 +1,34 @@
 package domain
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
+	"time"
 )
 
+// Formats of the data signed for a transaction
+//
+// SignedDataFormatV1 joins the sign counter, raw data and previous signature with underscores.
+// It is ambiguous when the raw data contains underscores, and mangles data that is not valid UTF-8.
+// It does not cover the creation time. It is kept for the chains started with it.
+//
+// SignedDataFormatV2 is canonical JSON: fixed field order, no white space, and the raw data base64 encoded.
+// It also covers the device ID and the creation time, so the signature vouches for them.
+// Digest transactions also name the hash algorithm of the digest standing in for the raw data.
+const (
+	SignedDataFormatV1 = 1
+	SignedDataFormatV2 = 2
+
+	// LatestSignedDataFormat is the format new devices sign with
+	LatestSignedDataFormat = SignedDataFormatV2
+)
+
+// IsValidSignedDataFormat checks if format is a known signed data format
+func IsValidSignedDataFormat(format int) bool {
+	return format == SignedDataFormatV1 || format == SignedDataFormatV2
+}
+
 type SignedTransaction struct {
 	ID                 uuid.UUID `db:"id"`
 	DeviceID           uuid.UUID `db:"device_id"`
@@ -12,8 +36,44 @@ type SignedTransaction struct {
 	Sign               string    `db:"sign"`
 	PreviousDeviceSign string    `db:"previous_device_sign"`
 	SignCounter        int       `db:"sign_counter"`
+	CreatedAt          time.Time `db:"created_at"`
+	FormatVersion      int       `db:"format_version"` // 0 stands for SignedDataFormatV1, the format of the transactions stored before versioning
+	HashAlgorithm      string    `db:"hash_algorithm"` // Only set for digest transactions
 }
 
+// IsDigest checks if the transaction signs a digest computed by the client, instead of raw data.
+// The raw data of a digest transaction is the digest, signed within the signed data as any raw data,
+// so the signature also vouches for the sign counter, device and previous signature of the transaction.
+func (s *SignedTransaction) IsDigest() bool {
+	return s.HashAlgorithm != ""
+}
+
+// signedDataV2 is the content of SignedDataFormatV2, marshalled in field order
+type signedDataV2 struct {
+	Version           int       `json:"version"`
+	DeviceID          uuid.UUID `json:"device_id"`
+	SignCounter       int       `json:"sign_counter"`
+	CreatedAt         string    `json:"created_at"`
+	RawData           []byte    `json:"raw_data"`
+	HashAlgorithm     string    `json:"hash_algorithm,omitempty"`
+	PreviousSignature string    `json:"previous_signature"`
+}
+
+// SignedData returns the payload signed for the transaction, in its format version.
 func (s *SignedTransaction) SignedData() string {
+	if s.FormatVersion == SignedDataFormatV2 {
+		// Marshaling a struct of strings, integers and bytes cannot fail
+		data, _ := json.Marshal(signedDataV2{
+			Version:           SignedDataFormatV2,
+			DeviceID:          s.DeviceID,
+			SignCounter:       s.SignCounter,
+			CreatedAt:         s.CreatedAt.UTC().Format(time.RFC3339Nano),
+			RawData:           s.RawData,
+			HashAlgorithm:     s.HashAlgorithm,
+			PreviousSignature: s.PreviousDeviceSign,
+		})
+		return string(data)
+	}
+
 	return fmt.Sprintf("%d_%s_%s", s.SignCounter, s.RawData, s.PreviousDeviceSign)
 }
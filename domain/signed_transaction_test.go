@@ -3,6 +3,7 @@ package domain
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -22,3 +23,62 @@ func TestSignedData(t *testing.T) {
 	result := transaction.SignedData()
 	assert.Equal(t, expected, result, "SignedData method returned unexpected result")
 }
+
+// TestSignedDataV2 tests the SignedData method for the canonical JSON format.
+func TestSignedDataV2(t *testing.T) {
+	transaction := SignedTransaction{
+		ID:                 uuid.New(),
+		DeviceID:           uuid.MustParse("5b8e3f1e-62c4-4c57-9a3b-2a7f1b2c3d4e"),
+		RawData:            []byte("sample_data"),
+		PreviousDeviceSign: "previous-signature",
+		SignCounter:        5,
+		CreatedAt:          time.Date(2024, 1, 2, 4, 4, 5, 123000, time.FixedZone("CET", 3600)),
+		FormatVersion:      SignedDataFormatV2,
+	}
+
+	expected := `{"version":2,"device_id":"5b8e3f1e-62c4-4c57-9a3b-2a7f1b2c3d4e","sign_counter":5,` +
+		`"created_at":"2024-01-02T03:04:05.000123Z","raw_data":"c2FtcGxlX2RhdGE=","previous_signature":"previous-signature"}`
+	assert.Equal(t, expected, transaction.SignedData())
+}
+
+// TestSignedDataV2IsUnambiguous tests that data the first format cannot tell apart is signed differently.
+func TestSignedDataV2OfDigest(t *testing.T) {
+	transaction := SignedTransaction{
+		DeviceID:           uuid.MustParse("5b8e3f1e-62c4-4c57-9a3b-2a7f1b2c3d4e"),
+		RawData:            []byte{0xde, 0xad, 0xbe, 0xef},
+		PreviousDeviceSign: "previous-signature",
+		SignCounter:        5,
+		CreatedAt:          time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		FormatVersion:      SignedDataFormatV2,
+		HashAlgorithm:      "SHA256",
+	}
+	assert.True(t, transaction.IsDigest())
+
+	expected := `{"version":2,"device_id":"5b8e3f1e-62c4-4c57-9a3b-2a7f1b2c3d4e","sign_counter":5,` +
+		`"created_at":"2024-01-02T03:04:05Z","raw_data":"3q2+7w==","hash_algorithm":"SHA256","previous_signature":"previous-signature"}`
+	assert.Equal(t, expected, transaction.SignedData())
+
+	transaction.HashAlgorithm = ""
+	assert.False(t, transaction.IsDigest())
+	assert.NotContains(t, transaction.SignedData(), "hash_algorithm")
+}
+
+func TestSignedDataV2IsUnambiguous(t *testing.T) {
+	first := SignedTransaction{RawData: []byte("a_b"), PreviousDeviceSign: "c", SignCounter: 1}
+	second := SignedTransaction{RawData: []byte("a"), PreviousDeviceSign: "b_c", SignCounter: 1}
+	assert.Equal(t, first.SignedData(), second.SignedData())
+
+	first.FormatVersion, second.FormatVersion = SignedDataFormatV2, SignedDataFormatV2
+	assert.NotEqual(t, first.SignedData(), second.SignedData())
+
+	// Data that is not valid UTF-8 is kept as is
+	binary := SignedTransaction{RawData: []byte{0xff, 0xfe}, FormatVersion: SignedDataFormatV2}
+	assert.Contains(t, binary.SignedData(), `"raw_data":"//4="`)
+}
+
+func TestIsValidSignedDataFormat(t *testing.T) {
+	assert.True(t, IsValidSignedDataFormat(SignedDataFormatV1))
+	assert.True(t, IsValidSignedDataFormat(SignedDataFormatV2))
+	assert.False(t, IsValidSignedDataFormat(0))
+	assert.False(t, IsValidSignedDataFormat(3))
+}
@@ -3,31 +3,98 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/ildomm/ssccg/api"
+	"github.com/ildomm/ssccg/crypto"
 	"github.com/ildomm/ssccg/dao"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/metrics"
 	"github.com/ildomm/ssccg/persistence"
 	"github.com/ildomm/ssccg/system"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// The context is done on SIGINT or SIGTERM, e.g. when the pod is stopped on a rollout
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Initialize log standards
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.SetPrefix("[SSCCG] ")
 
 	// Initialize database
-	// Dev note: this could be replaced with a real database, like Postgres
-	querier, err := persistence.NewInMemoryQuerier(ctx)
+	// Postgres is used when a database URL is given, otherwise everything is kept in memory
+	// The database outlives the signal, so the requests in flight are still stored while the server drains
+	databaseCtx, cancelDatabase := context.WithCancel(context.Background())
+	defer cancelDatabase()
+	var querier persistence.Querier
+	var err error
+	if databaseURL := system.ExtractDatabaseURL(); databaseURL != nil {
+		querier, err = persistence.NewPostgresQuerier(databaseCtx, *databaseURL)
+	} else {
+		querier, err = persistence.NewInMemoryQuerier(databaseCtx)
+	}
 	if err != nil {
-		log.Fatal("Could not initialize database")
+		log.Fatal("Could not initialize database: ", err)
 	}
+	defer querier.Close()
+
+	// Every database operation is timed
+	serviceMetrics := metrics.New()
+	querier = persistence.NewInstrumentedQuerier(querier, serviceMetrics)
+
+	// Initialize the key store
+	// Private keys are kept in software, unless a PKCS#11 token is configured
+	var keyStore crypto.KeyStore
+	var envelope *crypto.KeyEnvelope
+	switch keyStoreName := system.ExtractKeyStore(); keyStoreName {
+	case crypto.LocalKeyStoreName:
+		// Keys are stored unencrypted when no key encryption key is given
+		envelope, err = newKeyEnvelope()
+		if err != nil {
+			log.Fatal("Could not initialize the key encryption key: ", err)
+		}
+		localKeyStore := crypto.NewLocalKeyStore()
+		if envelope != nil {
+			localKeyStore.WithEnvelope(envelope)
+		} else {
+			log.Println("No key encryption key given, private keys are stored unencrypted")
+		}
+		keyStore = localKeyStore
+	case crypto.PKCS11KeyStoreName:
+		config := system.ExtractPKCS11Config()
+		if config == nil {
+			log.Fatal("Could not initialize the key store: ", system.PKCS11ModuleEnvVar, " is not set")
+		}
+		keyStore, err = crypto.NewPKCS11KeyStore(*config)
+		if err != nil {
+			log.Fatal("Could not initialize the key store: ", err)
+		}
+	default:
+		log.Fatal("Unknown key store ", keyStoreName)
+	}
+	defer keyStore.Close()
 
 	// Initialize services
-	deviceDAO := dao.NewDeviceDAO(querier)
+	deviceDAO := dao.NewDeviceDAO(querier).WithKeyStore(keyStore).WithMetrics(serviceMetrics)
+	if retention := system.ExtractIdempotencyRetention(); retention != nil {
+		deviceDAO.WithIdempotencyRetention(*retention)
+	}
+	go purgeIdempotencyKeys(ctx, deviceDAO)
+
+	// Keys wrapped with a previous key encryption key, or not encrypted yet, are wrapped with the current one
+	if envelope != nil {
+		rewrapped, err := deviceDAO.RewrapPrivateKeys()
+		if err != nil {
+			log.Fatal("Could not wrap the device private keys: ", err)
+		}
+		log.Println("Private keys are encrypted with key encryption key", envelope.CurrentKEKID(), "-", rewrapped, "keys wrapped again")
+	}
 
 	// Initialize the server
 	server := api.NewServer()
@@ -35,13 +102,126 @@ func main() {
 		server.WithListenAddress(*listenAddress)
 	}
 	server.WithDeviceManager(deviceDAO)
+	server.WithMetrics(serviceMetrics)
+	if system.ExtractAuthDisabled() {
+		log.Println("WARNING: API key authentication is disabled, every caller may use every endpoint")
+	} else {
+		apiKeyDAO := dao.NewAPIKeyDAO(querier)
+		if adminKey := system.ExtractAdminAPIKey(); adminKey != nil {
+			apiKeyDAO.WithAdminKey(*adminKey)
+		} else if err := checkStoredAdminKeys(apiKeyDAO); err != nil {
+			log.Fatal("Could not enable API key authentication: ", err)
+		}
+		server.WithAPIKeyManager(apiKeyDAO)
+	}
+	if maxDataSize := system.ExtractMaxDataSize(); maxDataSize != nil {
+		server.WithMaxDataSize(*maxDataSize)
+	}
+	if tlsConfig := system.ExtractTLSConfig(); tlsConfig != nil {
+		server.WithTLSConfig(*tlsConfig)
+		log.Println("Serving HTTPS with the certificate", tlsConfig.CertFile)
+	}
 	log.Println("Starting server on", server.ListenAddress())
 
-	if err := server.Run(); err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Run()
+	}()
+
+	select {
+	case err := <-serverErr:
 		if !errors.Is(err, http.ErrServerClosed) {
-			log.Fatal("Could not start server on", server.ListenAddress())
-		} else {
-			log.Println("Server closed")
+			log.Fatal("Could not start server on ", server.ListenAddress(), ": ", err)
+		}
+	case <-ctx.Done():
+		// A second signal kills the process without waiting
+		stop()
+		shutdown(server)
+	}
+
+	// The key store and the database are closed, and the database context cancelled, by the deferred calls,
+	// once no signing is in flight
+	log.Println("Server closed")
+}
+
+// shutdown stops the server accepting requests, and waits for the requests in flight to complete.
+// Signatures being saved are given until the configured timeout to update their device counter.
+func shutdown(server *api.Server) {
+	timeout := api.DefaultShutdownTimeout
+	if shutdownTimeout := system.ExtractShutdownTimeout(); shutdownTimeout != nil {
+		timeout = *shutdownTimeout
+	}
+	log.Println("Shutting down, waiting up to", timeout, "for the requests in flight")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Requests still in flight are abandoned: ", err)
+	}
+}
+
+// idempotencyPurgeInterval is how often the expired idempotency keys are deleted
+const idempotencyPurgeInterval = time.Hour
+
+// purgeIdempotencyKeys deletes the expired idempotency keys periodically, until the context is done.
+// Expired keys are ignored when signing anyway, purging only keeps the storage from growing.
+func purgeIdempotencyKeys(ctx context.Context, purger interface{ PurgeIdempotencyKeys() (int, error) }) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := purger.PurgeIdempotencyKeys(); err != nil {
+				log.Println("Could not purge the expired idempotency keys: ", err)
+			}
+		}
+	}
+}
+
+// newKeyEnvelope builds the envelope encrypting the device private keys, from the configured key encryption keys.
+// It returns nil when no key encryption key is configured.
+func newKeyEnvelope() (*crypto.KeyEnvelope, error) {
+	kek, err := system.ExtractKeyEncryptionKey()
+	if err != nil || kek == nil {
+		return nil, err
+	}
+
+	envelope, err := crypto.NewKeyEnvelope(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	previousKEKs, err := system.ExtractPreviousKeyEncryptionKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, previousKEK := range previousKEKs {
+		if envelope, err = envelope.WithPreviousKEK(previousKEK); err != nil {
+			return nil, err
+		}
+	}
+	return envelope, nil
+}
+
+// checkStoredAdminKeys makes sure the API can be used without the admin key given by configuration.
+// It fails when no key is stored, since none could ever be created, and warns when no stored key may create others.
+func checkStoredAdminKeys(apiKeyDAO dao.APIKeyDAO) error {
+	apiKeys, err := apiKeyDAO.ListAPIKeys(domain.AllTenants)
+	if err != nil {
+		return err
+	}
+	if len(apiKeys) == 0 {
+		return fmt.Errorf("no API key is stored, and %s is not set to create the first one", system.AdminAPIKeyEnvVar)
+	}
+
+	for _, apiKey := range apiKeys {
+		if apiKey.HasScope(domain.ScopeAdmin) {
+			return nil
 		}
 	}
+	log.Println("WARNING: no stored API key has the admin scope and", system.AdminAPIKeyEnvVar, "is not set, no API key can be created")
+	return nil
 }
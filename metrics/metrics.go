@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes the name of every metric of the service
+const Namespace = "ssccg"
+
+// Results label the outcome of signatures and database operations
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Metrics holds the Prometheus collectors of the service, in a registry of its own.
+// Every method is a no-op on a nil *Metrics, so instrumented components run unchanged without metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests              *prometheus.CounterVec
+	requestDuration       *prometheus.HistogramVec
+	signatures            *prometheus.CounterVec
+	signatureDuration     *prometheus.HistogramVec
+	keyGenerationDuration *prometheus.HistogramVec
+	lockWaitDuration      prometheus.Histogram
+	queryDuration         *prometheus.HistogramVec
+}
+
+// New creates the collectors, along with the Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle the HTTP requests, by route template and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		signatures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "signatures_total",
+			Help:      "Transactions signed, by device algorithm and result.",
+		}, []string{"algorithm", "result"}),
+		signatureDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "signature_duration_seconds",
+			Help:      "Time taken to sign and store a transaction, by device algorithm.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"algorithm"}),
+		keyGenerationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "key_generation_duration_seconds",
+			Help:      "Time taken to generate the key pair of a device, by algorithm.",
+			// RSA keys take up to seconds
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"algorithm"}),
+		lockWaitDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "device_lock_wait_duration_seconds",
+			Help:      "Time waited to lock a device, before signing with it or changing it.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 12),
+		}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "querier_operation_duration_seconds",
+			Help:      "Time taken by the database operations, by Querier method and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.signatures,
+		m.signatureDuration,
+		m.keyGenerationDuration,
+		m.lockWaitDuration,
+		m.queryDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records an HTTP request handled by the route, labelled with its template and not its path.
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// ObserveSignature records a transaction signed with the algorithm, or failing to be when err is not nil.
+func (m *Metrics) ObserveSignature(algorithm string, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.signatures.WithLabelValues(algorithm, result(err)).Inc()
+	m.signatureDuration.WithLabelValues(algorithm).Observe(duration.Seconds())
+}
+
+// ObserveKeyGeneration records the generation of a key pair for the algorithm.
+func (m *Metrics) ObserveKeyGeneration(algorithm string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.keyGenerationDuration.WithLabelValues(algorithm).Observe(duration.Seconds())
+}
+
+// ObserveLockWait records the time waited to lock a device.
+func (m *Metrics) ObserveLockWait(duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.lockWaitDuration.Observe(duration.Seconds())
+}
+
+// ObserveQuery records a database operation, failed when err is not nil.
+func (m *Metrics) ObserveQuery(operation string, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.queryDuration.WithLabelValues(operation, result(err)).Observe(duration.Seconds())
+}
+
+// result returns the result label of an operation returning err.
+func result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
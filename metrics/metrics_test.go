@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestObserve tests the observations are recorded with their labels.
+func TestObserve(t *testing.T) {
+	m := New()
+
+	m.ObserveRequest("/api/v1/devices/{id}", http.MethodGet, http.StatusOK, time.Millisecond)
+	m.ObserveRequest("/api/v1/devices/{id}", http.MethodGet, http.StatusOK, time.Millisecond)
+	m.ObserveRequest("/api/v1/devices/{id}", http.MethodGet, http.StatusNotFound, time.Millisecond)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("/api/v1/devices/{id}", http.MethodGet, "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("/api/v1/devices/{id}", http.MethodGet, "404")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.requestDuration))
+
+	m.ObserveSignature("ECDSA", nil, time.Millisecond)
+	m.ObserveSignature("ECDSA", errors.New("key store unavailable"), time.Millisecond)
+	m.ObserveSignature("RSA", nil, time.Millisecond)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.signatures.WithLabelValues("ECDSA", ResultSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.signatures.WithLabelValues("ECDSA", ResultError)))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.signatureDuration))
+
+	m.ObserveKeyGeneration("RSA", time.Second)
+	assert.Equal(t, 1, testutil.CollectAndCount(m.keyGenerationDuration))
+
+	m.ObserveLockWait(time.Microsecond)
+	assert.Equal(t, 1, testutil.CollectAndCount(m.lockWaitDuration))
+
+	m.ObserveQuery("GetDevice", nil, time.Millisecond)
+	m.ObserveQuery("GetDevice", errors.New("connection lost"), time.Millisecond)
+	assert.Equal(t, 2, testutil.CollectAndCount(m.queryDuration))
+}
+
+// TestHandler tests the metrics are served in the Prometheus exposition format.
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ObserveSignature("ED25519", nil, time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `ssccg_signatures_total{algorithm="ED25519",result="success"} 1`)
+	assert.Contains(t, rr.Body.String(), "go_goroutines")
+}
+
+// TestNilMetrics tests the observations are ignored without metrics.
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+
+	assert.NotPanics(t, func() {
+		m.ObserveRequest("/api/v1/health", http.MethodGet, http.StatusOK, time.Millisecond)
+		m.ObserveSignature("ECDSA", nil, time.Millisecond)
+		m.ObserveKeyGeneration("ECDSA", time.Millisecond)
+		m.ObserveLockWait(time.Millisecond)
+		m.ObserveQuery("GetDevice", nil, time.Millisecond)
+	})
+}
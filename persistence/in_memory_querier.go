@@ -5,7 +5,10 @@ import (
 	"errors"
 	"github.com/google/uuid"
 	"github.com/ildomm/ssccg/domain"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 )
 
 type InMemoryQuerier struct {
@@ -13,15 +16,39 @@ type InMemoryQuerier struct {
 	ctx             context.Context
 	devices         map[uuid.UUID]domain.Device
 	signedTransacts map[uuid.UUID][]domain.SignedTransaction
+	deviceKeys      map[uuid.UUID][]domain.DeviceKey
+	statusChanges   map[uuid.UUID][]domain.DeviceStatusChange
+	lastCreationSeq int64
+	idempotencyKeys map[idempotencyKeyID]domain.IdempotencyKey
+	apiKeys         map[uuid.UUID]domain.APIKey
+
+	// signedTransactIndex locates each signed transaction by its ID
+	signedTransactIndex map[uuid.UUID]signedTransactionKey
 }
 
-var ErrDeviceNotFound = errors.New("device not found")
+// idempotencyKeyID identifies an idempotency key, scoped per device
+type idempotencyKeyID struct {
+	deviceId uuid.UUID
+	key      string
+}
+
+// signedTransactionKey locates a signed transaction in its device chain
+type signedTransactionKey struct {
+	deviceId    uuid.UUID
+	signCounter int
+}
 
 func NewInMemoryQuerier(ctx context.Context) (*InMemoryQuerier, error) {
 	return &InMemoryQuerier{
 		ctx:             ctx,
 		devices:         make(map[uuid.UUID]domain.Device),
 		signedTransacts: make(map[uuid.UUID][]domain.SignedTransaction),
+		deviceKeys:      make(map[uuid.UUID][]domain.DeviceKey),
+		statusChanges:   make(map[uuid.UUID][]domain.DeviceStatusChange),
+		idempotencyKeys: make(map[idempotencyKeyID]domain.IdempotencyKey),
+		apiKeys:         make(map[uuid.UUID]domain.APIKey),
+
+		signedTransactIndex: make(map[uuid.UUID]signedTransactionKey),
 	}, nil
 }
 
@@ -31,14 +58,38 @@ func (q *InMemoryQuerier) Close() {
 	// Nothing to do here for in-memory storage
 }
 
+// WithTx runs fn against a copy-on-write view of the storage.
+// Writes made through the view are applied all at once when fn succeeds, and discarded otherwise.
+func (q *InMemoryQuerier) WithTx(fn func(tx Querier) error) error {
+	tx := newInMemoryTx(q)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
 func (q *InMemoryQuerier) SaveDevice(device domain.Device) error {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	q.devices[device.ID] = device
+	if _, exists := q.devices[device.ID]; exists {
+		return ErrDeviceExists
+	}
+	q.saveDevice(device)
 	return nil
 }
 
+// saveDevice stores a device, assigning its creation sequence when it is new.
+func (q *InMemoryQuerier) saveDevice(device domain.Device) {
+	if stored, exists := q.devices[device.ID]; exists {
+		device.CreationSeq = stored.CreationSeq
+	} else {
+		q.lastCreationSeq++
+		device.CreationSeq = q.lastCreationSeq
+	}
+	q.devices[device.ID] = device
+}
+
 func (q *InMemoryQuerier) GetDevices() ([]domain.Device, error) {
 	q.lock.Lock()
 	defer q.lock.Unlock()
@@ -73,6 +124,26 @@ func (q *InMemoryQuerier) UpdateDevice(device domain.Device) error {
 	return nil
 }
 
+// GetDeviceForUpdate reads a device as GetDevice does.
+// Stored in memory, devices are served by a single instance, whose device locks already serialize the writers.
+func (q *InMemoryQuerier) GetDeviceForUpdate(id uuid.UUID) (*domain.Device, error) {
+	return q.GetDevice(id)
+}
+
+func (q *InMemoryQuerier) UpdateDeviceSignCounter(device domain.Device) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	stored, exists := q.devices[device.ID]
+	if !exists {
+		return ErrDeviceNotFound
+	}
+	stored.SignCounter = device.SignCounter
+	stored.UpdatedAt = device.UpdatedAt
+	q.devices[device.ID] = stored
+	return nil
+}
+
 func (q *InMemoryQuerier) SaveSignedTransaction(transaction domain.SignedTransaction) (uuid.UUID, error) {
 	q.lock.Lock()
 	defer q.lock.Unlock()
@@ -83,7 +154,12 @@ func (q *InMemoryQuerier) SaveSignedTransaction(transaction domain.SignedTransac
 		return uuid.Nil, ErrDeviceNotFound
 	}
 
+	if err := validateChainAppend(q.signedTransacts[transaction.DeviceID], transaction); err != nil {
+		return uuid.Nil, err
+	}
+
 	q.signedTransacts[transaction.DeviceID] = append(q.signedTransacts[transaction.DeviceID], transaction)
+	q.indexSignedTransaction(transaction)
 	return transaction.ID, nil
 }
 
@@ -91,12 +167,40 @@ func (q *InMemoryQuerier) GetSignedTransaction(deviceId uuid.UUID, signCounter i
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	for _, transaction := range q.signedTransacts[deviceId] {
-		if transaction.SignCounter == signCounter {
-			return &transaction, nil
-		}
+	return q.getSignedTransaction(deviceId, signCounter), nil
+}
+
+func (q *InMemoryQuerier) GetSignedTransactionByID(id uuid.UUID) (*domain.SignedTransaction, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	key, found := q.signedTransactIndex[id]
+	if !found {
+		return nil, nil
 	}
-	return nil, nil
+	return q.getSignedTransaction(key.deviceId, key.signCounter), nil
+}
+
+// indexSignedTransaction makes a stored transaction reachable by its ID.
+func (q *InMemoryQuerier) indexSignedTransaction(transaction domain.SignedTransaction) {
+	q.signedTransactIndex[transaction.ID] = signedTransactionKey{
+		deviceId:    transaction.DeviceID,
+		signCounter: transaction.SignCounter,
+	}
+}
+
+// getSignedTransaction returns the transaction of a device chain with the given sign counter, nil if there is none.
+func (q *InMemoryQuerier) getSignedTransaction(deviceId uuid.UUID, signCounter int) *domain.SignedTransaction {
+	// Transactions are kept in sign counter order
+	transactions := q.signedTransacts[deviceId]
+	i := sort.Search(len(transactions), func(i int) bool {
+		return transactions[i].SignCounter >= signCounter
+	})
+	if i < len(transactions) && transactions[i].SignCounter == signCounter {
+		transaction := transactions[i]
+		return &transaction
+	}
+	return nil
 }
 
 func (q *InMemoryQuerier) GetSignedTransactions(deviceId uuid.UUID) ([]domain.SignedTransaction, error) {
@@ -105,3 +209,523 @@ func (q *InMemoryQuerier) GetSignedTransactions(deviceId uuid.UUID) ([]domain.Si
 
 	return q.signedTransacts[deviceId], nil
 }
+
+func (q *InMemoryQuerier) ListDevices(filter DeviceFilter, page Page) ([]domain.Device, error) {
+	devices, err := q.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+	return pageDevices(devices, filter, page), nil
+}
+
+func (q *InMemoryQuerier) ListSignedTransactions(deviceId uuid.UUID, filter SignedTransactionFilter, page Page) ([]domain.SignedTransaction, error) {
+	transactions, err := q.GetSignedTransactions(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return pageSignedTransactions(transactions, filter, page), nil
+}
+
+func (q *InMemoryQuerier) SaveDeviceKey(key domain.DeviceKey) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, deviceExists := q.devices[key.DeviceID]; !deviceExists {
+		return ErrDeviceNotFound
+	}
+
+	q.deviceKeys[key.DeviceID] = appendDeviceKey(q.deviceKeys[key.DeviceID], key)
+	return nil
+}
+
+func (q *InMemoryQuerier) GetDeviceKeys(deviceId uuid.UUID) ([]domain.DeviceKey, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return append([]domain.DeviceKey(nil), q.deviceKeys[deviceId]...), nil
+}
+
+func (q *InMemoryQuerier) SaveDeviceStatusChange(change domain.DeviceStatusChange) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, deviceExists := q.devices[change.DeviceID]; !deviceExists {
+		return ErrDeviceNotFound
+	}
+
+	q.statusChanges[change.DeviceID] = append(q.statusChanges[change.DeviceID], change)
+	return nil
+}
+
+func (q *InMemoryQuerier) GetDeviceStatusChanges(deviceId uuid.UUID) ([]domain.DeviceStatusChange, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return append([]domain.DeviceStatusChange(nil), q.statusChanges[deviceId]...), nil
+}
+
+func (q *InMemoryQuerier) SaveIdempotencyKey(key domain.IdempotencyKey, replaceUpTo time.Time) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, deviceExists := q.devices[key.DeviceID]; !deviceExists {
+		return ErrDeviceNotFound
+	}
+	id := idempotencyKeyID{key.DeviceID, key.Key}
+	if stored, found := q.idempotencyKeys[id]; found && !replaceableIdempotencyKey(stored, replaceUpTo) {
+		return ErrIdempotencyKeyConflict
+	}
+
+	q.idempotencyKeys[id] = key
+	return nil
+}
+
+// replaceableIdempotencyKey reports whether a stored idempotency key may be replaced, having been created at or before replaceUpTo.
+func replaceableIdempotencyKey(stored domain.IdempotencyKey, replaceUpTo time.Time) bool {
+	return !stored.CreatedAt.After(replaceUpTo)
+}
+
+func (q *InMemoryQuerier) GetIdempotencyKey(deviceId uuid.UUID, key string) (*domain.IdempotencyKey, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	stored, found := q.idempotencyKeys[idempotencyKeyID{deviceId, key}]
+	if !found {
+		return nil, nil
+	}
+	return &stored, nil
+}
+
+func (q *InMemoryQuerier) DeleteIdempotencyKeys(createdBefore time.Time) (int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	deleted := 0
+	for id, key := range q.idempotencyKeys {
+		if key.CreatedAt.Before(createdBefore) {
+			delete(q.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (q *InMemoryQuerier) SaveAPIKey(key domain.APIKey) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.apiKeys[key.ID] = cloneAPIKey(key)
+	return nil
+}
+
+func (q *InMemoryQuerier) GetAPIKeyByHash(keyHash string) (*domain.APIKey, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, key := range q.apiKeys {
+		if key.KeyHash == keyHash {
+			stored := cloneAPIKey(key)
+			return &stored, nil
+		}
+	}
+	return nil, nil
+}
+
+func (q *InMemoryQuerier) GetAPIKeys() ([]domain.APIKey, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	keys := make([]domain.APIKey, 0, len(q.apiKeys))
+	for _, key := range q.apiKeys {
+		keys = append(keys, cloneAPIKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID.String() < keys[j].ID.String()
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (q *InMemoryQuerier) DeleteAPIKey(id uuid.UUID) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, found := q.apiKeys[id]; !found {
+		return ErrAPIKeyNotFound
+	}
+	delete(q.apiKeys, id)
+	return nil
+}
+
+// cloneAPIKey copies a key along with its lists, so the stored key is not shared with the caller.
+func cloneAPIKey(key domain.APIKey) domain.APIKey {
+	key.Scopes = slices.Clone(key.Scopes)
+	key.DeviceIDs = slices.Clone(key.DeviceIDs)
+	return key
+}
+
+// appendDeviceKey adds a key to the keys of a device, keeping them in validity order.
+func appendDeviceKey(keys []domain.DeviceKey, key domain.DeviceKey) []domain.DeviceKey {
+	keys = append(keys, key)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].ValidFrom < keys[j].ValidFrom
+	})
+	return keys
+}
+
+// validateChainAppend checks that the transaction can be appended to its device chain.
+// Transactions are kept in sign counter order, so a counter not above the last one is already used.
+func validateChainAppend(chain []domain.SignedTransaction, transaction domain.SignedTransaction) error {
+	if len(chain) > 0 && chain[len(chain)-1].SignCounter >= transaction.SignCounter {
+		return ErrSignCounterConflict
+	}
+	return nil
+}
+
+////////////////////////////////// Transactional operations ////////////////////////////////////////////////////////////
+
+// inMemoryTx is the copy-on-write view handed to WithTx callbacks.
+// Reads fall through to the parent storage unless the same record was written within the transaction,
+// writes are kept aside until commit. It is not safe for concurrent use.
+type inMemoryTx struct {
+	parent          *InMemoryQuerier
+	devices         map[uuid.UUID]domain.Device
+	newDevices      []uuid.UUID
+	signCounters    map[uuid.UUID]domain.Device
+	signedTransacts []domain.SignedTransaction
+	deviceKeys      []domain.DeviceKey
+	statusChanges   []domain.DeviceStatusChange
+	idempotencyKeys []stagedIdempotencyKey
+}
+
+// stagedIdempotencyKey is an idempotency key saved within a transaction, along with the latest creation time of the key it may replace
+type stagedIdempotencyKey struct {
+	key         domain.IdempotencyKey
+	replaceUpTo time.Time
+}
+
+func newInMemoryTx(parent *InMemoryQuerier) *inMemoryTx {
+	return &inMemoryTx{
+		parent:       parent,
+		devices:      make(map[uuid.UUID]domain.Device),
+		signCounters: make(map[uuid.UUID]domain.Device),
+	}
+}
+
+func (tx *inMemoryTx) Close() {
+	// Nothing to do here, the transaction is closed by WithTx
+}
+
+// WithTx joins the ongoing transaction.
+func (tx *inMemoryTx) WithTx(fn func(tx Querier) error) error {
+	return fn(tx)
+}
+
+// SaveDevice stages a new device, checked again on commit against the devices saved meanwhile.
+func (tx *inMemoryTx) SaveDevice(device domain.Device) error {
+	_, err := tx.GetDevice(device.ID)
+	if err == nil {
+		return ErrDeviceExists
+	}
+	if !errors.Is(err, ErrDeviceNotFound) {
+		return err
+	}
+
+	tx.newDevices = append(tx.newDevices, device.ID)
+	tx.devices[device.ID] = device
+	return nil
+}
+
+func (tx *inMemoryTx) GetDevices() ([]domain.Device, error) {
+	devices, err := tx.parent.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, device := range devices {
+		if written, ok := tx.devices[device.ID]; ok {
+			devices[i] = written
+		}
+	}
+	for _, id := range tx.newDevices {
+		if _, err := tx.parent.GetDevice(id); err != nil {
+			devices = append(devices, tx.devices[id])
+		}
+	}
+	return devices, nil
+}
+
+func (tx *inMemoryTx) GetDevice(id uuid.UUID) (*domain.Device, error) {
+	if device, ok := tx.devices[id]; ok {
+		return &device, nil
+	}
+	device, err := tx.parent.GetDevice(id)
+	if err != nil {
+		return nil, err
+	}
+	if counter, ok := tx.signCounters[id]; ok {
+		device.SignCounter = counter.SignCounter
+		device.UpdatedAt = counter.UpdatedAt
+	}
+	return device, nil
+}
+
+func (tx *inMemoryTx) UpdateDevice(device domain.Device) error {
+	if _, err := tx.GetDevice(device.ID); err != nil {
+		return err
+	}
+	tx.devices[device.ID] = device
+	return nil
+}
+
+func (tx *inMemoryTx) GetDeviceForUpdate(id uuid.UUID) (*domain.Device, error) {
+	return tx.GetDevice(id)
+}
+
+// UpdateDeviceSignCounter keeps the sign counter aside, so only it and the update time are applied on commit.
+// Devices written whole within the transaction have their counter updated in place.
+func (tx *inMemoryTx) UpdateDeviceSignCounter(device domain.Device) error {
+	if _, err := tx.GetDevice(device.ID); err != nil {
+		return err
+	}
+	if written, ok := tx.devices[device.ID]; ok {
+		written.SignCounter = device.SignCounter
+		written.UpdatedAt = device.UpdatedAt
+		tx.devices[device.ID] = written
+		return nil
+	}
+	tx.signCounters[device.ID] = device
+	return nil
+}
+
+func (tx *inMemoryTx) SaveSignedTransaction(transaction domain.SignedTransaction) (uuid.UUID, error) {
+	if _, err := tx.GetDevice(transaction.DeviceID); err != nil {
+		return uuid.Nil, err
+	}
+
+	tx.signedTransacts = append(tx.signedTransacts, transaction)
+	return transaction.ID, nil
+}
+
+func (tx *inMemoryTx) GetSignedTransaction(deviceId uuid.UUID, signCounter int) (*domain.SignedTransaction, error) {
+	for _, transaction := range tx.signedTransacts {
+		if transaction.DeviceID == deviceId && transaction.SignCounter == signCounter {
+			return &transaction, nil
+		}
+	}
+	return tx.parent.GetSignedTransaction(deviceId, signCounter)
+}
+
+func (tx *inMemoryTx) GetSignedTransactionByID(id uuid.UUID) (*domain.SignedTransaction, error) {
+	for _, transaction := range tx.signedTransacts {
+		if transaction.ID == id {
+			return &transaction, nil
+		}
+	}
+	return tx.parent.GetSignedTransactionByID(id)
+}
+
+func (tx *inMemoryTx) GetSignedTransactions(deviceId uuid.UUID) ([]domain.SignedTransaction, error) {
+	stored, err := tx.parent.GetSignedTransactions(deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy, so the pending transactions never leak into the parent storage
+	transactions := append([]domain.SignedTransaction(nil), stored...)
+	for _, transaction := range tx.signedTransacts {
+		if transaction.DeviceID == deviceId {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions, nil
+}
+
+func (tx *inMemoryTx) ListDevices(filter DeviceFilter, page Page) ([]domain.Device, error) {
+	devices, err := tx.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+	return pageDevices(devices, filter, page), nil
+}
+
+func (tx *inMemoryTx) ListSignedTransactions(deviceId uuid.UUID, filter SignedTransactionFilter, page Page) ([]domain.SignedTransaction, error) {
+	transactions, err := tx.GetSignedTransactions(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return pageSignedTransactions(transactions, filter, page), nil
+}
+
+func (tx *inMemoryTx) SaveDeviceKey(key domain.DeviceKey) error {
+	if _, err := tx.GetDevice(key.DeviceID); err != nil {
+		return err
+	}
+
+	tx.deviceKeys = append(tx.deviceKeys, key)
+	return nil
+}
+
+func (tx *inMemoryTx) GetDeviceKeys(deviceId uuid.UUID) ([]domain.DeviceKey, error) {
+	keys, err := tx.parent.GetDeviceKeys(deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range tx.deviceKeys {
+		if key.DeviceID == deviceId {
+			keys = appendDeviceKey(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (tx *inMemoryTx) SaveDeviceStatusChange(change domain.DeviceStatusChange) error {
+	if _, err := tx.GetDevice(change.DeviceID); err != nil {
+		return err
+	}
+
+	tx.statusChanges = append(tx.statusChanges, change)
+	return nil
+}
+
+func (tx *inMemoryTx) GetDeviceStatusChanges(deviceId uuid.UUID) ([]domain.DeviceStatusChange, error) {
+	changes, err := tx.parent.GetDeviceStatusChanges(deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range tx.statusChanges {
+		if change.DeviceID == deviceId {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// SaveIdempotencyKey stages a key, checked again on commit against the keys saved meanwhile.
+func (tx *inMemoryTx) SaveIdempotencyKey(key domain.IdempotencyKey, replaceUpTo time.Time) error {
+	if _, err := tx.GetDevice(key.DeviceID); err != nil {
+		return err
+	}
+	stored, err := tx.GetIdempotencyKey(key.DeviceID, key.Key)
+	if err != nil {
+		return err
+	}
+	if stored != nil && !replaceableIdempotencyKey(*stored, replaceUpTo) {
+		return ErrIdempotencyKeyConflict
+	}
+
+	tx.idempotencyKeys = append(tx.idempotencyKeys, stagedIdempotencyKey{key: key, replaceUpTo: replaceUpTo})
+	return nil
+}
+
+func (tx *inMemoryTx) GetIdempotencyKey(deviceId uuid.UUID, key string) (*domain.IdempotencyKey, error) {
+	// The latest write of the key wins
+	for i := len(tx.idempotencyKeys) - 1; i >= 0; i-- {
+		if pending := tx.idempotencyKeys[i].key; pending.DeviceID == deviceId && pending.Key == key {
+			return &pending, nil
+		}
+	}
+	return tx.parent.GetIdempotencyKey(deviceId, key)
+}
+
+// DeleteIdempotencyKeys purges the stored keys right away, it is not part of the unit of work.
+func (tx *inMemoryTx) DeleteIdempotencyKeys(createdBefore time.Time) (int, error) {
+	return tx.parent.DeleteIdempotencyKeys(createdBefore)
+}
+
+// SaveAPIKey stores the key right away, it is not part of the unit of work.
+func (tx *inMemoryTx) SaveAPIKey(key domain.APIKey) error {
+	return tx.parent.SaveAPIKey(key)
+}
+
+func (tx *inMemoryTx) GetAPIKeyByHash(keyHash string) (*domain.APIKey, error) {
+	return tx.parent.GetAPIKeyByHash(keyHash)
+}
+
+func (tx *inMemoryTx) GetAPIKeys() ([]domain.APIKey, error) {
+	return tx.parent.GetAPIKeys()
+}
+
+// DeleteAPIKey deletes the key right away, it is not part of the unit of work.
+func (tx *inMemoryTx) DeleteAPIKey(id uuid.UUID) error {
+	return tx.parent.DeleteAPIKey(id)
+}
+
+// commit validates and applies every pending write to the parent storage at once.
+// Nothing is applied when any of the writes conflicts with the current parent state.
+func (tx *inMemoryTx) commit() error {
+	q := tx.parent
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	// Chains are extended apart from the parent, so a conflict leaves it untouched
+	chains := make(map[uuid.UUID][]domain.SignedTransaction)
+	for _, transaction := range tx.signedTransacts {
+		_, written := tx.devices[transaction.DeviceID]
+		_, stored := q.devices[transaction.DeviceID]
+		if !written && !stored {
+			return ErrDeviceNotFound
+		}
+
+		chain, staged := chains[transaction.DeviceID]
+		if !staged {
+			chain = q.signedTransacts[transaction.DeviceID]
+		}
+		if err := validateChainAppend(chain, transaction); err != nil {
+			return err
+		}
+		chains[transaction.DeviceID] = append(chain, transaction)
+	}
+
+	for id := range tx.signCounters {
+		if _, stored := q.devices[id]; !stored {
+			return ErrDeviceNotFound
+		}
+	}
+	for _, id := range tx.newDevices {
+		if _, stored := q.devices[id]; stored {
+			return ErrDeviceExists
+		}
+	}
+	for _, staged := range tx.idempotencyKeys {
+		stored, found := q.idempotencyKeys[idempotencyKeyID{staged.key.DeviceID, staged.key.Key}]
+		if found && !replaceableIdempotencyKey(stored, staged.replaceUpTo) {
+			return ErrIdempotencyKeyConflict
+		}
+	}
+
+	// New devices are given their creation sequence in the order they were saved
+	for _, id := range tx.newDevices {
+		q.saveDevice(tx.devices[id])
+	}
+	for _, device := range tx.devices {
+		q.saveDevice(device)
+	}
+	// Only the counters are written, the other columns may have changed since they were read
+	for id, counter := range tx.signCounters {
+		stored := q.devices[id]
+		stored.SignCounter = counter.SignCounter
+		stored.UpdatedAt = counter.UpdatedAt
+		q.devices[id] = stored
+	}
+	for id, chain := range chains {
+		q.signedTransacts[id] = chain
+	}
+	for _, transaction := range tx.signedTransacts {
+		q.indexSignedTransaction(transaction)
+	}
+	for _, key := range tx.deviceKeys {
+		q.deviceKeys[key.DeviceID] = appendDeviceKey(q.deviceKeys[key.DeviceID], key)
+	}
+	for _, change := range tx.statusChanges {
+		q.statusChanges[change.DeviceID] = append(q.statusChanges[change.DeviceID], change)
+	}
+	for _, staged := range tx.idempotencyKeys {
+		q.idempotencyKeys[idempotencyKeyID{staged.key.DeviceID, staged.key.Key}] = staged.key
+	}
+	return nil
+}
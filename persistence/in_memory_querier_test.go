@@ -2,7 +2,9 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/ildomm/ssccg/domain"
@@ -25,7 +27,7 @@ func TestInMemorySaveAndGetDevice(t *testing.T) {
 		SignCounter:   0,
 		SignAlgorithm: "RSA",
 		PublicKey:     "public key",
-		PrivateKey:    "private key",
+		KeyHandle:     "local:private key",
 	}
 
 	err := querier.SaveDevice(device)
@@ -37,6 +39,45 @@ func TestInMemorySaveAndGetDevice(t *testing.T) {
 	assert.Equal(t, device.ID, retrievedDevice.ID)
 }
 
+func TestInMemorySaveDeviceExists(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), Label: "Test Device", SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	other := device
+	other.Label = "Other Device"
+	assert.Equal(t, ErrDeviceExists, querier.SaveDevice(other))
+	err := querier.WithTx(func(tx Querier) error {
+		return tx.SaveDevice(other)
+	})
+	assert.Equal(t, ErrDeviceExists, err)
+
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, "Test Device", stored.Label)
+}
+
+func TestInMemoryWithTxSaveDeviceConflictOnCommit(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), Label: "Test Device", SignAlgorithm: "RSA"}
+
+	err := querier.WithTx(func(tx Querier) error {
+		staged := device
+		staged.Label = "Staged Device"
+		if err := tx.SaveDevice(staged); err != nil {
+			return err
+		}
+
+		// A concurrent writer saves a device with the same ID before the commit
+		return querier.SaveDevice(device)
+	})
+	assert.Equal(t, ErrDeviceExists, err)
+
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, "Test Device", stored.Label)
+}
+
 func TestInMemoryGetDeviceNotFound(t *testing.T) {
 	ctx := context.TODO()
 	querier, _ := NewInMemoryQuerier(ctx)
@@ -57,7 +98,7 @@ func TestInMemoryUpdateDevice(t *testing.T) {
 		SignCounter:   0,
 		SignAlgorithm: "RSA",
 		PublicKey:     "public key",
-		PrivateKey:    "private key",
+		KeyHandle:     "local:private key",
 	}
 
 	// Save first, then update
@@ -80,7 +121,7 @@ func TestInMemoryUpdateDeviceNotFound(t *testing.T) {
 		SignCounter:   0,
 		SignAlgorithm: "RSA",
 		PublicKey:     "public key",
-		PrivateKey:    "private key",
+		KeyHandle:     "local:private key",
 	}
 
 	err := querier.UpdateDevice(device)
@@ -99,7 +140,7 @@ func TestInMemorySaveSignedTransactionWithDevice(t *testing.T) {
 		SignCounter:   0,
 		SignAlgorithm: "RSA",
 		PublicKey:     "public key",
-		PrivateKey:    "private key",
+		KeyHandle:     "local:private key",
 	}
 	err := querier.SaveDevice(device)
 	assert.NoError(t, err)
@@ -150,3 +191,514 @@ func TestInMemoryGetSignedTransactionsEmpty(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, signatures)
 }
+
+func TestInMemorySaveSignedTransactionCounterConflict(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	transaction := domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 1}
+	_, err := querier.SaveSignedTransaction(transaction)
+	assert.NoError(t, err)
+
+	transaction.ID = uuid.New()
+	_, err = querier.SaveSignedTransaction(transaction)
+	assert.Equal(t, ErrSignCounterConflict, err)
+}
+
+func TestInMemoryWithTxCommit(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	transaction := domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 1}
+	err := querier.WithTx(func(tx Querier) error {
+		if _, err := tx.SaveSignedTransaction(transaction); err != nil {
+			return err
+		}
+		device.SignCounter++
+		if err := tx.UpdateDevice(device); err != nil {
+			return err
+		}
+
+		// Writes are visible within the transaction only
+		pending, _ := tx.GetDevice(device.ID)
+		assert.Equal(t, 1, pending.SignCounter)
+		pendingTransaction, _ := tx.GetSignedTransaction(device.ID, 1)
+		assert.Equal(t, &transaction, pendingTransaction)
+
+		stored, _ := querier.GetDevice(device.ID)
+		assert.Equal(t, 0, stored.SignCounter)
+		storedTransactions, _ := querier.GetSignedTransactions(device.ID)
+		assert.Empty(t, storedTransactions)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, 1, stored.SignCounter)
+	storedTransactions, _ := querier.GetSignedTransactions(device.ID)
+	assert.Equal(t, []domain.SignedTransaction{transaction}, storedTransactions)
+}
+
+func TestInMemoryWithTxRollback(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	failure := errors.New("failure")
+	err := querier.WithTx(func(tx Querier) error {
+		_, _ = tx.SaveSignedTransaction(domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 1})
+		device.SignCounter++
+		_ = tx.UpdateDevice(device)
+		_ = tx.SaveDevice(domain.Device{ID: uuid.New()})
+		return failure
+	})
+	assert.Equal(t, failure, err)
+
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, 0, stored.SignCounter)
+	storedTransactions, _ := querier.GetSignedTransactions(device.ID)
+	assert.Empty(t, storedTransactions)
+	devices, _ := querier.GetDevices()
+	assert.Len(t, devices, 1)
+}
+
+func TestInMemoryWithTxConflictOnCommit(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	err := querier.WithTx(func(tx Querier) error {
+		_, _ = tx.SaveSignedTransaction(domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 1})
+		device.SignCounter++
+		_ = tx.UpdateDevice(device)
+
+		// A concurrent writer takes the same counter before the commit
+		_, err := querier.SaveSignedTransaction(domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 1})
+		return err
+	})
+	assert.Equal(t, ErrSignCounterConflict, err)
+
+	// Neither the transaction nor the device update were applied
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, 0, stored.SignCounter)
+	storedTransactions, _ := querier.GetSignedTransactions(device.ID)
+	assert.Len(t, storedTransactions, 1)
+}
+
+func TestInMemoryUpdateDeviceSignCounter(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA", Status: domain.DeviceStatusActive}
+	_ = querier.SaveDevice(device)
+
+	device.SignCounter++
+	device.Status = domain.DeviceStatusSuspended
+	err := querier.UpdateDeviceSignCounter(device)
+	assert.NoError(t, err)
+
+	// Only the sign counter was written
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, 1, stored.SignCounter)
+	assert.Equal(t, domain.DeviceStatusActive, stored.Status)
+
+	err = querier.UpdateDeviceSignCounter(domain.Device{ID: uuid.New()})
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func TestInMemoryWithTxUpdateDeviceSignCounter(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA", Status: domain.DeviceStatusActive, KeyHandle: "local:old"}
+	_ = querier.SaveDevice(device)
+
+	err := querier.WithTx(func(tx Querier) error {
+		locked, err := tx.GetDeviceForUpdate(device.ID)
+		if err != nil {
+			return err
+		}
+
+		// A concurrent writer suspends the device and rewraps its key
+		changed := *locked
+		changed.Status = domain.DeviceStatusSuspended
+		changed.KeyHandle = "local:new"
+		_ = querier.UpdateDevice(changed)
+
+		locked.SignCounter++
+		if err := tx.UpdateDeviceSignCounter(*locked); err != nil {
+			return err
+		}
+
+		// The staged counter is read back within the unit of work
+		staged, _ := tx.GetDevice(device.ID)
+		assert.Equal(t, 1, staged.SignCounter)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// The concurrent changes are kept alongside the new counter
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, 1, stored.SignCounter)
+	assert.Equal(t, domain.DeviceStatusSuspended, stored.Status)
+	assert.Equal(t, "local:new", stored.KeyHandle)
+}
+
+func TestInMemorySaveAndGetDeviceKeys(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	second := domain.DeviceKey{DeviceID: device.ID, PublicKey: "second key", ValidFrom: 4, ValidTo: 6}
+	first := domain.DeviceKey{DeviceID: device.ID, PublicKey: "first key", ValidFrom: 1, ValidTo: 3}
+	assert.NoError(t, querier.SaveDeviceKey(second))
+	assert.NoError(t, querier.SaveDeviceKey(first))
+
+	keys, err := querier.GetDeviceKeys(device.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.DeviceKey{first, second}, keys)
+
+	err = querier.SaveDeviceKey(domain.DeviceKey{DeviceID: uuid.New(), PublicKey: "key", ValidFrom: 1, ValidTo: 1})
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func TestInMemoryWithTxDeviceKeys(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+	key := domain.DeviceKey{DeviceID: device.ID, PublicKey: "retired key", ValidFrom: 1, ValidTo: 1}
+
+	failure := errors.New("failure")
+	err := querier.WithTx(func(tx Querier) error {
+		_ = tx.SaveDeviceKey(key)
+		keys, _ := tx.GetDeviceKeys(device.ID)
+		assert.Len(t, keys, 1)
+		return failure
+	})
+	assert.Equal(t, failure, err)
+	keys, _ := querier.GetDeviceKeys(device.ID)
+	assert.Empty(t, keys)
+
+	err = querier.WithTx(func(tx Querier) error {
+		return tx.SaveDeviceKey(key)
+	})
+	assert.NoError(t, err)
+	keys, _ = querier.GetDeviceKeys(device.ID)
+	assert.Equal(t, []domain.DeviceKey{key}, keys)
+}
+
+func TestInMemorySaveAndGetDeviceStatusChanges(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA", Status: domain.DeviceStatusActive}
+	_ = querier.SaveDevice(device)
+
+	change := domain.DeviceStatusChange{
+		ID:         uuid.New(),
+		DeviceID:   device.ID,
+		FromStatus: domain.DeviceStatusActive,
+		ToStatus:   domain.DeviceStatusSuspended,
+		Reason:     "device lost",
+	}
+	err := querier.WithTx(func(tx Querier) error {
+		return tx.SaveDeviceStatusChange(change)
+	})
+	assert.NoError(t, err)
+
+	changes, err := querier.GetDeviceStatusChanges(device.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.DeviceStatusChange{change}, changes)
+
+	change.DeviceID = uuid.New()
+	assert.Equal(t, ErrDeviceNotFound, querier.SaveDeviceStatusChange(change))
+}
+
+func TestInMemoryListDevices(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+
+	var ids []uuid.UUID
+	for i, algorithm := range []string{"RSA", "ECDSA", "RSA", "ED25519", "RSA"} {
+		device := domain.Device{ID: uuid.New(), TenantID: domain.DefaultTenant, Label: "Device", SignAlgorithm: algorithm}
+		if i == 0 {
+			device.Label = "First"
+		}
+		if i == 3 {
+			device.TenantID = "retail"
+		}
+		ids = append(ids, device.ID)
+		_ = querier.SaveDevice(device)
+	}
+	listedIDs := func(devices []domain.Device) []uuid.UUID {
+		var listed []uuid.UUID
+		for _, device := range devices {
+			listed = append(listed, device.ID)
+		}
+		return listed
+	}
+
+	t.Run("CreationOrder", func(t *testing.T) {
+		devices, err := querier.ListDevices(DeviceFilter{}, Page{})
+		assert.NoError(t, err)
+		assert.Equal(t, ids, listedIDs(devices))
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		first, _ := querier.ListDevices(DeviceFilter{}, Page{Limit: 2})
+		assert.Equal(t, ids[:2], listedIDs(first))
+		second, _ := querier.ListDevices(DeviceFilter{}, Page{After: first[1].CreationSeq, Limit: 2})
+		assert.Equal(t, ids[2:4], listedIDs(second))
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		devices, _ := querier.ListDevices(DeviceFilter{SignAlgorithm: "RSA"}, Page{})
+		assert.Equal(t, []uuid.UUID{ids[0], ids[2], ids[4]}, listedIDs(devices))
+		devices, _ = querier.ListDevices(DeviceFilter{Label: "Device", SignAlgorithm: "RSA"}, Page{})
+		assert.Equal(t, []uuid.UUID{ids[2], ids[4]}, listedIDs(devices))
+		devices, _ = querier.ListDevices(DeviceFilter{IDs: []uuid.UUID{ids[3], ids[1]}}, Page{})
+		assert.Equal(t, []uuid.UUID{ids[1], ids[3]}, listedIDs(devices))
+		devices, _ = querier.ListDevices(DeviceFilter{IDs: []uuid.UUID{}}, Page{})
+		assert.Empty(t, devices)
+		devices, _ = querier.ListDevices(DeviceFilter{TenantID: "retail"}, Page{})
+		assert.Equal(t, []uuid.UUID{ids[3]}, listedIDs(devices))
+		devices, _ = querier.ListDevices(DeviceFilter{TenantID: domain.DefaultTenant, SignAlgorithm: "RSA"}, Page{})
+		assert.Equal(t, []uuid.UUID{ids[0], ids[2], ids[4]}, listedIDs(devices))
+	})
+
+	t.Run("UpdateKeepsOrder", func(t *testing.T) {
+		device, _ := querier.GetDevice(ids[0])
+		device.SignCounter++
+		_ = querier.UpdateDevice(*device)
+		_ = querier.WithTx(func(tx Querier) error {
+			return tx.UpdateDevice(*device)
+		})
+		devices, _ := querier.ListDevices(DeviceFilter{}, Page{Limit: 1})
+		assert.Equal(t, ids[:1], listedIDs(devices))
+	})
+}
+
+func TestInMemoryListSignedTransactions(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+	for counter := 1; counter <= 10; counter++ {
+		_, _ = querier.SaveSignedTransaction(domain.SignedTransaction{
+			ID:          uuid.New(),
+			DeviceID:    device.ID,
+			SignCounter: counter,
+			CreatedAt:   time.Date(2024, 1, 2, 3, counter, 0, 0, time.UTC),
+		})
+	}
+	counters := func(transactions []domain.SignedTransaction) []int {
+		var listed []int
+		for _, transaction := range transactions {
+			listed = append(listed, transaction.SignCounter)
+		}
+		return listed
+	}
+
+	transactions, err := querier.ListSignedTransactions(device.ID, SignedTransactionFilter{}, Page{After: 3, Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 5, 6}, counters(transactions))
+
+	transactions, _ = querier.ListSignedTransactions(device.ID, SignedTransactionFilter{FromSignCounter: 5, ToSignCounter: 8}, Page{After: 6})
+	assert.Equal(t, []int{7, 8}, counters(transactions))
+
+	createdAt := func(counter int) time.Time {
+		return time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC).Add(time.Duration(counter) * time.Minute)
+	}
+	transactions, _ = querier.ListSignedTransactions(device.ID, SignedTransactionFilter{From: createdAt(3), To: createdAt(5)}, Page{})
+	assert.Equal(t, []int{3, 4}, counters(transactions))
+
+	_ = querier.WithTx(func(tx Querier) error {
+		_, _ = tx.SaveSignedTransaction(domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 11})
+		transactions, _ = tx.ListSignedTransactions(device.ID, SignedTransactionFilter{FromSignCounter: 10}, Page{})
+		assert.Equal(t, []int{10, 11}, counters(transactions))
+		return errors.New("rollback")
+	})
+}
+
+func TestInMemoryGetSignedTransactionByID(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	first := domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 1}
+	_, _ = querier.SaveSignedTransaction(first)
+	second := domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 2}
+	err := querier.WithTx(func(tx Querier) error {
+		_, err := tx.SaveSignedTransaction(second)
+		assert.NoError(t, err)
+
+		pending, err := tx.GetSignedTransactionByID(second.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &second, pending)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for _, transaction := range []domain.SignedTransaction{first, second} {
+		retrieved, err := querier.GetSignedTransactionByID(transaction.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &transaction, retrieved)
+	}
+
+	missing, err := querier.GetSignedTransactionByID(uuid.New())
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestInMemorySaveAndGetIdempotencyKey(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	key := domain.IdempotencyKey{
+		DeviceID:      device.ID,
+		Key:           "retry-1",
+		RequestHash:   "hash",
+		TransactionID: uuid.New(),
+		CreatedAt:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	err := querier.WithTx(func(tx Querier) error {
+		if err := tx.SaveIdempotencyKey(key, key.CreatedAt.Add(-time.Hour)); err != nil {
+			return err
+		}
+
+		// The pending key is visible within the unit of work only
+		pending, err := tx.GetIdempotencyKey(device.ID, key.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, &key, pending)
+		stored, err := querier.GetIdempotencyKey(device.ID, key.Key)
+		assert.NoError(t, err)
+		assert.Nil(t, stored)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	stored, err := querier.GetIdempotencyKey(device.ID, key.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, &key, stored)
+
+	// Keys are scoped per device
+	stored, err = querier.GetIdempotencyKey(uuid.New(), key.Key)
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// The key is only replaced once expired
+	replacing := key
+	replacing.RequestHash = "other hash"
+	replacing.CreatedAt = key.CreatedAt.Add(time.Hour)
+	assert.Equal(t, ErrIdempotencyKeyConflict, querier.SaveIdempotencyKey(replacing, key.CreatedAt.Add(-time.Second)))
+	err = querier.WithTx(func(tx Querier) error {
+		return tx.SaveIdempotencyKey(replacing, key.CreatedAt.Add(-time.Second))
+	})
+	assert.Equal(t, ErrIdempotencyKeyConflict, err)
+	stored, _ = querier.GetIdempotencyKey(device.ID, key.Key)
+	assert.Equal(t, &key, stored)
+
+	assert.NoError(t, querier.SaveIdempotencyKey(replacing, key.CreatedAt))
+	stored, _ = querier.GetIdempotencyKey(device.ID, key.Key)
+	assert.Equal(t, &replacing, stored)
+
+	key.DeviceID = uuid.New()
+	assert.Equal(t, ErrDeviceNotFound, querier.SaveIdempotencyKey(key, key.CreatedAt))
+}
+
+func TestInMemoryWithTxIdempotencyKeyConflictOnCommit(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := domain.IdempotencyKey{DeviceID: device.ID, Key: "retry-1", TransactionID: uuid.New(), CreatedAt: createdAt}
+	err := querier.WithTx(func(tx Querier) error {
+		second := first
+		second.TransactionID = uuid.New()
+		if err := tx.SaveIdempotencyKey(second, createdAt.Add(-time.Hour)); err != nil {
+			return err
+		}
+
+		// A concurrent retry saves the key before the commit
+		return querier.SaveIdempotencyKey(first, createdAt.Add(-time.Hour))
+	})
+	assert.Equal(t, ErrIdempotencyKeyConflict, err)
+
+	stored, _ := querier.GetIdempotencyKey(device.ID, first.Key)
+	assert.Equal(t, &first, stored)
+}
+
+func TestInMemoryDeleteIdempotencyKeys(t *testing.T) {
+	ctx := context.TODO()
+	querier, _ := NewInMemoryQuerier(ctx)
+	device := domain.Device{ID: uuid.New(), SignAlgorithm: "RSA"}
+	_ = querier.SaveDevice(device)
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, key := range []string{"old", "new"} {
+		_ = querier.SaveIdempotencyKey(domain.IdempotencyKey{
+			DeviceID:  device.ID,
+			Key:       key,
+			CreatedAt: createdAt.Add(time.Duration(i) * time.Hour),
+		}, createdAt)
+	}
+
+	deleted, err := querier.DeleteIdempotencyKeys(createdAt.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	old, _ := querier.GetIdempotencyKey(device.ID, "old")
+	assert.Nil(t, old)
+	kept, _ := querier.GetIdempotencyKey(device.ID, "new")
+	assert.NotNil(t, kept)
+}
+
+func TestInMemorySaveAndGetAPIKeys(t *testing.T) {
+	querier, _ := NewInMemoryQuerier(context.TODO())
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	restricted := domain.APIKey{
+		ID:        uuid.New(),
+		TenantID:  "retail",
+		Name:      "terminal",
+		KeyHash:   "hash-2",
+		Scopes:    []string{domain.ScopeSignaturesCreate},
+		DeviceIDs: []uuid.UUID{uuid.New()},
+		CreatedAt: createdAt.Add(time.Hour),
+	}
+	admin := domain.APIKey{ID: uuid.New(), Name: "admin", KeyHash: "hash-1", Scopes: []string{domain.ScopeAdmin}, CreatedAt: createdAt}
+	assert.NoError(t, querier.SaveAPIKey(restricted))
+	assert.NoError(t, querier.SaveAPIKey(admin))
+
+	stored, err := querier.GetAPIKeyByHash("hash-2")
+	assert.NoError(t, err)
+	assert.Equal(t, &restricted, stored)
+
+	// The stored key is not shared with the caller
+	stored.Scopes[0] = domain.ScopeAdmin
+	again, _ := querier.GetAPIKeyByHash("hash-2")
+	assert.Equal(t, domain.ScopeSignaturesCreate, again.Scopes[0])
+
+	missing, err := querier.GetAPIKeyByHash("unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	keys, err := querier.GetAPIKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.APIKey{admin, restricted}, keys)
+
+	assert.NoError(t, querier.DeleteAPIKey(admin.ID))
+	assert.Equal(t, ErrAPIKeyNotFound, querier.DeleteAPIKey(admin.ID))
+	missing, _ = querier.GetAPIKeyByHash("hash-1")
+	assert.Nil(t, missing)
+}
@@ -0,0 +1,164 @@
+package persistence
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+)
+
+// QueryObserver records the duration and outcome of the database operations
+type QueryObserver interface {
+	ObserveQuery(operation string, err error, duration time.Duration)
+}
+
+// instrumentedQuerier reports every operation of the querier it wraps to an observer
+type instrumentedQuerier struct {
+	querier  Querier
+	observer QueryObserver
+}
+
+// NewInstrumentedQuerier wraps querier, reporting each operation, named after its Querier method, to the observer.
+// Operations made within WithTx are reported one by one, the unit of work itself is not.
+func NewInstrumentedQuerier(querier Querier, observer QueryObserver) Querier {
+	return &instrumentedQuerier{
+		querier:  querier,
+		observer: observer,
+	}
+}
+
+// observe reports the operation started at start, and ended with *err.
+// Records not found are an expected outcome, not a failure of the database.
+func (q *instrumentedQuerier) observe(operation string, start time.Time, err *error) {
+	outcome := *err
+	if errors.Is(outcome, ErrDeviceNotFound) || errors.Is(outcome, ErrAPIKeyNotFound) {
+		outcome = nil
+	}
+	q.observer.ObserveQuery(operation, outcome, time.Since(start))
+}
+
+func (q *instrumentedQuerier) Close() {
+	q.querier.Close()
+}
+
+func (q *instrumentedQuerier) WithTx(fn func(tx Querier) error) error {
+	return q.querier.WithTx(func(tx Querier) error {
+		return fn(&instrumentedQuerier{querier: tx, observer: q.observer})
+	})
+}
+
+func (q *instrumentedQuerier) SaveDevice(device domain.Device) (err error) {
+	defer q.observe("SaveDevice", time.Now(), &err)
+	return q.querier.SaveDevice(device)
+}
+
+func (q *instrumentedQuerier) GetDevices() (devices []domain.Device, err error) {
+	defer q.observe("GetDevices", time.Now(), &err)
+	return q.querier.GetDevices()
+}
+
+func (q *instrumentedQuerier) GetDevice(id uuid.UUID) (device *domain.Device, err error) {
+	defer q.observe("GetDevice", time.Now(), &err)
+	return q.querier.GetDevice(id)
+}
+
+func (q *instrumentedQuerier) UpdateDevice(device domain.Device) (err error) {
+	defer q.observe("UpdateDevice", time.Now(), &err)
+	return q.querier.UpdateDevice(device)
+}
+
+func (q *instrumentedQuerier) GetDeviceForUpdate(id uuid.UUID) (device *domain.Device, err error) {
+	defer q.observe("GetDeviceForUpdate", time.Now(), &err)
+	return q.querier.GetDeviceForUpdate(id)
+}
+
+func (q *instrumentedQuerier) UpdateDeviceSignCounter(device domain.Device) (err error) {
+	defer q.observe("UpdateDeviceSignCounter", time.Now(), &err)
+	return q.querier.UpdateDeviceSignCounter(device)
+}
+
+func (q *instrumentedQuerier) SaveSignedTransaction(transaction domain.SignedTransaction) (id uuid.UUID, err error) {
+	defer q.observe("SaveSignedTransaction", time.Now(), &err)
+	return q.querier.SaveSignedTransaction(transaction)
+}
+
+func (q *instrumentedQuerier) GetSignedTransaction(deviceId uuid.UUID, signCounter int) (transaction *domain.SignedTransaction, err error) {
+	defer q.observe("GetSignedTransaction", time.Now(), &err)
+	return q.querier.GetSignedTransaction(deviceId, signCounter)
+}
+
+func (q *instrumentedQuerier) GetSignedTransactionByID(id uuid.UUID) (transaction *domain.SignedTransaction, err error) {
+	defer q.observe("GetSignedTransactionByID", time.Now(), &err)
+	return q.querier.GetSignedTransactionByID(id)
+}
+
+func (q *instrumentedQuerier) GetSignedTransactions(deviceId uuid.UUID) (transactions []domain.SignedTransaction, err error) {
+	defer q.observe("GetSignedTransactions", time.Now(), &err)
+	return q.querier.GetSignedTransactions(deviceId)
+}
+
+func (q *instrumentedQuerier) ListDevices(filter DeviceFilter, page Page) (devices []domain.Device, err error) {
+	defer q.observe("ListDevices", time.Now(), &err)
+	return q.querier.ListDevices(filter, page)
+}
+
+func (q *instrumentedQuerier) ListSignedTransactions(deviceId uuid.UUID, filter SignedTransactionFilter, page Page) (transactions []domain.SignedTransaction, err error) {
+	defer q.observe("ListSignedTransactions", time.Now(), &err)
+	return q.querier.ListSignedTransactions(deviceId, filter, page)
+}
+
+func (q *instrumentedQuerier) SaveDeviceKey(key domain.DeviceKey) (err error) {
+	defer q.observe("SaveDeviceKey", time.Now(), &err)
+	return q.querier.SaveDeviceKey(key)
+}
+
+func (q *instrumentedQuerier) GetDeviceKeys(deviceId uuid.UUID) (keys []domain.DeviceKey, err error) {
+	defer q.observe("GetDeviceKeys", time.Now(), &err)
+	return q.querier.GetDeviceKeys(deviceId)
+}
+
+func (q *instrumentedQuerier) SaveDeviceStatusChange(change domain.DeviceStatusChange) (err error) {
+	defer q.observe("SaveDeviceStatusChange", time.Now(), &err)
+	return q.querier.SaveDeviceStatusChange(change)
+}
+
+func (q *instrumentedQuerier) GetDeviceStatusChanges(deviceId uuid.UUID) (changes []domain.DeviceStatusChange, err error) {
+	defer q.observe("GetDeviceStatusChanges", time.Now(), &err)
+	return q.querier.GetDeviceStatusChanges(deviceId)
+}
+
+func (q *instrumentedQuerier) SaveIdempotencyKey(key domain.IdempotencyKey, replaceUpTo time.Time) (err error) {
+	defer q.observe("SaveIdempotencyKey", time.Now(), &err)
+	return q.querier.SaveIdempotencyKey(key, replaceUpTo)
+}
+
+func (q *instrumentedQuerier) GetIdempotencyKey(deviceId uuid.UUID, key string) (idempotencyKey *domain.IdempotencyKey, err error) {
+	defer q.observe("GetIdempotencyKey", time.Now(), &err)
+	return q.querier.GetIdempotencyKey(deviceId, key)
+}
+
+func (q *instrumentedQuerier) DeleteIdempotencyKeys(createdBefore time.Time) (deleted int, err error) {
+	defer q.observe("DeleteIdempotencyKeys", time.Now(), &err)
+	return q.querier.DeleteIdempotencyKeys(createdBefore)
+}
+
+func (q *instrumentedQuerier) SaveAPIKey(key domain.APIKey) (err error) {
+	defer q.observe("SaveAPIKey", time.Now(), &err)
+	return q.querier.SaveAPIKey(key)
+}
+
+func (q *instrumentedQuerier) GetAPIKeyByHash(keyHash string) (apiKey *domain.APIKey, err error) {
+	defer q.observe("GetAPIKeyByHash", time.Now(), &err)
+	return q.querier.GetAPIKeyByHash(keyHash)
+}
+
+func (q *instrumentedQuerier) GetAPIKeys() (apiKeys []domain.APIKey, err error) {
+	defer q.observe("GetAPIKeys", time.Now(), &err)
+	return q.querier.GetAPIKeys()
+}
+
+func (q *instrumentedQuerier) DeleteAPIKey(id uuid.UUID) (err error) {
+	defer q.observe("DeleteAPIKey", time.Now(), &err)
+	return q.querier.DeleteAPIKey(id)
+}
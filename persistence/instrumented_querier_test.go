@@ -0,0 +1,81 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingObserver keeps the outcome of each operation observed, in order
+type recordingObserver struct {
+	operations []string
+	errs       []error
+}
+
+func (o *recordingObserver) ObserveQuery(operation string, err error, duration time.Duration) {
+	o.operations = append(o.operations, operation)
+	o.errs = append(o.errs, err)
+}
+
+// TestInstrumentedQuerier tests the operations are observed, within units of work too.
+func TestInstrumentedQuerier(t *testing.T) {
+	inMemory, err := NewInMemoryQuerier(context.TODO())
+	require.NoError(t, err)
+	observer := &recordingObserver{}
+	querier := NewInstrumentedQuerier(inMemory, observer)
+
+	device := domain.Device{ID: uuid.New(), TenantID: domain.DefaultTenant, SignAlgorithm: "ECDSA"}
+	require.NoError(t, querier.SaveDevice(device))
+
+	err = querier.WithTx(func(tx Querier) error {
+		stored, err := tx.GetDevice(device.ID)
+		if err != nil {
+			return err
+		}
+		stored.SignCounter++
+		return tx.UpdateDevice(*stored)
+	})
+	require.NoError(t, err)
+
+	stored, err := querier.GetDevice(device.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.SignCounter)
+
+	// Records not found are not failures, other errors are
+	assert.Equal(t, ErrAPIKeyNotFound, querier.DeleteAPIKey(uuid.New()))
+	transaction := domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, SignCounter: 1}
+	_, err = querier.SaveSignedTransaction(transaction)
+	require.NoError(t, err)
+	transaction.ID = uuid.New()
+	_, err = querier.SaveSignedTransaction(transaction)
+	require.ErrorIs(t, err, ErrSignCounterConflict)
+
+	assert.Equal(t, []string{"SaveDevice", "GetDevice", "UpdateDevice", "GetDevice", "DeleteAPIKey", "SaveSignedTransaction", "SaveSignedTransaction"}, observer.operations)
+	assert.Equal(t, []error{nil, nil, nil, nil, nil, nil, ErrSignCounterConflict}, observer.errs)
+}
+
+// TestInstrumentedQuerierRollback tests the unit of work is still rolled back through the wrapper.
+func TestInstrumentedQuerierRollback(t *testing.T) {
+	inMemory, err := NewInMemoryQuerier(context.TODO())
+	require.NoError(t, err)
+	querier := NewInstrumentedQuerier(inMemory, &recordingObserver{})
+
+	device := domain.Device{ID: uuid.New(), TenantID: domain.DefaultTenant, SignAlgorithm: "ECDSA"}
+	failure := errors.New("signing failed")
+	err = querier.WithTx(func(tx Querier) error {
+		if err := tx.SaveDevice(device); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.Equal(t, failure, err)
+
+	_, err = inMemory.GetDevice(device.ID)
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+}
@@ -0,0 +1,96 @@
+package persistence
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+)
+
+// Page asks for the records following the position After in listing order, at most Limit of them.
+// Devices are listed by creation order, and positioned by their CreationSeq.
+// Signed transactions are listed by sign counter, and positioned by it.
+// A zero Limit does not limit the listing.
+type Page struct {
+	After int64
+	Limit int
+}
+
+// DeviceFilter narrows down a device listing, empty fields do not filter.
+// IDs keeps only the listed devices, a nil list does not filter.
+type DeviceFilter struct {
+	TenantID      string
+	Label         string
+	SignAlgorithm string
+	IDs           []uuid.UUID
+}
+
+// SignedTransactionFilter narrows down a signed transaction listing to a range of sign counters, both ends included,
+// and to a range of creation times, From included and To excluded.
+// Zero ends do not filter.
+type SignedTransactionFilter struct {
+	FromSignCounter int
+	ToSignCounter   int
+	From            time.Time
+	To              time.Time
+}
+
+// matches checks if the device passes the filter.
+func (f DeviceFilter) matches(device domain.Device) bool {
+	return (f.TenantID == "" || device.TenantID == f.TenantID) &&
+		(f.Label == "" || device.Label == f.Label) &&
+		(f.SignAlgorithm == "" || device.SignAlgorithm == f.SignAlgorithm) &&
+		(f.IDs == nil || slices.Contains(f.IDs, device.ID))
+}
+
+// matches checks if the transaction passes the filter.
+func (f SignedTransactionFilter) matches(transaction domain.SignedTransaction) bool {
+	return transaction.SignCounter >= f.FromSignCounter &&
+		(f.ToSignCounter == 0 || transaction.SignCounter <= f.ToSignCounter) &&
+		!transaction.CreatedAt.Before(f.From) &&
+		(f.To.IsZero() || transaction.CreatedAt.Before(f.To))
+}
+
+// pageDevices filters the devices, orders them by creation and keeps the requested page.
+// Devices not stored yet have no CreationSeq, and come last.
+func pageDevices(devices []domain.Device, filter DeviceFilter, page Page) []domain.Device {
+	paged := make([]domain.Device, 0, len(devices))
+	for _, device := range devices {
+		if filter.matches(device) && (device.CreationSeq == 0 || device.CreationSeq > page.After) {
+			paged = append(paged, device)
+		}
+	}
+
+	sort.SliceStable(paged, func(i, j int) bool {
+		if paged[i].CreationSeq == 0 || paged[j].CreationSeq == 0 {
+			return paged[j].CreationSeq == 0 && paged[i].CreationSeq != 0
+		}
+		return paged[i].CreationSeq < paged[j].CreationSeq
+	})
+	return limitPage(paged, page)
+}
+
+// pageSignedTransactions filters the transactions, orders them by sign counter and keeps the requested page.
+func pageSignedTransactions(transactions []domain.SignedTransaction, filter SignedTransactionFilter, page Page) []domain.SignedTransaction {
+	paged := make([]domain.SignedTransaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		if filter.matches(transaction) && int64(transaction.SignCounter) > page.After {
+			paged = append(paged, transaction)
+		}
+	}
+
+	sort.SliceStable(paged, func(i, j int) bool {
+		return paged[i].SignCounter < paged[j].SignCounter
+	})
+	return limitPage(paged, page)
+}
+
+// limitPage keeps at most the page limit of records.
+func limitPage[T any](records []T, page Page) []T {
+	if page.Limit > 0 && len(records) > page.Limit {
+		return records[:page.Limit]
+	}
+	return records
+}
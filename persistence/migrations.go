@@ -0,0 +1,136 @@
+package persistence
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/allisson/go-pglock/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock identifier used to serialize schema migrations
+// when several instances of the service start against the same database.
+const migrationLockID = 7411
+
+// migration is a single versioned schema change.
+// The version is taken from the numeric prefix of the file name, e.g. 0001_create_devices.sql.
+type migration struct {
+	version int
+	name    string
+	script  string
+}
+
+// loadMigrations reads the embedded migration scripts, ordered by version.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		prefix, _, found := strings.Cut(entry.Name(), "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		script, err := fs.ReadFile(migrationFiles, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{
+			version: version,
+			name:    entry.Name(),
+			script:  string(script),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// migrate applies every pending migration, each one in its own transaction.
+// An advisory lock guarantees that only one instance migrates the schema at a time.
+func migrate(ctx context.Context, db *sqlx.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	lock, err := pglock.NewLock(ctx, migrationLockID, db.DB)
+	if err != nil {
+		return err
+	}
+	if err := lock.WaitAndLock(ctx); err != nil {
+		return err
+	}
+	defer lock.Unlock(ctx) //nolint:all
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT        NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return err
+	}
+
+	var applied []int
+	if err := db.SelectContext(ctx, &applied, "SELECT version FROM schema_migrations"); err != nil {
+		return err
+	}
+	appliedVersions := make(map[int]bool, len(applied))
+	for _, version := range applied {
+		appliedVersions[version] = true
+	}
+
+	for _, m := range migrations {
+		if appliedVersions[m.version] {
+			continue
+		}
+
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs a migration script and records it as applied, atomically.
+func applyMigration(ctx context.Context, db *sqlx.DB, m migration) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:all
+
+	if _, err := tx.ExecContext(ctx, m.script); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
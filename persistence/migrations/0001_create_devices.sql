@@ -0,0 +1,8 @@
+CREATE TABLE devices (
+    id             UUID PRIMARY KEY,
+    label          TEXT    NOT NULL DEFAULT '',
+    sign_counter   INTEGER NOT NULL DEFAULT 0,
+    sign_algorithm TEXT    NOT NULL,
+    public_key     TEXT    NOT NULL,
+    private_key    TEXT    NOT NULL
+);
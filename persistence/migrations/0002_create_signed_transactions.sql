@@ -0,0 +1,9 @@
+CREATE TABLE signed_transactions (
+    id                   UUID PRIMARY KEY,
+    device_id            UUID    NOT NULL REFERENCES devices (id),
+    raw_data             BYTEA   NOT NULL,
+    sign                 TEXT    NOT NULL,
+    previous_device_sign TEXT    NOT NULL,
+    sign_counter         INTEGER NOT NULL,
+    CONSTRAINT signed_transactions_device_counter_key UNIQUE (device_id, sign_counter)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE devices
+    ADD COLUMN rsa_bits INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN curve    TEXT    NOT NULL DEFAULT '';
+
+-- Devices created before the key parameters were configurable used fixed ones
+UPDATE devices SET rsa_bits = 512 WHERE sign_algorithm = 'RSA';
+UPDATE devices SET curve = 'P-384' WHERE sign_algorithm = 'ECDSA';
@@ -0,0 +1,4 @@
+-- Devices hold a handle to their private key, the key material is kept by a key store.
+-- Keys stored until now become handles of the local key store, which carry the key itself.
+ALTER TABLE devices RENAME COLUMN private_key TO key_handle;
+UPDATE devices SET key_handle = 'local:' || key_handle;
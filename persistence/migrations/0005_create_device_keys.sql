@@ -0,0 +1,11 @@
+-- Devices can rotate their key pair, the key they sign with is valid from a sign counter on
+ALTER TABLE devices ADD COLUMN key_valid_from INTEGER NOT NULL DEFAULT 1;
+
+-- Retired public keys are kept, so the transactions they signed can still be verified
+CREATE TABLE device_keys (
+    device_id  UUID    NOT NULL REFERENCES devices (id),
+    public_key TEXT    NOT NULL,
+    valid_from INTEGER NOT NULL,
+    valid_to   INTEGER NOT NULL,
+    PRIMARY KEY (device_id, valid_from)
+);
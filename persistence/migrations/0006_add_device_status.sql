@@ -0,0 +1,13 @@
+-- Devices have a lifecycle, only active devices sign
+ALTER TABLE devices ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+
+CREATE TABLE device_status_changes (
+    id          UUID PRIMARY KEY,
+    device_id   UUID        NOT NULL REFERENCES devices (id),
+    from_status TEXT        NOT NULL,
+    to_status   TEXT        NOT NULL,
+    reason      TEXT        NOT NULL DEFAULT '',
+    changed_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX device_status_changes_device_idx ON device_status_changes (device_id, changed_at);
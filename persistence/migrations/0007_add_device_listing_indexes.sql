@@ -0,0 +1,7 @@
+-- Devices are listed in creation order, positioned by a sequence assigned on insert
+ALTER TABLE devices ADD COLUMN creation_seq BIGSERIAL;
+CREATE UNIQUE INDEX devices_creation_seq_idx ON devices (creation_seq);
+
+-- Device listings filtered by label or algorithm are still served in creation order
+CREATE INDEX devices_label_idx ON devices (label, creation_seq);
+CREATE INDEX devices_sign_algorithm_idx ON devices (sign_algorithm, creation_seq);
@@ -0,0 +1,12 @@
+-- Transactions signed for a client supplied idempotency key, scoped per device
+CREATE TABLE idempotency_keys (
+    device_id       UUID        NOT NULL REFERENCES devices (id),
+    idempotency_key TEXT        NOT NULL,
+    request_hash    TEXT        NOT NULL,
+    transaction_id  UUID        NOT NULL REFERENCES signed_transactions (id),
+    created_at      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (device_id, idempotency_key)
+);
+
+-- Expired keys are purged by creation time
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
@@ -0,0 +1,8 @@
+-- Devices and signed transactions are timestamped by the server
+-- The rows stored before have no known creation time, and are given the time of the migration
+ALTER TABLE devices ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE devices ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE signed_transactions ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Signature listings are filtered by creation time
+CREATE INDEX signed_transactions_device_created_at_idx ON signed_transactions (device_id, created_at);
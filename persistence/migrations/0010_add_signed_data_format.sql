@@ -0,0 +1,4 @@
+-- The data signed for a transaction is versioned
+-- Existing devices and transactions keep the first format, so their chains still verify
+ALTER TABLE devices ADD COLUMN signed_data_format INT NOT NULL DEFAULT 1;
+ALTER TABLE signed_transactions ADD COLUMN format_version INT NOT NULL DEFAULT 1;
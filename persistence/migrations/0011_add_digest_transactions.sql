@@ -0,0 +1,3 @@
+-- Transactions may sign a digest computed by the client, named by its hash algorithm
+-- Transactions signing raw data have none
+ALTER TABLE signed_transactions ADD COLUMN hash_algorithm TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+-- API keys authenticating the callers, only their SHA-256 hash is stored
+-- An empty device ID list allows every device
+CREATE TABLE api_keys (
+    id         UUID        PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    key_hash   TEXT        NOT NULL UNIQUE,
+    scopes     TEXT[]      NOT NULL,
+    device_ids UUID[]      NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
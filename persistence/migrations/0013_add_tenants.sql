@@ -0,0 +1,6 @@
+-- Devices and API keys belong to a tenant, existing ones to the default tenant
+ALTER TABLE devices ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+-- Device listings are always scoped to a tenant, and served in creation order
+CREATE INDEX devices_tenant_idx ON devices (tenant_id, creation_seq);
@@ -2,67 +2,543 @@ package persistence
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/ildomm/ssccg/domain"
-
-	"github.com/allisson/go-pglock/v2"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultMaxOpenConns    = 25
+	DefaultMaxIdleConns    = 25
+	DefaultConnMaxLifetime = time.Minute * 5
+	DefaultConnMaxIdleTime = time.Minute * 1
+)
+
+// Postgres error codes raised when a unique or a foreign key constraint is violated.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+const (
+	deviceColumns            = "id, tenant_id, label, sign_counter, sign_algorithm, rsa_bits, curve, public_key, key_handle, key_valid_from, status, signed_data_format, creation_seq, created_at, updated_at"
+	signedTransactionColumns = "id, device_id, raw_data, sign, previous_device_sign, sign_counter, created_at, format_version, hash_algorithm"
+	deviceKeyColumns         = "device_id, public_key, valid_from, valid_to"
+	statusChangeColumns      = "id, device_id, from_status, to_status, reason, changed_at"
+	idempotencyKeyColumns    = "device_id, idempotency_key, request_hash, transaction_id, created_at"
+	apiKeyColumns            = "id, tenant_id, name, key_hash, scopes, device_ids, created_at"
 )
 
 type PostgresQuerier struct {
 	ctx    context.Context
 	dbURL  string
 	dbConn *sqlx.DB
-	lock   pglock.Lock //nolint:all
+	tx     *sqlx.Tx // set on the querier handed to WithTx callbacks
 }
 
+// NewPostgresQuerier opens a pooled connection to the database at url
+// and applies any pending schema migration.
 func NewPostgresQuerier(ctx context.Context, url string) (*PostgresQuerier, error) {
+	dbConn, err := sqlx.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	dbConn.SetMaxOpenConns(DefaultMaxOpenConns)
+	dbConn.SetMaxIdleConns(DefaultMaxIdleConns)
+	dbConn.SetConnMaxLifetime(DefaultConnMaxLifetime)
+	dbConn.SetConnMaxIdleTime(DefaultConnMaxIdleTime)
+
+	if err := dbConn.PingContext(ctx); err != nil {
+		dbConn.Close() //nolint:all
+		return nil, err
+	}
 
-	// TODO: implement postgres initialization ...
-	// TODO: implement postgres connection ...
-	// TODO: implement postgres migration ...
+	if err := migrate(ctx, dbConn); err != nil {
+		dbConn.Close() //nolint:all
+		return nil, err
+	}
 
 	return &PostgresQuerier{
 		ctx:    ctx,
 		dbURL:  url,
-		dbConn: nil,
+		dbConn: dbConn,
 	}, nil
 }
 
 ////////////////////////////////// Database Querier operations /////////////////////////////////////////////////////////
 
 func (q *PostgresQuerier) Close() {
-	panic("implement me")
+	// The connection pool belongs to the querier that opened it, not to its transactions
+	if q.tx != nil {
+		return
+	}
+	q.dbConn.Close() //nolint:all
 }
 
-func (q *PostgresQuerier) SaveDevice(device domain.Device) error {
-	//q.lock.Lock()
-	//defer q.lock.Unlock()
+// WithTx runs fn within a database transaction, committed when fn succeeds and rolled back otherwise.
+// Calls made while a transaction is already open join it.
+func (q *PostgresQuerier) WithTx(fn func(tx Querier) error) error {
+	return q.withTx(func(tx *PostgresQuerier) error {
+		return fn(tx)
+	})
+}
+
+func (q *PostgresQuerier) withTx(fn func(tx *PostgresQuerier) error) error {
+	if q.tx != nil {
+		return fn(q)
+	}
 
-	panic("implement me")
+	sqlTx, err := q.dbConn.BeginTxx(q.ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction is a no-op
+	defer sqlTx.Rollback() //nolint:all
+
+	err = fn(&PostgresQuerier{
+		ctx:    q.ctx,
+		dbURL:  q.dbURL,
+		dbConn: q.dbConn,
+		tx:     sqlTx,
+	})
+	if err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// db returns the executor for the queries, the open transaction if there is one.
+func (q *PostgresQuerier) db() sqlx.ExtContext {
+	if q.tx != nil {
+		return q.tx
+	}
+	return q.dbConn
+}
+
+func (q *PostgresQuerier) SaveDevice(device domain.Device) error {
+	_, err := sqlx.NamedExecContext(q.ctx, q.db(), `
+		INSERT INTO devices (id, tenant_id, label, sign_counter, sign_algorithm, rsa_bits, curve, public_key, key_handle, key_valid_from, status, signed_data_format, created_at, updated_at)
+		VALUES (:id, :tenant_id, :label, :sign_counter, :sign_algorithm, :rsa_bits, :curve, :public_key, :key_handle, :key_valid_from, :status, :signed_data_format, :created_at, :updated_at)`, device)
+	if isUniqueViolation(err) {
+		return ErrDeviceExists
+	}
+	return err
 }
 
 func (q *PostgresQuerier) GetDevices() ([]domain.Device, error) {
-	panic("implement me")
+	var devices []domain.Device
+	err := sqlx.SelectContext(q.ctx, q.db(), &devices, "SELECT "+deviceColumns+" FROM devices")
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
 }
 
 func (q *PostgresQuerier) GetDevice(id uuid.UUID) (*domain.Device, error) {
-	panic("implement me")
+	var device domain.Device
+	err := sqlx.GetContext(q.ctx, q.db(), &device, "SELECT "+deviceColumns+" FROM devices WHERE id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
 }
 
 func (q *PostgresQuerier) UpdateDevice(device domain.Device) error {
-	panic("implement me")
+	result, err := sqlx.NamedExecContext(q.ctx, q.db(), `
+		UPDATE devices
+		SET label = :label, sign_counter = :sign_counter, sign_algorithm = :sign_algorithm,
+		    rsa_bits = :rsa_bits, curve = :curve, public_key = :public_key, key_handle = :key_handle,
+		    key_valid_from = :key_valid_from, status = :status, updated_at = :updated_at
+		WHERE id = :id`, device)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// GetDeviceForUpdate reads a device with SELECT ... FOR UPDATE, its row staying locked until the transaction ends.
+func (q *PostgresQuerier) GetDeviceForUpdate(id uuid.UUID) (*domain.Device, error) {
+	var device domain.Device
+	err := sqlx.GetContext(q.ctx, q.db(), &device, "SELECT "+deviceColumns+" FROM devices WHERE id = $1 FOR UPDATE", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
 }
 
+// UpdateDeviceSignCounter writes only the sign counter and update time, so signing never writes back key or status columns.
+func (q *PostgresQuerier) UpdateDeviceSignCounter(device domain.Device) error {
+	result, err := sqlx.NamedExecContext(q.ctx, q.db(), `
+		UPDATE devices
+		SET sign_counter = :sign_counter, updated_at = :updated_at
+		WHERE id = :id`, device)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// SaveSignedTransaction stores a signed transaction while holding a row lock on its device.
+// The lock serializes concurrent signers of the same device, even across service instances,
+// and the transaction is refused unless it carries the counter right after the device's one.
 func (q *PostgresQuerier) SaveSignedTransaction(transaction domain.SignedTransaction) (uuid.UUID, error) {
-	panic("implement me")
+	err := q.withTx(func(tx *PostgresQuerier) error {
+		var signCounter int
+		err := sqlx.GetContext(tx.ctx, tx.db(), &signCounter,
+			"SELECT sign_counter FROM devices WHERE id = $1 FOR UPDATE", transaction.DeviceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDeviceNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if transaction.SignCounter != signCounter+1 {
+			return ErrSignCounterConflict
+		}
+
+		_, err = sqlx.NamedExecContext(tx.ctx, tx.db(), `
+			INSERT INTO signed_transactions (id, device_id, raw_data, sign, previous_device_sign, sign_counter, created_at, format_version, hash_algorithm)
+			VALUES (:id, :device_id, :raw_data, :sign, :previous_device_sign, :sign_counter, :created_at, :format_version, :hash_algorithm)`, transaction)
+		if isUniqueViolation(err) {
+			return ErrSignCounterConflict
+		}
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return transaction.ID, nil
+}
+
+func (q *PostgresQuerier) GetSignedTransaction(deviceId uuid.UUID, signCounter int) (*domain.SignedTransaction, error) {
+	var transaction domain.SignedTransaction
+	err := sqlx.GetContext(q.ctx, q.db(), &transaction,
+		"SELECT "+signedTransactionColumns+" FROM signed_transactions WHERE device_id = $1 AND sign_counter = $2", deviceId, signCounter)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
 }
 
-func (q *PostgresQuerier) GetSignedTransaction(deviceId uuid.UUID, signCounter int) (domain.SignedTransaction, error) {
-	panic("implement me")
+// GetSignedTransactionByID looks a transaction up by its primary key.
+func (q *PostgresQuerier) GetSignedTransactionByID(id uuid.UUID) (*domain.SignedTransaction, error) {
+	var transaction domain.SignedTransaction
+	err := sqlx.GetContext(q.ctx, q.db(), &transaction,
+		"SELECT "+signedTransactionColumns+" FROM signed_transactions WHERE id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
 }
 
 func (q *PostgresQuerier) GetSignedTransactions(deviceId uuid.UUID) ([]domain.SignedTransaction, error) {
-	panic("implement me")
+	var transactions []domain.SignedTransaction
+	err := sqlx.SelectContext(q.ctx, q.db(), &transactions,
+		"SELECT "+signedTransactionColumns+" FROM signed_transactions WHERE device_id = $1 ORDER BY sign_counter", deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// ListDevices pages through the devices by creation_seq, using the filter indexes when filtering.
+func (q *PostgresQuerier) ListDevices(filter DeviceFilter, page Page) ([]domain.Device, error) {
+	var devices []domain.Device
+	err := sqlx.SelectContext(q.ctx, q.db(), &devices, `
+		SELECT `+deviceColumns+` FROM devices
+		WHERE creation_seq > $1
+		  AND ($2 = '' OR label = $2)
+		  AND ($3 = '' OR sign_algorithm = $3)
+		  AND ($5::uuid[] IS NULL OR id = ANY($5::uuid[]))
+		  AND ($6 = '' OR tenant_id = $6)
+		ORDER BY creation_seq
+		LIMIT NULLIF($4, 0)`,
+		page.After, filter.Label, filter.SignAlgorithm, page.Limit, uuidArray(filter.IDs), filter.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// ListSignedTransactions pages through the transactions of a device by sign counter, using the device counter index.
+func (q *PostgresQuerier) ListSignedTransactions(deviceId uuid.UUID, filter SignedTransactionFilter, page Page) ([]domain.SignedTransaction, error) {
+	var transactions []domain.SignedTransaction
+	err := sqlx.SelectContext(q.ctx, q.db(), &transactions, `
+		SELECT `+signedTransactionColumns+` FROM signed_transactions
+		WHERE device_id = $1
+		  AND sign_counter > $2
+		  AND sign_counter >= $3
+		  AND ($4 = 0 OR sign_counter <= $4)
+		  AND ($5::timestamptz IS NULL OR created_at >= $5)
+		  AND ($6::timestamptz IS NULL OR created_at < $6)
+		ORDER BY sign_counter
+		LIMIT NULLIF($7, 0)`,
+		deviceId, page.After, filter.FromSignCounter, filter.ToSignCounter, nullTime(filter.From), nullTime(filter.To), page.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func (q *PostgresQuerier) SaveDeviceKey(key domain.DeviceKey) error {
+	_, err := sqlx.NamedExecContext(q.ctx, q.db(), `
+		INSERT INTO device_keys (device_id, public_key, valid_from, valid_to)
+		VALUES (:device_id, :public_key, :valid_from, :valid_to)`, key)
+	if isForeignKeyViolation(err) {
+		return ErrDeviceNotFound
+	}
+	return err
+}
+
+func (q *PostgresQuerier) GetDeviceKeys(deviceId uuid.UUID) ([]domain.DeviceKey, error) {
+	var keys []domain.DeviceKey
+	err := sqlx.SelectContext(q.ctx, q.db(), &keys,
+		"SELECT "+deviceKeyColumns+" FROM device_keys WHERE device_id = $1 ORDER BY valid_from", deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (q *PostgresQuerier) SaveDeviceStatusChange(change domain.DeviceStatusChange) error {
+	_, err := sqlx.NamedExecContext(q.ctx, q.db(), `
+		INSERT INTO device_status_changes (id, device_id, from_status, to_status, reason, changed_at)
+		VALUES (:id, :device_id, :from_status, :to_status, :reason, :changed_at)`, change)
+	if isForeignKeyViolation(err) {
+		return ErrDeviceNotFound
+	}
+	return err
+}
+
+func (q *PostgresQuerier) GetDeviceStatusChanges(deviceId uuid.UUID) ([]domain.DeviceStatusChange, error) {
+	var changes []domain.DeviceStatusChange
+	err := sqlx.SelectContext(q.ctx, q.db(), &changes,
+		"SELECT "+statusChangeColumns+" FROM device_status_changes WHERE device_id = $1 ORDER BY changed_at, id", deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// SaveIdempotencyKey inserts the key, or replaces the stored one when it expired.
+// A stored key more recent than replaceUpTo is left untouched, no row being written.
+func (q *PostgresQuerier) SaveIdempotencyKey(key domain.IdempotencyKey, replaceUpTo time.Time) error {
+	result, err := sqlx.NamedExecContext(q.ctx, q.db(), `
+		INSERT INTO idempotency_keys (device_id, idempotency_key, request_hash, transaction_id, created_at)
+		VALUES (:device_id, :idempotency_key, :request_hash, :transaction_id, :created_at)
+		ON CONFLICT (device_id, idempotency_key) DO UPDATE
+		SET request_hash = excluded.request_hash, transaction_id = excluded.transaction_id, created_at = excluded.created_at
+		WHERE idempotency_keys.created_at <= :replace_up_to`, struct {
+		domain.IdempotencyKey
+		ReplaceUpTo time.Time `db:"replace_up_to"`
+	}{key, replaceUpTo})
+	if isForeignKeyViolation(err) {
+		return ErrDeviceNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrIdempotencyKeyConflict
+	}
+	return nil
+}
+
+func (q *PostgresQuerier) GetIdempotencyKey(deviceId uuid.UUID, key string) (*domain.IdempotencyKey, error) {
+	var stored domain.IdempotencyKey
+	err := sqlx.GetContext(q.ctx, q.db(), &stored,
+		"SELECT "+idempotencyKeyColumns+" FROM idempotency_keys WHERE device_id = $1 AND idempotency_key = $2", deviceId, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func (q *PostgresQuerier) DeleteIdempotencyKeys(createdBefore time.Time) (int, error) {
+	result, err := q.db().ExecContext(q.ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", createdBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(deleted), nil
+}
+
+// apiKeyRow is the stored form of an API key, with its scopes and device IDs in arrays.
+type apiKeyRow struct {
+	ID        uuid.UUID      `db:"id"`
+	TenantID  string         `db:"tenant_id"`
+	Name      string         `db:"name"`
+	KeyHash   string         `db:"key_hash"`
+	Scopes    pq.StringArray `db:"scopes"`
+	DeviceIDs pq.StringArray `db:"device_ids"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func newAPIKeyRow(key domain.APIKey) apiKeyRow {
+	deviceIds := uuidArray(key.DeviceIDs)
+	if deviceIds == nil {
+		deviceIds = pq.StringArray{}
+	}
+	return apiKeyRow{
+		ID:        key.ID,
+		TenantID:  key.TenantID,
+		Name:      key.Name,
+		KeyHash:   key.KeyHash,
+		Scopes:    pq.StringArray(key.Scopes),
+		DeviceIDs: deviceIds,
+		CreatedAt: key.CreatedAt,
+	}
+}
+
+func (r apiKeyRow) apiKey() (domain.APIKey, error) {
+	key := domain.APIKey{
+		ID:        r.ID,
+		TenantID:  r.TenantID,
+		Name:      r.Name,
+		KeyHash:   r.KeyHash,
+		Scopes:    []string(r.Scopes),
+		CreatedAt: r.CreatedAt,
+	}
+	for _, id := range r.DeviceIDs {
+		deviceId, err := uuid.Parse(id)
+		if err != nil {
+			return domain.APIKey{}, err
+		}
+		key.DeviceIDs = append(key.DeviceIDs, deviceId)
+	}
+	return key, nil
+}
+
+func (q *PostgresQuerier) SaveAPIKey(key domain.APIKey) error {
+	_, err := sqlx.NamedExecContext(q.ctx, q.db(), `
+		INSERT INTO api_keys (id, tenant_id, name, key_hash, scopes, device_ids, created_at)
+		VALUES (:id, :tenant_id, :name, :key_hash, :scopes, :device_ids, :created_at)`, newAPIKeyRow(key))
+	return err
+}
+
+func (q *PostgresQuerier) GetAPIKeyByHash(keyHash string) (*domain.APIKey, error) {
+	var row apiKeyRow
+	err := sqlx.GetContext(q.ctx, q.db(), &row,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", keyHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := row.apiKey()
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (q *PostgresQuerier) GetAPIKeys() ([]domain.APIKey, error) {
+	var rows []apiKeyRow
+	err := sqlx.SelectContext(q.ctx, q.db(), &rows,
+		"SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]domain.APIKey, len(rows))
+	for i, row := range rows {
+		if keys[i], err = row.apiKey(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (q *PostgresQuerier) DeleteAPIKey(id uuid.UUID) error {
+	result, err := q.db().ExecContext(q.ctx, "DELETE FROM api_keys WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// uuidArray turns IDs into a Postgres array, keeping nil as NULL.
+func uuidArray(ids []uuid.UUID) pq.StringArray {
+	if ids == nil {
+		return nil
+	}
+	array := make(pq.StringArray, len(ids))
+	for i, id := range ids {
+		array[i] = id.String()
+	}
+	return array
+}
+
+// nullTime maps the zero time to NULL, for the optional time bounds of a query.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// isUniqueViolation reports whether err was raised by a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// isForeignKeyViolation reports whether err was raised by a foreign key constraint.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation
 }
@@ -2,56 +2,583 @@ package persistence
 
 import (
 	"context"
+	"errors"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/ildomm/ssccg/domain"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestNewPostgresQuerier(t *testing.T) {
+// testDatabaseURLEnvVar points the integration tests to a disposable Postgres database,
+// e.g. the container started by `make integration-test`.
+const testDatabaseURLEnvVar = "TEST_DATABASE_URL"
+
+// newTestPostgresQuerier connects to the test database and empties it,
+// skipping the test when no database is available.
+func newTestPostgresQuerier(t *testing.T) *PostgresQuerier {
+	url, found := os.LookupEnv(testDatabaseURLEnvVar)
+	if !found {
+		t.Skipf("%s not set, skipping Postgres integration test", testDatabaseURLEnvVar)
+	}
+
+	querier, err := NewPostgresQuerier(context.TODO(), url)
+	require.NoError(t, err)
+
+	_, err = querier.dbConn.Exec("TRUNCATE api_keys, idempotency_keys, device_status_changes, device_keys, signed_transactions, devices")
+	require.NoError(t, err)
+
+	t.Cleanup(querier.Close)
+	return querier
+}
+
+func newTestDevice() domain.Device {
+	return domain.Device{
+		ID:               uuid.New(),
+		TenantID:         domain.DefaultTenant,
+		Label:            "Test Device",
+		SignCounter:      0,
+		SignAlgorithm:    "RSA",
+		RSABits:          2048,
+		PublicKey:        "public key",
+		KeyHandle:        "local:private key",
+		KeyValidFrom:     1,
+		Status:           domain.DeviceStatusActive,
+		SignedDataFormat: domain.SignedDataFormatV2,
+		CreatedAt:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		UpdatedAt:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestNewPostgresQuerierInvalidURL(t *testing.T) {
 	ctx := context.TODO()
-	querier, err := NewPostgresQuerier(ctx, "test")
+	querier, err := NewPostgresQuerier(ctx, "postgres://invalid:5432/none?connect_timeout=1")
+	assert.Error(t, err)
+	assert.Nil(t, querier)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, "migrations must be numbered sequentially")
+		assert.NotEmpty(t, m.script)
+	}
+}
+
+func TestPostgresMigrationsAreIdempotent(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+
+	again, err := NewPostgresQuerier(context.TODO(), querier.dbURL)
+	require.NoError(t, err)
+	again.Close()
+}
+
+func TestPostgresSaveAndGetDevice(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+
+	err := querier.SaveDevice(device)
 	assert.NoError(t, err)
-	assert.NotNil(t, querier)
+
+	retrievedDevice, err := querier.GetDevice(device.ID)
+	assert.NoError(t, err)
+	require.NotNil(t, retrievedDevice)
+	assert.NotZero(t, retrievedDevice.CreationSeq)
+	device.CreationSeq = retrievedDevice.CreationSeq
+	// Times are read back in the session time zone
+	assert.True(t, device.CreatedAt.Equal(retrievedDevice.CreatedAt))
+	assert.True(t, device.UpdatedAt.Equal(retrievedDevice.UpdatedAt))
+	device.CreatedAt, device.UpdatedAt = retrievedDevice.CreatedAt, retrievedDevice.UpdatedAt
+	assert.Equal(t, &device, retrievedDevice)
+
+	devices, err := querier.GetDevices()
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Device{device}, devices)
 }
 
-func TestPostgresSaveDevice(t *testing.T) {
-	ctx := context.TODO()
-	querier, _ := NewPostgresQuerier(ctx, "test")
-	device := domain.Device{ /* Initialize fields */ }
+func TestPostgresSaveDeviceExists(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
 
-	assert.Panics(t, func() { querier.SaveDevice(device) }) //nolint:all
+	other := device
+	other.TenantID = "retail"
+	assert.Equal(t, ErrDeviceExists, querier.SaveDevice(other))
 }
 
-func TestIPostgresGetDeviceById(t *testing.T) {
-	ctx := context.TODO()
-	querier, _ := NewPostgresQuerier(ctx, "test")
-	id := uuid.New()
+func TestPostgresGetDeviceNotFound(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
 
-	assert.Panics(t, func() { querier.GetDevice(id) }) //nolint:all
+	device, err := querier.GetDevice(uuid.New())
+	assert.Equal(t, ErrDeviceNotFound, err)
+	assert.Nil(t, device)
 }
 
 func TestPostgresUpdateDevice(t *testing.T) {
-	ctx := context.TODO()
-	querier, _ := NewPostgresQuerier(ctx, "test")
-	device := domain.Device{ /* Initialize fields */ }
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+
+	_ = querier.SaveDevice(device)
+	device.SignCounter++
+	err := querier.UpdateDevice(device)
+	assert.NoError(t, err)
 
-	assert.Panics(t, func() { querier.UpdateDevice(device) }) //nolint:all
+	updatedDevice, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, 1, updatedDevice.SignCounter)
 }
 
-func TestPostgresSaveSignature(t *testing.T) {
-	ctx := context.TODO()
-	querier, _ := NewPostgresQuerier(ctx, "test")
-	signature := domain.SignedTransaction{ /* Initialize fields */ }
+func TestPostgresUpdateDeviceNotFound(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
 
-	assert.Panics(t, func() { querier.SaveSignedTransaction(signature) }) //nolint:all
+	err := querier.UpdateDevice(newTestDevice())
+	assert.Equal(t, ErrDeviceNotFound, err)
 }
 
-func TestPostgresGetSignaturesByDeviceId(t *testing.T) {
-	ctx := context.TODO()
-	querier, _ := NewPostgresQuerier(ctx, "test")
-	id := uuid.New()
+func TestPostgresUpdateDeviceSignCounter(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	device.SignCounter++
+	device.Status = domain.DeviceStatusSuspended
+	device.KeyHandle = "local:other key"
+	require.NoError(t, querier.UpdateDeviceSignCounter(device))
+
+	// Only the sign counter was written
+	stored, err := querier.GetDevice(device.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.SignCounter)
+	assert.Equal(t, domain.DeviceStatusActive, stored.Status)
+	assert.Equal(t, "local:private key", stored.KeyHandle)
+
+	assert.Equal(t, ErrDeviceNotFound, querier.UpdateDeviceSignCounter(newTestDevice()))
+}
+
+func TestPostgresGetDeviceForUpdateLocksTheRow(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- querier.WithTx(func(tx Querier) error {
+			if _, err := tx.GetDeviceForUpdate(device.ID); err != nil {
+				return err
+			}
+			close(locked)
+			<-release
+			return nil
+		})
+	}()
+	<-locked
+
+	// A concurrent writer waits for the lock to be released
+	updated := make(chan error)
+	go func() {
+		suspended := device
+		suspended.Status = domain.DeviceStatusSuspended
+		updated <- querier.UpdateDevice(suspended)
+	}()
+	select {
+	case err := <-updated:
+		t.Fatalf("update was not blocked by the row lock: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, <-updated)
+
+	_, err := querier.GetDeviceForUpdate(uuid.New())
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func TestPostgresSaveSignedTransactionWithDevice(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	transaction := domain.SignedTransaction{
+		ID:                 uuid.New(),
+		DeviceID:           device.ID,
+		RawData:            []byte{0x00, 0x01, 0x02},
+		Sign:               "sign",
+		PreviousDeviceSign: "previous",
+		SignCounter:        1,
+		CreatedAt:          time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		FormatVersion:      domain.SignedDataFormatV2,
+		HashAlgorithm:      "SHA256",
+	}
+
+	id, err := querier.SaveSignedTransaction(transaction)
+	assert.NoError(t, err)
+	assert.Equal(t, transaction.ID, id)
+
+	retrieved, err := querier.GetSignedTransaction(device.ID, 1)
+	assert.NoError(t, err)
+	require.NotNil(t, retrieved)
+	assert.True(t, transaction.CreatedAt.Equal(retrieved.CreatedAt))
+	// The signed data reads the same once stored
+	assert.Equal(t, transaction.SignedData(), retrieved.SignedData())
+	transaction.CreatedAt = retrieved.CreatedAt
+	assert.Equal(t, &transaction, retrieved)
+
+	missing, err := querier.GetSignedTransaction(device.ID, 2)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	retrieved, err = querier.GetSignedTransactionByID(transaction.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &transaction, retrieved)
+
+	missing, err = querier.GetSignedTransactionByID(uuid.New())
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	transactions, err := querier.GetSignedTransactions(device.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.SignedTransaction{transaction}, transactions)
+}
+
+func TestPostgresSaveSignedTransactionWithoutDevice(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+
+	transaction := domain.SignedTransaction{
+		ID:          uuid.New(),
+		DeviceID:    uuid.New(),
+		RawData:     []byte{0x01},
+		SignCounter: 1,
+	}
+
+	_, err := querier.SaveSignedTransaction(transaction)
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func TestPostgresSaveSignedTransactionCounterConflict(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	// The device counter is 0, so only counter 1 can be stored
+	_, err := querier.SaveSignedTransaction(domain.SignedTransaction{
+		ID: uuid.New(), DeviceID: device.ID, RawData: []byte{0x01}, SignCounter: 2,
+	})
+	assert.Equal(t, ErrSignCounterConflict, err)
+
+	_, err = querier.SaveSignedTransaction(domain.SignedTransaction{
+		ID: uuid.New(), DeviceID: device.ID, RawData: []byte{0x01}, SignCounter: 1,
+	})
+	assert.NoError(t, err)
+
+	// Counter 1 is taken, even though the device counter was not updated yet
+	_, err = querier.SaveSignedTransaction(domain.SignedTransaction{
+		ID: uuid.New(), DeviceID: device.ID, RawData: []byte{0x01}, SignCounter: 1,
+	})
+	assert.Equal(t, ErrSignCounterConflict, err)
+}
+
+func TestPostgresConcurrentSignersNeverReuseCounter(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	const signers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, signers)
+	for i := 0; i < signers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := querier.SaveSignedTransaction(domain.SignedTransaction{
+				ID: uuid.New(), DeviceID: device.ID, RawData: []byte{0x01}, SignCounter: 1,
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.Equal(t, ErrSignCounterConflict, err)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+}
+
+func TestPostgresWithTxCommit(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	transaction := domain.SignedTransaction{
+		ID: uuid.New(), DeviceID: device.ID, RawData: []byte{0x01}, SignCounter: 1,
+	}
+	err := querier.WithTx(func(tx Querier) error {
+		if _, err := tx.SaveSignedTransaction(transaction); err != nil {
+			return err
+		}
+		device.SignCounter++
+		return tx.UpdateDevice(device)
+	})
+	assert.NoError(t, err)
+
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, 1, stored.SignCounter)
+	transactions, _ := querier.GetSignedTransactions(device.ID)
+	assert.Len(t, transactions, 1)
+}
+
+func TestPostgresWithTxRollback(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	failure := errors.New("failure")
+	err := querier.WithTx(func(tx Querier) error {
+		if _, err := tx.SaveSignedTransaction(domain.SignedTransaction{
+			ID: uuid.New(), DeviceID: device.ID, RawData: []byte{0x01}, SignCounter: 1,
+		}); err != nil {
+			return err
+		}
+		device.SignCounter++
+		if err := tx.UpdateDevice(device); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.Equal(t, failure, err)
+
+	stored, _ := querier.GetDevice(device.ID)
+	assert.Equal(t, 0, stored.SignCounter)
+	transactions, _ := querier.GetSignedTransactions(device.ID)
+	assert.Empty(t, transactions)
+}
+
+func TestPostgresSaveAndGetDeviceKeys(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	second := domain.DeviceKey{DeviceID: device.ID, PublicKey: "second key", ValidFrom: 4, ValidTo: 6}
+	first := domain.DeviceKey{DeviceID: device.ID, PublicKey: "first key", ValidFrom: 1, ValidTo: 3}
+	assert.NoError(t, querier.SaveDeviceKey(second))
+	assert.NoError(t, querier.SaveDeviceKey(first))
+
+	keys, err := querier.GetDeviceKeys(device.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.DeviceKey{first, second}, keys)
+
+	err = querier.SaveDeviceKey(domain.DeviceKey{DeviceID: uuid.New(), PublicKey: "key", ValidFrom: 1, ValidTo: 1})
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func TestPostgresSaveAndGetDeviceStatusChanges(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+
+	change := domain.DeviceStatusChange{
+		ID:         uuid.New(),
+		DeviceID:   device.ID,
+		FromStatus: domain.DeviceStatusActive,
+		ToStatus:   domain.DeviceStatusSuspended,
+		Reason:     "device lost",
+		ChangedAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	assert.NoError(t, querier.SaveDeviceStatusChange(change))
+
+	changes, err := querier.GetDeviceStatusChanges(device.ID)
+	assert.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, change.Reason, changes[0].Reason)
+	assert.True(t, change.ChangedAt.Equal(changes[0].ChangedAt))
+
+	change.ID, change.DeviceID = uuid.New(), uuid.New()
+	assert.Equal(t, ErrDeviceNotFound, querier.SaveDeviceStatusChange(change))
+}
+
+func TestPostgresListDevices(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+
+	var ids []uuid.UUID
+	for _, algorithm := range []string{"RSA", "ECDSA", "RSA"} {
+		device := newTestDevice()
+		device.SignAlgorithm = algorithm
+		require.NoError(t, querier.SaveDevice(device))
+		ids = append(ids, device.ID)
+	}
+
+	first, err := querier.ListDevices(DeviceFilter{}, Page{Limit: 2})
+	assert.NoError(t, err)
+	require.Len(t, first, 2)
+	assert.Equal(t, ids[0], first[0].ID)
+	assert.Equal(t, ids[1], first[1].ID)
+
+	second, err := querier.ListDevices(DeviceFilter{}, Page{After: first[1].CreationSeq, Limit: 2})
+	assert.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Equal(t, ids[2], second[0].ID)
+
+	filtered, err := querier.ListDevices(DeviceFilter{SignAlgorithm: "RSA", Label: "Test Device"}, Page{})
+	assert.NoError(t, err)
+	require.Len(t, filtered, 2)
+	assert.Equal(t, ids[2], filtered[1].ID)
+
+	allowed, err := querier.ListDevices(DeviceFilter{IDs: []uuid.UUID{ids[2], ids[1]}}, Page{})
+	assert.NoError(t, err)
+	require.Len(t, allowed, 2)
+	assert.Equal(t, ids[1], allowed[0].ID)
+	assert.Equal(t, ids[2], allowed[1].ID)
+
+	other := newTestDevice()
+	other.TenantID = "retail"
+	require.NoError(t, querier.SaveDevice(other))
+	tenantDevices, err := querier.ListDevices(DeviceFilter{TenantID: "retail"}, Page{})
+	assert.NoError(t, err)
+	require.Len(t, tenantDevices, 1)
+	assert.Equal(t, other.ID, tenantDevices[0].ID)
+	assert.Equal(t, "retail", tenantDevices[0].TenantID)
+	defaultDevices, err := querier.ListDevices(DeviceFilter{TenantID: domain.DefaultTenant}, Page{})
+	assert.NoError(t, err)
+	assert.Len(t, defaultDevices, 3)
+}
+
+func TestPostgresListSignedTransactions(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+	for counter := 1; counter <= 10; counter++ {
+		require.NoError(t, querier.WithTx(func(tx Querier) error {
+			transaction := domain.SignedTransaction{
+				ID:          uuid.New(),
+				DeviceID:    device.ID,
+				RawData:     []byte("data"),
+				SignCounter: counter,
+				CreatedAt:   time.Date(2024, 1, 2, 3, counter, 0, 0, time.UTC),
+			}
+			if _, err := tx.SaveSignedTransaction(transaction); err != nil {
+				return err
+			}
+			device.SignCounter = counter
+			return tx.UpdateDevice(device)
+		}))
+	}
+
+	transactions, err := querier.ListSignedTransactions(device.ID, SignedTransactionFilter{}, Page{After: 3, Limit: 3})
+	assert.NoError(t, err)
+	require.Len(t, transactions, 3)
+	assert.Equal(t, 4, transactions[0].SignCounter)
+	assert.Equal(t, 6, transactions[2].SignCounter)
+
+	transactions, err = querier.ListSignedTransactions(device.ID, SignedTransactionFilter{FromSignCounter: 5, ToSignCounter: 8}, Page{After: 6})
+	assert.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, 7, transactions[0].SignCounter)
+	assert.Equal(t, 8, transactions[1].SignCounter)
+
+	filter := SignedTransactionFilter{From: time.Date(2024, 1, 2, 3, 3, 0, 0, time.UTC), To: time.Date(2024, 1, 2, 3, 5, 0, 0, time.UTC)}
+	transactions, err = querier.ListSignedTransactions(device.ID, filter, Page{})
+	assert.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, 3, transactions[0].SignCounter)
+	assert.True(t, filter.From.Equal(transactions[0].CreatedAt))
+	assert.Equal(t, 4, transactions[1].SignCounter)
+}
+
+func TestPostgresSaveAndGetIdempotencyKey(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+	device := newTestDevice()
+	require.NoError(t, querier.SaveDevice(device))
+	transaction := domain.SignedTransaction{ID: uuid.New(), DeviceID: device.ID, RawData: []byte("data"), SignCounter: 1}
+	_, err := querier.SaveSignedTransaction(transaction)
+	require.NoError(t, err)
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	key := domain.IdempotencyKey{
+		DeviceID:      device.ID,
+		Key:           "retry-1",
+		RequestHash:   "hash",
+		TransactionID: transaction.ID,
+		CreatedAt:     createdAt,
+	}
+	assert.NoError(t, querier.SaveIdempotencyKey(key, createdAt.Add(-time.Hour)))
+
+	// Saving the key again replaces it once expired only
+	key.RequestHash = "other hash"
+	key.CreatedAt = createdAt.Add(time.Hour)
+	assert.Equal(t, ErrIdempotencyKeyConflict, querier.SaveIdempotencyKey(key, createdAt.Add(-time.Second)))
+	assert.NoError(t, querier.SaveIdempotencyKey(key, createdAt))
+
+	stored, err := querier.GetIdempotencyKey(device.ID, key.Key)
+	assert.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "other hash", stored.RequestHash)
+	assert.Equal(t, transaction.ID, stored.TransactionID)
+	assert.True(t, key.CreatedAt.Equal(stored.CreatedAt))
+
+	stored, err = querier.GetIdempotencyKey(device.ID, "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+
+	deleted, err := querier.DeleteIdempotencyKeys(createdAt.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	deleted, err = querier.DeleteIdempotencyKeys(createdAt.Add(2 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	key.DeviceID = uuid.New()
+	assert.Equal(t, ErrDeviceNotFound, querier.SaveIdempotencyKey(key, createdAt))
+}
+
+func TestPostgresSaveAndGetAPIKeys(t *testing.T) {
+	querier := newTestPostgresQuerier(t)
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	restricted := domain.APIKey{
+		ID:        uuid.New(),
+		TenantID:  "retail",
+		Name:      "terminal",
+		KeyHash:   "hash-2",
+		Scopes:    []string{domain.ScopeSignaturesCreate, domain.ScopeSignaturesRead},
+		DeviceIDs: []uuid.UUID{uuid.New(), uuid.New()},
+		CreatedAt: createdAt.Add(time.Hour),
+	}
+	admin := domain.APIKey{ID: uuid.New(), TenantID: domain.DefaultTenant, Name: "admin", KeyHash: "hash-1", Scopes: []string{domain.ScopeAdmin}, CreatedAt: createdAt}
+	require.NoError(t, querier.SaveAPIKey(restricted))
+	require.NoError(t, querier.SaveAPIKey(admin))
+
+	stored, err := querier.GetAPIKeyByHash("hash-2")
+	assert.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.True(t, restricted.CreatedAt.Equal(stored.CreatedAt))
+	stored.CreatedAt = restricted.CreatedAt
+	assert.Equal(t, &restricted, stored)
+
+	missing, err := querier.GetAPIKeyByHash("unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	keys, err := querier.GetAPIKeys()
+	assert.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, admin.ID, keys[0].ID)
+	assert.Empty(t, keys[0].DeviceIDs)
+	assert.Equal(t, restricted.ID, keys[1].ID)
 
-	assert.Panics(t, func() { querier.GetSignedTransactions(id) }) //nolint:all
+	assert.NoError(t, querier.DeleteAPIKey(admin.ID))
+	assert.Equal(t, ErrAPIKeyNotFound, querier.DeleteAPIKey(admin.ID))
 }
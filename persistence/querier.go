@@ -1,18 +1,67 @@
 package persistence
 
 import (
+	"errors"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/ildomm/ssccg/domain"
 )
 
+var ErrDeviceNotFound = errors.New("device not found")
+var ErrDeviceExists = errors.New("device already exists")
+var ErrSignCounterConflict = errors.New("sign counter already used")
+var ErrAPIKeyNotFound = errors.New("API key not found")
+var ErrIdempotencyKeyConflict = errors.New("idempotency key was saved by a concurrent request")
+
 type Querier interface {
 	Close()
 
+	// WithTx runs fn as a single unit of work: every write made through tx is committed if fn returns nil,
+	// and rolled back otherwise. Calling WithTx on tx joins the ongoing unit of work.
+	WithTx(fn func(tx Querier) error) error
+
+	// SaveDevice stores a new device, and returns ErrDeviceExists when a device with its ID is stored already.
 	SaveDevice(device domain.Device) error
 	GetDevices() ([]domain.Device, error)
 	GetDevice(id uuid.UUID) (*domain.Device, error)
 	UpdateDevice(device domain.Device) error
+
+	// GetDeviceForUpdate reads a device and locks it until the end of the unit of work, even across service instances.
+	// Changes to the device are read and written under the lock, so none is lost to a concurrent writer.
+	GetDeviceForUpdate(id uuid.UUID) (*domain.Device, error)
+	// UpdateDeviceSignCounter writes the sign counter and update time of a device, and none of its other columns.
+	UpdateDeviceSignCounter(device domain.Device) error
 	SaveSignedTransaction(transaction domain.SignedTransaction) (uuid.UUID, error)
 	GetSignedTransaction(deviceId uuid.UUID, signCounter int) (*domain.SignedTransaction, error)
+	GetSignedTransactionByID(id uuid.UUID) (*domain.SignedTransaction, error)
 	GetSignedTransactions(deviceId uuid.UUID) ([]domain.SignedTransaction, error)
+
+	// ListDevices returns a page of the devices passing the filter, in creation order.
+	ListDevices(filter DeviceFilter, page Page) ([]domain.Device, error)
+	// ListSignedTransactions returns a page of the transactions of a device passing the filter, in sign counter order.
+	ListSignedTransactions(deviceId uuid.UUID, filter SignedTransactionFilter, page Page) ([]domain.SignedTransaction, error)
+
+	// SaveDeviceKey keeps a retired key of a device, GetDeviceKeys returns them in validity order.
+	SaveDeviceKey(key domain.DeviceKey) error
+	GetDeviceKeys(deviceId uuid.UUID) ([]domain.DeviceKey, error)
+
+	// SaveDeviceStatusChange records a lifecycle state change, GetDeviceStatusChanges returns them oldest first.
+	SaveDeviceStatusChange(change domain.DeviceStatusChange) error
+	GetDeviceStatusChanges(deviceId uuid.UUID) ([]domain.DeviceStatusChange, error)
+
+	// SaveIdempotencyKey stores a key, replacing the one with the same device and key only when it was created at or before replaceUpTo,
+	// i.e. when it expired. It returns ErrIdempotencyKeyConflict when the key stored is more recent, leaving it untouched.
+	// GetIdempotencyKey returns nil when there is none, DeleteIdempotencyKeys purges the keys created before a time.
+	SaveIdempotencyKey(key domain.IdempotencyKey, replaceUpTo time.Time) error
+	GetIdempotencyKey(deviceId uuid.UUID, key string) (*domain.IdempotencyKey, error)
+	DeleteIdempotencyKeys(createdBefore time.Time) (int, error)
+
+	// SaveAPIKey stores a new API key, GetAPIKeyByHash returns nil when no key has the hash.
+	// GetAPIKeys returns the keys oldest first, DeleteAPIKey returns ErrAPIKeyNotFound when no key has the ID.
+	// API keys are not part of the unit of work of WithTx.
+	SaveAPIKey(key domain.APIKey) error
+	GetAPIKeyByHash(keyHash string) (*domain.APIKey, error)
+	GetAPIKeys() ([]domain.APIKey, error)
+	DeleteAPIKey(id uuid.UUID) error
 }
@@ -1,13 +1,38 @@
 package system
 
 import (
+	"encoding/base64"
+	"fmt"
+	"github.com/ildomm/ssccg/api"
+	"github.com/ildomm/ssccg/crypto"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	ListenAddressEnvVar = "SERVER_PORT"
+	ListenAddressEnvVar         = "SERVER_PORT"
+	DatabaseURLEnvVar           = "DATABASE_URL"
+	KEKEnvVar                   = "KEK"
+	KEKFileEnvVar               = "KEK_FILE"
+	PreviousKEKsEnvVar          = "PREVIOUS_KEKS"
+	PreviousKEKsFileEnvVar      = "PREVIOUS_KEKS_FILE"
+	KeyStoreEnvVar              = "KEY_STORE"
+	PKCS11ModuleEnvVar          = "PKCS11_MODULE"
+	PKCS11TokenLabelEnvVar      = "PKCS11_TOKEN_LABEL"
+	PKCS11PINEnvVar             = "PKCS11_PIN"
+	IdempotencyRetentionEnvVar  = "IDEMPOTENCY_RETENTION"
+	MaxDataSizeEnvVar           = "MAX_DATA_SIZE"
+	AdminAPIKeyEnvVar           = "ADMIN_API_KEY"
+	AuthDisabledEnvVar          = "AUTH_DISABLED"
+	TLSCertFileEnvVar           = "TLS_CERT_FILE"
+	TLSKeyFileEnvVar            = "TLS_KEY_FILE"
+	TLSClientCAFileEnvVar       = "TLS_CLIENT_CA_FILE"
+	TLSClientCertOptionalEnvVar = "TLS_CLIENT_CERT_OPTIONAL"
+	TLSMinVersionEnvVar         = "TLS_MIN_VERSION"
+	ShutdownTimeoutEnvVar       = "SHUTDOWN_TIMEOUT"
 )
 
 // ExtractServerPort extracts the server port from the environment variable SERVER_PORT.
@@ -25,3 +50,199 @@ func ExtractServerPort() *int {
 
 	return nil
 }
+
+// ExtractIdempotencyRetention extracts how long idempotency keys are remembered from the environment variable IDEMPOTENCY_RETENTION.
+// The retention is a duration, like "24h" or "90m".
+func ExtractIdempotencyRetention() *time.Duration {
+	if env, found := os.LookupEnv(IdempotencyRetentionEnvVar); found {
+		value, err := time.ParseDuration(env)
+
+		if err != nil || value <= 0 {
+			log.Println("Could not parse idempotency retention from environment variable ", IdempotencyRetentionEnvVar)
+			return nil
+		}
+
+		return &value
+	}
+
+	return nil
+}
+
+// ExtractShutdownTimeout extracts how long the requests in flight are waited for on shutdown from the environment variable SHUTDOWN_TIMEOUT.
+// The timeout is a duration, like "25s" or "1m".
+func ExtractShutdownTimeout() *time.Duration {
+	if env, found := os.LookupEnv(ShutdownTimeoutEnvVar); found {
+		value, err := time.ParseDuration(env)
+
+		if err != nil || value <= 0 {
+			log.Println("Could not parse shutdown timeout from environment variable ", ShutdownTimeoutEnvVar)
+			return nil
+		}
+
+		return &value
+	}
+
+	return nil
+}
+
+// ExtractMaxDataSize extracts the largest data accepted for signing, in bytes, from the environment variable MAX_DATA_SIZE.
+func ExtractMaxDataSize() *int64 {
+	if env, found := os.LookupEnv(MaxDataSizeEnvVar); found {
+		value, err := strconv.ParseInt(env, 10, 64)
+
+		if err != nil || value <= 0 {
+			log.Println("Could not parse maximum data size from environment variable ", MaxDataSizeEnvVar)
+			return nil
+		}
+
+		return &value
+	}
+
+	return nil
+}
+
+// ExtractDatabaseURL extracts the Postgres connection URL from the environment variable DATABASE_URL.
+func ExtractDatabaseURL() *string {
+	if env, found := os.LookupEnv(DatabaseURLEnvVar); found && env != "" {
+		return &env
+	}
+
+	return nil
+}
+
+// ExtractAdminAPIKey extracts the API key granted the admin scope from the environment variable ADMIN_API_KEY.
+func ExtractAdminAPIKey() *string {
+	if env, found := os.LookupEnv(AdminAPIKeyEnvVar); found && env != "" {
+		return &env
+	}
+
+	return nil
+}
+
+// ExtractAuthDisabled extracts whether the API key authentication is disabled from the environment variable AUTH_DISABLED.
+// Authentication stays enabled when the variable cannot be parsed.
+func ExtractAuthDisabled() bool {
+	if env, found := os.LookupEnv(AuthDisabledEnvVar); found {
+		value, err := strconv.ParseBool(env)
+
+		if err != nil {
+			log.Println("Could not parse authentication switch from environment variable ", AuthDisabledEnvVar)
+			return false
+		}
+
+		return value
+	}
+
+	return false
+}
+
+// ExtractTLSConfig extracts the TLS settings from the environment variables
+// TLS_CERT_FILE, TLS_KEY_FILE, TLS_CLIENT_CA_FILE, TLS_CLIENT_CERT_OPTIONAL and TLS_MIN_VERSION.
+// It returns nil when no certificate file is given, the server then serves plain HTTP.
+func ExtractTLSConfig() *api.TLSConfig {
+	certFile, found := os.LookupEnv(TLSCertFileEnvVar)
+	if !found || certFile == "" {
+		return nil
+	}
+
+	config := &api.TLSConfig{
+		CertFile:     certFile,
+		KeyFile:      os.Getenv(TLSKeyFileEnvVar),
+		ClientCAFile: os.Getenv(TLSClientCAFileEnvVar),
+	}
+
+	if env, found := os.LookupEnv(TLSClientCertOptionalEnvVar); found {
+		value, err := strconv.ParseBool(env)
+		if err != nil {
+			log.Println("Could not parse client certificate switch from environment variable ", TLSClientCertOptionalEnvVar)
+		}
+		config.ClientCertOptional = value
+	}
+
+	if env, found := os.LookupEnv(TLSMinVersionEnvVar); found {
+		value, err := api.ParseTLSVersion(env)
+		if err != nil {
+			log.Println("Could not parse minimum TLS version from environment variable ", TLSMinVersionEnvVar)
+		}
+		config.MinVersion = value
+	}
+
+	return config
+}
+
+// ExtractKeyStore extracts the name of the key store holding the device private keys from the environment variable KEY_STORE.
+// It defaults to the local key store.
+func ExtractKeyStore() string {
+	if env, found := os.LookupEnv(KeyStoreEnvVar); found && env != "" {
+		return env
+	}
+
+	return crypto.LocalKeyStoreName
+}
+
+// ExtractPKCS11Config extracts the PKCS#11 token settings from the environment variables
+// PKCS11_MODULE, PKCS11_TOKEN_LABEL and PKCS11_PIN.
+// It returns nil when no PKCS#11 module is given.
+func ExtractPKCS11Config() *crypto.PKCS11Config {
+	module, found := os.LookupEnv(PKCS11ModuleEnvVar)
+	if !found || module == "" {
+		return nil
+	}
+
+	return &crypto.PKCS11Config{
+		ModulePath: module,
+		TokenLabel: os.Getenv(PKCS11TokenLabelEnvVar),
+		PIN:        os.Getenv(PKCS11PINEnvVar),
+	}
+}
+
+// ExtractKeyEncryptionKey extracts the base64 encoded key encryption key,
+// from the file named by the environment variable KEK_FILE, or else from the environment variable KEK.
+func ExtractKeyEncryptionKey() ([]byte, error) {
+	keys, err := extractKeys(KEKFileEnvVar, KEKEnvVar)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+	if len(keys) != 1 {
+		return nil, fmt.Errorf("exactly one key encryption key must be given, found %d", len(keys))
+	}
+	return keys[0], nil
+}
+
+// ExtractPreviousKeyEncryptionKeys extracts the base64 encoded key encryption keys replaced by the current one,
+// from the file named by the environment variable PREVIOUS_KEKS_FILE, or else from the environment variable PREVIOUS_KEKS.
+// Keys are separated by commas or new lines.
+func ExtractPreviousKeyEncryptionKeys() ([][]byte, error) {
+	return extractKeys(PreviousKEKsFileEnvVar, PreviousKEKsEnvVar)
+}
+
+// extractKeys reads base64 encoded keys from a file, or else from an environment variable.
+// It returns nil when neither is set.
+func extractKeys(fileEnvVar, envVar string) ([][]byte, error) {
+	var value string
+	if path, found := os.LookupEnv(fileEnvVar); found && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", fileEnvVar, err)
+		}
+		value = string(content)
+	} else if env, found := os.LookupEnv(envVar); found && env != "" {
+		value = env
+	} else {
+		return nil, nil
+	}
+
+	var keys [][]byte
+	for _, encoded := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		encoded = strings.TrimSpace(encoded)
+		if encoded == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode key from %s: %w", envVar, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,46 @@
+package test_helpers
+
+import (
+	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/domain"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockAPIKeyDAO is a mock type for the APIKeyDAO type
+type mockAPIKeyDAO struct {
+	mock.Mock
+}
+
+// NewMockAPIKeyDAO creates a new instance of mockAPIKeyDAO
+func NewMockAPIKeyDAO() *mockAPIKeyDAO {
+	return &mockAPIKeyDAO{}
+}
+
+func (m *mockAPIKeyDAO) CreateAPIKey(tenantId, name string, scopes []string, deviceIds []uuid.UUID) (*domain.APIKey, string, error) {
+	args := m.Called(tenantId, name, scopes, deviceIds)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.APIKey), args.String(1), args.Error(2)
+	}
+	return nil, args.String(1), args.Error(2)
+}
+
+func (m *mockAPIKeyDAO) ListAPIKeys(tenantId string) ([]domain.APIKey, error) {
+	args := m.Called(tenantId)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.APIKey), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockAPIKeyDAO) DeleteAPIKey(tenantId string, id uuid.UUID) error {
+	args := m.Called(tenantId, id)
+	return args.Error(0)
+}
+
+func (m *mockAPIKeyDAO) Authenticate(key string) (*domain.APIKey, error) {
+	args := m.Called(key)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.APIKey), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
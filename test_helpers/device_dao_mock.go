@@ -2,7 +2,9 @@ package test_helpers
 
 import (
 	"github.com/google/uuid"
+	"github.com/ildomm/ssccg/crypto"
 	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -16,14 +18,20 @@ func NewMockDeviceDAO() *mockDeviceDAO {
 	return &mockDeviceDAO{}
 }
 
-func (m *mockDeviceDAO) CreateDevice(id uuid.UUID, label, algorithm string) (*domain.Device, error) {
-	args := m.Called(id, label, algorithm)
-	return args.Get(0).(*domain.Device), args.Error(1)
+func (m *mockDeviceDAO) CreateDevice(id uuid.UUID, label, algorithm string, parameters crypto.KeyParameters) (*domain.Device, error) {
+	args := m.Called(id, label, algorithm, parameters)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.Device), args.Error(1)
+	}
+	return nil, args.Error(1)
 }
 
-func (m *mockDeviceDAO) GetDevices() ([]domain.Device, error) {
-	args := m.Called()
-	return args.Get(0).([]domain.Device), args.Error(1)
+func (m *mockDeviceDAO) ListDevices(filter persistence.DeviceFilter, page persistence.Page) ([]domain.Device, error) {
+	args := m.Called(filter, page)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.Device), args.Error(1)
+	}
+	return nil, args.Error(1)
 }
 
 func (m *mockDeviceDAO) GetDevice(id uuid.UUID) (*domain.Device, error) {
@@ -33,10 +41,104 @@ func (m *mockDeviceDAO) GetDevice(id uuid.UUID) (*domain.Device, error) {
 
 func (m *mockDeviceDAO) CreateSignedTransaction(deviceId uuid.UUID, data []byte) (*domain.SignedTransaction, error) {
 	args := m.Called(deviceId, data)
-	return args.Get(0).(*domain.SignedTransaction), args.Error(1)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.SignedTransaction), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) CreateDigestSignedTransaction(deviceId uuid.UUID, hashAlgorithm string, digest []byte) (*domain.SignedTransaction, error) {
+	args := m.Called(deviceId, hashAlgorithm, digest)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.SignedTransaction), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) CreateIdempotentSignedTransaction(deviceId uuid.UUID, idempotencyKey string, data []byte) (*domain.SignedTransaction, bool, error) {
+	args := m.Called(deviceId, idempotencyKey, data)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.SignedTransaction), args.Bool(1), args.Error(2)
+	}
+	return nil, args.Bool(1), args.Error(2)
+}
+
+func (m *mockDeviceDAO) CreateSignedTransactions(deviceId uuid.UUID, data [][]byte, mode string) ([]domain.BatchSignature, error) {
+	args := m.Called(deviceId, data, mode)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.BatchSignature), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) ListSignedTransactions(deviceId uuid.UUID, filter persistence.SignedTransactionFilter, page persistence.Page) ([]domain.SignedTransaction, error) {
+	args := m.Called(deviceId, filter, page)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.SignedTransaction), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) VerifySignedTransaction(deviceId uuid.UUID, request domain.SignatureVerificationRequest) (*domain.SignatureVerification, error) {
+	args := m.Called(deviceId, request)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.SignatureVerification), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) AuditSignedTransactions(deviceId uuid.UUID) (*domain.ChainAudit, error) {
+	args := m.Called(deviceId)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.ChainAudit), args.Error(1)
+	}
+	return nil, args.Error(1)
 }
 
-func (m *mockDeviceDAO) GetSignedTransactions(deviceId uuid.UUID) ([]domain.SignedTransaction, error) {
+func (m *mockDeviceDAO) GetDeviceKeys(deviceId uuid.UUID) ([]domain.DeviceKey, error) {
 	args := m.Called(deviceId)
-	return args.Get(0).([]domain.SignedTransaction), args.Error(1)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.DeviceKey), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) RotateDeviceKey(deviceId uuid.UUID) (*domain.KeyRotation, error) {
+	args := m.Called(deviceId)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.KeyRotation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) ChangeDeviceStatus(deviceId uuid.UUID, status, reason string) (*domain.Device, error) {
+	args := m.Called(deviceId, status, reason)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.Device), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) GetDeviceStatusChanges(deviceId uuid.UUID) ([]domain.DeviceStatusChange, error) {
+	args := m.Called(deviceId)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.DeviceStatusChange), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) GetSignedTransaction(deviceId uuid.UUID, signCounter int) (*domain.SignedTransaction, error) {
+	args := m.Called(deviceId, signCounter)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.SignedTransaction), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockDeviceDAO) GetSignedTransactionByID(id uuid.UUID) (*domain.SignedTransaction, error) {
+	args := m.Called(id)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.SignedTransaction), args.Error(1)
+	}
+	return nil, args.Error(1)
 }
@@ -3,7 +3,9 @@ package test_helpers
 import (
 	"github.com/google/uuid"
 	"github.com/ildomm/ssccg/domain"
+	"github.com/ildomm/ssccg/persistence"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
 // MockQuerier is a mock of Querier interface
@@ -19,6 +21,11 @@ func (m *MockQuerier) Close() {
 	m.Called()
 }
 
+// WithTx runs fn against the mock itself, so the calls made within the unit of work hit the same expectations.
+func (m *MockQuerier) WithTx(fn func(tx persistence.Querier) error) error {
+	return fn(m)
+}
+
 func (m *MockQuerier) SaveDevice(device domain.Device) error {
 	args := m.Called(device)
 	return args.Error(0)
@@ -45,6 +52,19 @@ func (m *MockQuerier) UpdateDevice(device domain.Device) error {
 	return args.Error(0)
 }
 
+func (m *MockQuerier) GetDeviceForUpdate(id uuid.UUID) (*domain.Device, error) {
+	args := m.Called(id)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.Device), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) UpdateDeviceSignCounter(device domain.Device) error {
+	args := m.Called(device)
+	return args.Error(0)
+}
+
 func (m *MockQuerier) SaveSignedTransaction(transaction domain.SignedTransaction) (uuid.UUID, error) {
 	args := m.Called(transaction)
 	if arg := args.Get(0); arg != nil {
@@ -68,3 +88,97 @@ func (m *MockQuerier) GetSignedTransactions(deviceId uuid.UUID) ([]domain.Signed
 	}
 	return nil, args.Error(1)
 }
+
+func (m *MockQuerier) SaveDeviceKey(key domain.DeviceKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) GetDeviceKeys(deviceId uuid.UUID) ([]domain.DeviceKey, error) {
+	args := m.Called(deviceId)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.DeviceKey), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) SaveDeviceStatusChange(change domain.DeviceStatusChange) error {
+	args := m.Called(change)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) GetDeviceStatusChanges(deviceId uuid.UUID) ([]domain.DeviceStatusChange, error) {
+	args := m.Called(deviceId)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.DeviceStatusChange), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) ListDevices(filter persistence.DeviceFilter, page persistence.Page) ([]domain.Device, error) {
+	args := m.Called(filter, page)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.Device), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) ListSignedTransactions(deviceId uuid.UUID, filter persistence.SignedTransactionFilter, page persistence.Page) ([]domain.SignedTransaction, error) {
+	args := m.Called(deviceId, filter, page)
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.SignedTransaction), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) GetSignedTransactionByID(id uuid.UUID) (*domain.SignedTransaction, error) {
+	args := m.Called(id)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.SignedTransaction), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) SaveIdempotencyKey(key domain.IdempotencyKey, replaceUpTo time.Time) error {
+	args := m.Called(key, replaceUpTo)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) GetIdempotencyKey(deviceId uuid.UUID, key string) (*domain.IdempotencyKey, error) {
+	args := m.Called(deviceId, key)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.IdempotencyKey), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) DeleteIdempotencyKeys(createdBefore time.Time) (int, error) {
+	args := m.Called(createdBefore)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockQuerier) SaveAPIKey(key domain.APIKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) GetAPIKeyByHash(keyHash string) (*domain.APIKey, error) {
+	args := m.Called(keyHash)
+	if arg := args.Get(0); arg != nil {
+		return arg.(*domain.APIKey), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) GetAPIKeys() ([]domain.APIKey, error) {
+	args := m.Called()
+	if arg := args.Get(0); arg != nil {
+		return arg.([]domain.APIKey), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockQuerier) DeleteAPIKey(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}